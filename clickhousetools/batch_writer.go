@@ -0,0 +1,394 @@
+package clickhousetools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// -------- 写入：异步批量 BatchWriter --------
+
+var (
+	ErrBufferFull   = errors.New("batch writer buffer full")
+	ErrWriterClosed = errors.New("batch writer closed")
+)
+
+// OverflowPolicy 缓冲区写满后的处理策略
+type OverflowPolicy int
+
+const (
+	OverflowReject     OverflowPolicy = iota // Write 立即返回 ErrBufferFull（默认）
+	OverflowDropOldest                       // 丢弃缓冲区中最旧的行，为新行腾出空间
+	OverflowBlock                            // Write 阻塞直到有空间或 Close
+)
+
+// BatchWriterConfig BatchWriter 配置，零值字段使用默认值
+type BatchWriterConfig[T any] struct {
+	Table           string                    // 写入的表，如 "db.events"
+	MaxRows         int                       // 单批最大行数，默认10000
+	MaxBytes        int                       // 单批最大估算字节数，默认16MiB
+	MaxInterval     time.Duration             // 最长刷新间隔，默认1秒
+	MaxBufferedRows int                       // 缓冲区最大行数，不含正在写入的批次，默认 MaxRows*10
+	Overflow        OverflowPolicy            // 缓冲区写满后的策略
+	MaxRetries      int                       // 单批写入失败后的重试次数，默认3，小于0表示不重试
+	RetryBackoff    time.Duration             // 首次重试等待时间，之后每次翻倍，默认500毫秒
+	MaxRetryBackoff time.Duration             // 重试等待时间上限，默认30秒
+	SizeFunc        func(row T) int           // 估算单行字节数，默认按字段反射估算
+	OnError         func(rows []T, err error) // 批次最终写入失败时回调，这些行不会再写入
+	BatchOptions    WithBatchOptions          // 传给每次写入的选项
+}
+
+func (c BatchWriterConfig[T]) withDefaults() BatchWriterConfig[T] {
+	if c.MaxRows <= 0 {
+		c.MaxRows = 10000
+	}
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = 16 << 20
+	}
+	if c.MaxInterval <= 0 {
+		c.MaxInterval = time.Second
+	}
+	if c.MaxBufferedRows <= 0 {
+		c.MaxBufferedRows = c.MaxRows * 10
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = 3
+	} else if c.MaxRetries < 0 {
+		c.MaxRetries = 0
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = 500 * time.Millisecond
+	}
+	if c.MaxRetryBackoff <= 0 {
+		c.MaxRetryBackoff = 30 * time.Second
+	}
+	if c.SizeFunc == nil {
+		c.SizeFunc = func(row T) int { return estimateSize(reflect.ValueOf(row)) }
+	}
+	return c
+}
+
+// BatchWriterStats BatchWriter 运行统计
+type BatchWriterStats struct {
+	Buffered uint64 // 当前缓冲的行数
+	Written  uint64 // 已成功写入的行数
+	Dropped  uint64 // 因缓冲区写满被丢弃或拒绝的行数
+	Failed   uint64 // 重试后仍写入失败的行数
+	Retries  uint64 // 重试次数
+	Batches  uint64 // 成功写入的批次数
+}
+
+// BatchWriter 异步批量写入器，将单行写入合并为批次，避免产生过多的 part
+// 行按写入顺序由单个后台协程依次写入，达到 MaxRows、MaxBytes 或 MaxInterval 任意条件时刷新
+type BatchWriter[T any] struct {
+	config BatchWriterConfig[T]
+	insert func(ctx context.Context, rows []T) error
+
+	mu       sync.Mutex
+	notFull  *sync.Cond
+	rows     []T
+	sizes    []int // 与 rows 一一对应的估算字节数
+	bytes    int
+	closed   bool
+	flushCh  chan struct{}
+	done     chan struct{}
+	ctx      context.Context // Close 超时后取消，中止正在进行的写入与重试
+	cancel   context.CancelFunc
+	closeErr error
+
+	written atomic.Uint64
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+	retries atomic.Uint64
+	batches atomic.Uint64
+}
+
+// NewBatchWriter 创建写入 table 的 BatchWriter，使用完毕必须调用 Close
+// 示例：w, _ := NewBatchWriter(client, BatchWriterConfig[Event]{Table: "db.events", MaxRows: 5000})
+func NewBatchWriter[T any](c *ClickHouseClient, config BatchWriterConfig[T]) (*BatchWriter[T], error) {
+	if c == nil {
+		return nil, fmt.Errorf("clickhouse client cannot be nil")
+	}
+	return newBatchWriter(config, func(ctx context.Context, rows []T) error {
+		return addData(ctx, c, config.Table, rows, config.BatchOptions)
+	})
+}
+
+func newBatchWriter[T any](config BatchWriterConfig[T], insert func(ctx context.Context, rows []T) error) (*BatchWriter[T], error) {
+	if config.Table == "" {
+		return nil, fmt.Errorf("table cannot be empty")
+	}
+	config = config.withDefaults()
+	if config.MaxBufferedRows < config.MaxRows {
+		return nil, fmt.Errorf("max buffered rows %d must not be less than max rows %d", config.MaxBufferedRows, config.MaxRows)
+	}
+
+	w := &BatchWriter[T]{
+		config:  config,
+		insert:  insert,
+		flushCh: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	w.notFull = sync.NewCond(&w.mu)
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	go w.run()
+	return w, nil
+}
+
+// Write 将一行加入缓冲区，不等待写入完成
+// 缓冲区已满时按 Overflow 策略处理；Close 之后返回 ErrWriterClosed
+func (w *BatchWriter[T]) Write(row T) error {
+	size := w.config.SizeFunc(row)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for !w.closed && len(w.rows) >= w.config.MaxBufferedRows {
+		switch w.config.Overflow {
+		case OverflowDropOldest:
+			w.bytes -= w.sizes[0]
+			var zero T
+			w.rows[0] = zero
+			w.rows, w.sizes = w.rows[1:], w.sizes[1:]
+			w.dropped.Add(1)
+		case OverflowBlock:
+			w.notFull.Wait()
+		default:
+			w.dropped.Add(1)
+			return ErrBufferFull
+		}
+	}
+	if w.closed {
+		return ErrWriterClosed
+	}
+
+	w.rows = append(w.rows, row)
+	w.sizes = append(w.sizes, size)
+	w.bytes += size
+	if len(w.rows) >= w.config.MaxRows || w.bytes >= w.config.MaxBytes {
+		w.signal()
+	}
+	return nil
+}
+
+// Stats 返回运行统计
+func (w *BatchWriter[T]) Stats() BatchWriterStats {
+	w.mu.Lock()
+	buffered := len(w.rows)
+	w.mu.Unlock()
+	return BatchWriterStats{
+		Buffered: uint64(buffered),
+		Written:  w.written.Load(),
+		Dropped:  w.dropped.Load(),
+		Failed:   w.failed.Load(),
+		Retries:  w.retries.Load(),
+		Batches:  w.batches.Load(),
+	}
+}
+
+// Close 停止接收新行并写入缓冲区中剩余的所有行
+// ctx 到期时中止写入，未写入的行交给 OnError 并返回错误；关闭期间有批次写入失败时同样返回错误
+func (w *BatchWriter[T]) Close(ctx context.Context) error {
+	w.mu.Lock()
+	alreadyClosed := w.closed
+	w.closed = true
+	w.notFull.Broadcast()
+	w.mu.Unlock()
+	if !alreadyClosed {
+		w.signal()
+	}
+
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		w.cancel()
+		<-w.done
+	}
+	w.cancel()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closeErr
+}
+
+// signal 唤醒后台协程，不阻塞
+func (w *BatchWriter[T]) signal() {
+	select {
+	case w.flushCh <- struct{}{}:
+	default:
+	}
+}
+
+// run 后台刷新协程：按阈值写入完整批次，定时或关闭时写入全部剩余行
+func (w *BatchWriter[T]) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.config.MaxInterval)
+	defer ticker.Stop()
+
+	for {
+		all := false
+		select {
+		case <-w.flushCh:
+		case <-ticker.C:
+			all = true
+		}
+
+		for {
+			rows, closed := w.take(all)
+			if len(rows) == 0 {
+				if closed {
+					return
+				}
+				break
+			}
+			err := w.insertWithRetry(rows)
+			if err == nil {
+				continue
+			}
+			w.failed.Add(uint64(len(rows)))
+			if w.config.OnError != nil {
+				w.config.OnError(rows, err)
+			}
+			if closed {
+				w.setCloseErr(err)
+			}
+			if w.ctx.Err() != nil {
+				// Close 超时：剩余的行不再尝试写入
+				w.abandon()
+				return
+			}
+		}
+	}
+}
+
+// take 从缓冲区头部取出一批不超过 MaxRows 与 MaxBytes 的行
+// all 为false时只取完整批次；关闭后总是取出剩余的行
+func (w *BatchWriter[T]) take(all bool) ([]T, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	all = all || w.closed
+	if len(w.rows) == 0 || (!all && len(w.rows) < w.config.MaxRows && w.bytes < w.config.MaxBytes) {
+		return nil, w.closed
+	}
+
+	n, bytes := 0, 0
+	for n < len(w.rows) && n < w.config.MaxRows {
+		// 单行超过 MaxBytes 时仍然单独成批
+		if n > 0 && bytes+w.sizes[n] > w.config.MaxBytes {
+			break
+		}
+		bytes += w.sizes[n]
+		n++
+	}
+
+	batch := make([]T, n)
+	copy(batch, w.rows[:n])
+	clear(w.rows[:n])
+	w.rows, w.sizes = w.rows[n:], w.sizes[n:]
+	w.bytes -= bytes
+	w.notFull.Broadcast()
+	return batch, w.closed
+}
+
+// abandon 取出缓冲区中剩余的行并按失败处理
+func (w *BatchWriter[T]) abandon() {
+	w.mu.Lock()
+	rows := w.rows
+	w.rows, w.sizes, w.bytes = nil, nil, 0
+	w.mu.Unlock()
+
+	if len(rows) == 0 {
+		return
+	}
+	err := fmt.Errorf("%d rows not written before close: %w", len(rows), w.ctx.Err())
+	w.failed.Add(uint64(len(rows)))
+	if w.config.OnError != nil {
+		w.config.OnError(rows, err)
+	}
+	w.setCloseErr(err)
+}
+
+func (w *BatchWriter[T]) setCloseErr(err error) {
+	w.mu.Lock()
+	w.closeErr = errors.Join(w.closeErr, err)
+	w.mu.Unlock()
+}
+
+// insertWithRetry 写入一批行，失败后按指数退避重试
+func (w *BatchWriter[T]) insertWithRetry(rows []T) error {
+	backoff := w.config.RetryBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = w.insert(w.ctx, rows); err == nil {
+			w.written.Add(uint64(len(rows)))
+			w.batches.Add(1)
+			return nil
+		}
+		if attempt >= w.config.MaxRetries || w.ctx.Err() != nil {
+			break
+		}
+		w.retries.Add(1)
+		select {
+		case <-w.ctx.Done():
+			return fmt.Errorf("insert into %s: %w", w.config.Table, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, w.config.MaxRetryBackoff)
+	}
+	return fmt.Errorf("insert %d rows into %s after %d attempts: %w", len(rows), w.config.Table, w.config.MaxRetries+1, err)
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// estimateSize 粗略估算一行数据在内存中的字节数，用于 MaxBytes 判断
+func estimateSize(v reflect.Value) int {
+	if !v.IsValid() {
+		return 0
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.Len()
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return estimateSize(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return 0
+		}
+		switch v.Type().Elem().Kind() {
+		case reflect.String, reflect.Slice, reflect.Array, reflect.Map, reflect.Struct, reflect.Pointer, reflect.Interface:
+			size := 0
+			for i := 0; i < v.Len(); i++ {
+				size += estimateSize(v.Index(i))
+			}
+			return size
+		default:
+			return v.Len() * int(v.Type().Elem().Size())
+		}
+	case reflect.Map:
+		size := 0
+		iter := v.MapRange()
+		for iter.Next() {
+			size += estimateSize(iter.Key()) + estimateSize(iter.Value())
+		}
+		return size
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return 8
+		}
+		size := 0
+		for i := 0; i < v.NumField(); i++ {
+			size += estimateSize(v.Field(i))
+		}
+		return size
+	default:
+		return int(v.Type().Size())
+	}
+}
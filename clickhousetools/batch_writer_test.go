@@ -0,0 +1,210 @@
+package clickhousetools
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type writerRow struct {
+	ID   int    `ch:"id"`
+	Name string `ch:"name"`
+}
+
+// recordingInsert 记录每次写入的批次，前 failures 次返回错误
+type recordingInsert struct {
+	mu       sync.Mutex
+	batches  [][]writerRow
+	calls    int
+	failures int
+	block    chan struct{} // 非nil时每次写入等待该channel关闭
+}
+
+func (r *recordingInsert) insert(ctx context.Context, rows []writerRow) error {
+	if r.block != nil {
+		select {
+		case <-r.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if r.calls <= r.failures {
+		return errors.New("too many parts")
+	}
+	r.batches = append(r.batches, append([]writerRow(nil), rows...))
+	return nil
+}
+
+func (r *recordingInsert) rows() []writerRow {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var all []writerRow
+	for _, b := range r.batches {
+		all = append(all, b...)
+	}
+	return all
+}
+
+func TestBatchWriter_FlushOnMaxRows(t *testing.T) {
+	rec := &recordingInsert{}
+	w, err := newBatchWriter(BatchWriterConfig[writerRow]{Table: "t", MaxRows: 3, MaxInterval: time.Hour}, rec.insert)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	for i := 0; i < 7; i++ {
+		if err := w.Write(writerRow{ID: i}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(rec.rows()) < 6 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := len(rec.rows()); got != 6 {
+		t.Fatalf("expected two full batches before close, got %d rows", got)
+	}
+
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	rows := rec.rows()
+	if len(rows) != 7 || len(rec.batches) != 3 {
+		t.Fatalf("expected 7 rows in 3 batches, got %d rows in %d batches", len(rows), len(rec.batches))
+	}
+	for i, r := range rows {
+		if r.ID != i {
+			t.Errorf("row %d out of order: %+v", i, r)
+		}
+	}
+	if err := w.Write(writerRow{}); !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("expected ErrWriterClosed, got %v", err)
+	}
+}
+
+func TestBatchWriter_FlushOnMaxBytesAndInterval(t *testing.T) {
+	rec := &recordingInsert{}
+	w, _ := newBatchWriter(BatchWriterConfig[writerRow]{
+		Table:       "t",
+		MaxBytes:    10,
+		MaxInterval: 20 * time.Millisecond,
+		SizeFunc:    func(r writerRow) int { return len(r.Name) },
+	}, rec.insert)
+	defer w.Close(context.Background())
+
+	_ = w.Write(writerRow{ID: 1, Name: "123456"})
+	_ = w.Write(writerRow{ID: 2, Name: "123456"})
+	_ = w.Write(writerRow{ID: 3, Name: "1"})
+
+	deadline := time.Now().Add(time.Second)
+	for len(rec.rows()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.batches) < 2 || len(rec.batches[0]) != 1 {
+		t.Errorf("expected first batch split by max bytes, got %v", rec.batches)
+	}
+}
+
+func TestBatchWriter_Overflow(t *testing.T) {
+	rec := &recordingInsert{block: make(chan struct{})}
+	w, _ := newBatchWriter(BatchWriterConfig[writerRow]{Table: "t", MaxRows: 2, MaxBufferedRows: 2, MaxInterval: time.Hour}, rec.insert)
+
+	// 前两行被后台协程取走后阻塞在写入中，之后的两行填满缓冲区
+	_ = w.Write(writerRow{ID: 1})
+	_ = w.Write(writerRow{ID: 2})
+	deadline := time.Now().Add(time.Second)
+	for w.Stats().Buffered != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	_ = w.Write(writerRow{ID: 3})
+	_ = w.Write(writerRow{ID: 4})
+	if err := w.Write(writerRow{ID: 5}); !errors.Is(err, ErrBufferFull) {
+		t.Fatalf("expected ErrBufferFull, got %v", err)
+	}
+
+	w.config.Overflow = OverflowDropOldest
+	if err := w.Write(writerRow{ID: 6}); err != nil {
+		t.Fatalf("write with drop oldest: %v", err)
+	}
+	close(rec.block)
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	var ids []int
+	for _, r := range rec.rows() {
+		ids = append(ids, r.ID)
+	}
+	if len(ids) != 4 || ids[2] != 4 || ids[3] != 6 {
+		t.Errorf("unexpected written ids %v", ids)
+	}
+	if st := w.Stats(); st.Dropped != 2 || st.Written != 4 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+}
+
+func TestBatchWriter_RetriesAndOnError(t *testing.T) {
+	rec := &recordingInsert{failures: 2}
+	var failed []writerRow
+	w, _ := newBatchWriter(BatchWriterConfig[writerRow]{
+		Table:        "t",
+		RetryBackoff: time.Millisecond,
+		MaxRetries:   1,
+		OnError:      func(rows []writerRow, err error) { failed = append(failed, rows...) },
+	}, rec.insert)
+
+	_ = w.Write(writerRow{ID: 1})
+	if err := w.Close(context.Background()); err == nil {
+		t.Fatal("expected close error after retries exhausted")
+	}
+	if len(failed) != 1 || rec.calls != 2 {
+		t.Errorf("expected 1 failed row after 2 attempts, got %d rows after %d attempts", len(failed), rec.calls)
+	}
+	if st := w.Stats(); st.Failed != 1 || st.Retries != 1 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+}
+
+func TestBatchWriter_CloseTimeout(t *testing.T) {
+	rec := &recordingInsert{block: make(chan struct{})}
+	var failed int
+	w, _ := newBatchWriter(BatchWriterConfig[writerRow]{
+		Table:      "t",
+		MaxRows:    1,
+		MaxRetries: -1,
+		OnError:    func(rows []writerRow, err error) { failed += len(rows) },
+	}, rec.insert)
+	for i := 0; i < 3; i++ {
+		_ = w.Write(writerRow{ID: i})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := w.Close(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+	if failed != 3 {
+		t.Errorf("expected all 3 rows reported as failed, got %d", failed)
+	}
+}
+
+func TestEstimateSize(t *testing.T) {
+	type row struct {
+		ID   uint64
+		Name string
+		Tags []string
+		At   time.Time
+		Attr map[string]string
+	}
+	got := estimateSize(reflect.ValueOf(row{ID: 1, Name: "abc", Tags: []string{"x", "yz"}, At: time.Now(), Attr: map[string]string{"k": "v"}}))
+	if want := 8 + 3 + 3 + 8 + 2; got != want {
+		t.Errorf("estimateSize = %d, want %d", got, want)
+	}
+}
@@ -2,7 +2,10 @@ package clickhousetools
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
@@ -10,12 +13,38 @@ import (
 )
 
 // ClickHouseConfig Addresses ck集群链接地址 []string{"ch1:9000", "ch2:9000", "ch3:9000"}
+// 连接相关字段的零值使用默认值，默认值与之前硬编码的一致
 type ClickHouseConfig struct {
 	Addresses  []string `json:"address"`
 	Username   string   `json:"username"`
 	Password   string   `json:"password"`
 	Database   string   `json:"database"`
 	InitTables []string `json:"init_tables"`
+
+	MigrationsDir     string `json:"migrations_dir"`     // 非空时连接后执行该目录中的版本化迁移，见 Migrate
+	MigrationsCluster string `json:"migrations_cluster"` // 迁移以 ON CLUSTER 执行的集群名
+
+	Protocol             string        `json:"protocol"`               // native（默认）、http、https
+	HTTPPath             string        `json:"http_path"`              // HTTP 协议下附加的URL路径
+	Compression          string        `json:"compression"`            // lz4（默认）、zstd、none；HTTP 协议还支持 gzip、deflate、br
+	CompressionLevel     int           `json:"compression_level"`      // 压缩级别，0 使用算法默认值
+	MaxCompressionBuffer int           `json:"max_compression_buffer"` // 压缩缓冲区大小，默认32MiB
+	BlockBufferSize      uint8         `json:"block_buffer_size"`      // 块缓冲数，默认2
+	DialTimeout          time.Duration `json:"dial_timeout"`           // 默认3秒
+	ReadTimeout          time.Duration `json:"read_timeout"`           // 默认3分钟
+	MaxOpenConns         int           `json:"max_open_conns"`         // 默认128
+	MaxIdleConns         int           `json:"max_idle_conns"`         // 默认32
+	ConnMaxLifetime      time.Duration `json:"conn_max_lifetime"`      // 默认25分钟
+	ConnOpenStrategy     string        `json:"conn_open_strategy"`     // round_robin（默认）、in_order、random
+	InitTimeout          time.Duration `json:"init_timeout"`           // 建库与 InitTables 中每条语句的超时，默认2秒
+	DatabaseCluster      string        `json:"database_cluster"`       // 非空时以 ON CLUSTER 创建数据库
+
+	TLSEnabled            bool   `json:"tls_enabled"`              // 启用TLS，Protocol 为 https 时自动启用
+	TLSCAFile             string `json:"tls_ca_file"`              // CA证书文件，为空时使用系统证书
+	TLSCertFile           string `json:"tls_cert_file"`            // 客户端证书文件（双向TLS）
+	TLSKeyFile            string `json:"tls_key_file"`             // 客户端私钥文件（双向TLS）
+	TLSServerName         string `json:"tls_server_name"`          // 校验的服务端名称，为空时取连接地址
+	TLSInsecureSkipVerify bool   `json:"tls_insecure_skip_verify"` // 跳过证书校验，仅用于测试环境
 }
 
 type ClickHouseClient struct {
@@ -23,30 +52,26 @@ type ClickHouseClient struct {
 	conn   driver.Conn
 }
 
-// initialize 初始化数据库与表
+// unknownDatabaseCode ClickHouse UNKNOWN_DATABASE 错误码
+const unknownDatabaseCode = 81
+
+// initialize 执行 InitTables，连接已指向目标数据库
 func (c *ClickHouseClient) initialize() error {
-	err := c.execWithTimeout(2*time.Second, fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", c.config.Database))
-	if err != nil {
-		return err
-	}
-	
-	// 切换到目标数据库
-	err = c.execWithTimeout(2*time.Second, fmt.Sprintf("USE %s", c.config.Database))
-	if err != nil {
-		return err
-	}
-	
-	if c.config.InitTables != nil {
-		for _, it := range c.config.InitTables {
-			err := c.execWithTimeout(2*time.Second, it)
-			if err != nil {
-				return err
-			}
+	for _, it := range c.config.InitTables {
+		if err := c.execWithTimeout(c.config.initTimeout(), it); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+func (c ClickHouseConfig) initTimeout() time.Duration {
+	if c.InitTimeout > 0 {
+		return c.InitTimeout
+	}
+	return 2 * time.Second
+}
+
 // execWithTimeout 独立超时执行器
 func (c *ClickHouseClient) execWithTimeout(timeout time.Duration, exec string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -56,72 +81,105 @@ func (c *ClickHouseClient) execWithTimeout(timeout time.Duration, exec string) e
 
 func NewClickHouseClient(chc *ClickHouseConfig) (*ClickHouseClient, error) {
 	chci := &ClickHouseClient{config: *chc}
-	var err error
-	
-	// 首先连接到默认数据库进行初始化
-	chci.conn, err = clickhouse.Open(&clickhouse.Options{
-		Protocol: clickhouse.Native,
-		Addr:     chc.Addresses,
-		Auth: clickhouse.Auth{
-			Username: chc.Username,
-			Password: chc.Password,
-			Database: "default", // 先连接到默认数据库
-		},
-		DialTimeout:      3 * time.Second,
-		ReadTimeout:      3 * time.Minute,
-		MaxIdleConns:     32,
-		MaxOpenConns:     128,
-		ConnMaxLifetime:  25 * time.Minute,
-		ConnOpenStrategy: clickhouse.ConnOpenRoundRobin,
-		Compression: &clickhouse.Compression{
-			Method: clickhouse.CompressionLZ4,
-		},
-		MaxCompressionBuffer: 32 << 20, //32MiB
-		FreeBufOnConnRelease: false,
-	})
+
+	opts, err := buildOptions(chc)
+	if err != nil {
+		return nil, err
+	}
+
+	// 直接连接目标数据库；数据库不存在时先创建再重试
+	chci.conn, err = clickhouse.Open(opts)
 	if err != nil {
 		return nil, err
 	}
-	
-	// 可选：健康检查
 	if err := chci.conn.Ping(context.Background()); err != nil {
-		return nil, fmt.Errorf("clickhouse ping: %w", err)
+		if !isUnknownDatabase(err) {
+			chci.conn.Close()
+			return nil, fmt.Errorf("clickhouse ping: %w", err)
+		}
+		if err := createDatabase(chc, opts); err != nil {
+			chci.conn.Close()
+			return nil, err
+		}
+		if err := chci.conn.Ping(context.Background()); err != nil {
+			chci.conn.Close()
+			return nil, fmt.Errorf("clickhouse ping: %w", err)
+		}
 	}
 
-	// 可选：初始化库表
+	// 可选：初始化表
 	if err := chci.initialize(); err != nil {
+		chci.conn.Close()
 		return nil, fmt.Errorf("initialize schema: %w", err)
 	}
-	
-	// 重新连接到目标数据库
-	chci.conn.Close()
-	chci.conn, err = clickhouse.Open(&clickhouse.Options{
-		Protocol: clickhouse.Native,
-		Addr:     chc.Addresses,
-		Auth: clickhouse.Auth{
-			Username: chc.Username,
-			Password: chc.Password,
-			Database: chc.Database,
-		},
-		DialTimeout:      3 * time.Second,
-		ReadTimeout:      3 * time.Minute,
-		MaxIdleConns:     32,
-		MaxOpenConns:     128,
-		ConnMaxLifetime:  25 * time.Minute,
-		ConnOpenStrategy: clickhouse.ConnOpenRoundRobin,
-		Compression: &clickhouse.Compression{
-			Method: clickhouse.CompressionLZ4,
-		},
-		MaxCompressionBuffer: 32 << 20, //32MiB
-		FreeBufOnConnRelease: false,
-	})
-	if err != nil {
-		return nil, err
+
+	// 可选：执行目录中的版本化迁移
+	if chc.MigrationsDir != "" {
+		migrations, err := LoadMigrations(os.DirFS(chc.MigrationsDir), ".")
+		if err != nil {
+			chci.conn.Close()
+			return nil, err
+		}
+		if _, err := chci.Migrate(context.Background(), migrations, MigrateOptions{Cluster: chc.MigrationsCluster}); err != nil {
+			chci.conn.Close()
+			return nil, fmt.Errorf("migrate schema: %w", err)
+		}
 	}
-	
+
 	return chci, nil
 }
 
+// createDatabase 通过单连接的 default 库创建目标数据库，只在目标数据库不存在时使用
+func createDatabase(chc *ClickHouseConfig, opts *clickhouse.Options) error {
+	bootstrap := *opts
+	bootstrap.Auth.Database = "default"
+	bootstrap.MaxOpenConns, bootstrap.MaxIdleConns = 1, 1
+	conn, err := clickhouse.Open(&bootstrap)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), chc.initTimeout())
+	defer cancel()
+	if err := conn.Exec(ctx, createDatabaseSQL(chc.Database, chc.DatabaseCluster)); err != nil {
+		return fmt.Errorf("create database %s: %w", chc.Database, err)
+	}
+	return nil
+}
+
+// createDatabaseSQL 生成建库语句，库名与集群名均作为单个标识符转义
+func createDatabaseSQL(database, cluster string) string {
+	sql := "CREATE DATABASE IF NOT EXISTS " + quoteName(database)
+	if cluster != "" {
+		sql += " ON CLUSTER " + quoteName(cluster)
+	}
+	return sql
+}
+
+// isUnknownDatabase 判断错误是否为数据库不存在，兼容 native 与 HTTP 协议
+func isUnknownDatabase(err error) bool {
+	var exc *clickhouse.Exception
+	if errors.As(err, &exc) {
+		return exc.Code == unknownDatabaseCode
+	}
+	return strings.Contains(err.Error(), "UNKNOWN_DATABASE") || strings.Contains(err.Error(), fmt.Sprintf("Code: %d.", unknownDatabaseCode))
+}
+
+// quoteIdentifier 用反引号转义标识符，"db.table" 形式按库名与表名分别转义
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = quoteName(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// quoteName 将整个名字作为单个标识符转义，用于库名、集群名等不含库前缀的名字
+func quoteName(name string) string {
+	return "`" + strings.NewReplacer("\\", "\\\\", "`", "\\`").Replace(name) + "`"
+}
+
 // Close 关闭 ClickHouse 连接
 func (c *ClickHouseClient) Close() error {
 	if c.conn != nil {
@@ -149,49 +207,35 @@ type WithBatchOptions struct {
 // AddData 使用 AppendStruct 批量写入任意结构体切片（要求结构体字段带 ch tag 对齐列名）
 // 示例：AddData(client, "db.events", []Event{{...}, {...}}, WithBatchOptions{BlockBufferSize:16})
 func AddData[T any](c *ClickHouseClient, table string, rows []T, opt ...WithBatchOptions) error {
+	return AddDataContext(context.Background(), c, table, rows, opt...)
+}
+
+// AddDataContext 同 AddData，ctx 取消时中止写入
+func AddDataContext[T any](ctx context.Context, c *ClickHouseClient, table string, rows []T, opt ...WithBatchOptions) error {
 	if len(rows) == 0 {
 		return nil
 	}
 
-	// 1) 组织上下文：超时 + 释放连接 + 本次 Settings
 	var o WithBatchOptions
 	if len(opt) > 0 {
 		o = opt[0]
 	}
-	if o.Timeout <= 0 {
-		o.Timeout = 2 * time.Minute
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), o.Timeout)
-	defer cancel()
-
-	// Settings：按需打开 async_insert
-	settings := clickhouse.Settings{}
-	for k, v := range o.Settings {
-		settings[k] = v
-	}
-	if o.AsyncInsert {
-		settings["async_insert"] = 1
-		if o.WaitAsyncInsert {
-			settings["wait_for_async_insert"] = 1
-		} else {
-			settings["wait_for_async_insert"] = 0
-		}
-	}
+	return addData(ctx, c, table, rows, o)
+}
 
-	// 2) PrepareBatch：仅对本次操作覆盖 BlockBufferSize；并在完成后释放连接
-	bctx := clickhouse.Context(ctx,
-		clickhouse.WithSettings(settings),
-	)
-	if o.BlockBufferSize > 0 {
-		bctx = clickhouse.Context(bctx, clickhouse.WithBlockBufferSize(o.BlockBufferSize))
-	}
+// addData AddData 的实现，ctx 取消时中止写入
+func addData[T any](ctx context.Context, c *ClickHouseClient, table string, rows []T, o WithBatchOptions) error {
+	// 1) 组织上下文：超时 + 本次 Settings + BlockBufferSize
+	bctx, cancel := batchContext(ctx, o)
+	defer cancel()
 
+	// 2) PrepareBatch
 	batch, err := c.conn.PrepareBatch(bctx, fmt.Sprintf("INSERT INTO %s", table))
 	if err != nil {
 		return err
 	}
 
-	// 3) 逐条 AppendStruct（行式）；如需极致性能可改为列式 Append(Column)
+	// 3) 逐条 AppendStruct（行式）；如需极致性能可使用列式 AddDataColumnar
 	for i := range rows {
 		if err := batch.AppendStruct(&rows[i]); err != nil {
 			return fmt.Errorf("append struct #%d: %w", i, err)
@@ -0,0 +1,234 @@
+package clickhousetools
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// -------- 写入：列式 --------
+
+// ColumnData 一整列数据，Values 为该列的切片，如 []uint64、[]string、[][]string、[]*string
+// 切片元素类型需与列类型对应（与 batch.Column(i).Append 的要求一致）
+type ColumnData struct {
+	Name   string
+	Values any
+}
+
+// InsertColumns 以列为单位写入，每列整体追加，避免逐行反射
+// 所有列的长度必须一致；未列出的列使用表定义的默认值
+// 示例：InsertColumns(ctx, client, "db.events", []ColumnData{{"id", ids}, {"name", names}})
+func InsertColumns(ctx context.Context, c *ClickHouseClient, table string, columns []ColumnData, opt ...WithBatchOptions) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("columns cannot be empty")
+	}
+	rows := -1
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		v := reflect.ValueOf(col.Values)
+		if v.Kind() != reflect.Slice {
+			return fmt.Errorf("column %s: values must be a slice, got %T", col.Name, col.Values)
+		}
+		if rows >= 0 && v.Len() != rows {
+			return fmt.Errorf("column %s has %d rows, expected %d", col.Name, v.Len(), rows)
+		}
+		rows = v.Len()
+		names[i] = quoteIdentifier(col.Name)
+	}
+	if rows == 0 {
+		return nil
+	}
+
+	var o WithBatchOptions
+	if len(opt) > 0 {
+		o = opt[0]
+	}
+	ctx, cancel := batchContext(ctx, o)
+	defer cancel()
+
+	batch, err := c.conn.PrepareBatch(ctx, fmt.Sprintf("INSERT INTO %s (%s)", table, strings.Join(names, ", ")))
+	if err != nil {
+		return err
+	}
+	for i, col := range columns {
+		if err := batch.Column(i).Append(col.Values); err != nil {
+			return fmt.Errorf("append column %s: %w", col.Name, err)
+		}
+	}
+	return batch.Send()
+}
+
+// AddDataColumnar 与 AddData 相同，但先将结构体切片按字段转换为列再整列写入
+// 字段到列的映射按类型缓存，每批只为每列分配一次切片；字段类型需与列类型对应
+// 示例：AddDataColumnar(client, "db.events", events)
+func AddDataColumnar[T any](c *ClickHouseClient, table string, rows []T, opt ...WithBatchOptions) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	columns, err := StructToColumns(rows)
+	if err != nil {
+		return err
+	}
+	return InsertColumns(context.Background(), c, table, columns, opt...)
+}
+
+// StructToColumns 将结构体切片转换为列，列名规则与 StructColumns 一致
+func StructToColumns[T any](rows []T) ([]ColumnData, error) {
+	m, err := mapperFor(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]ColumnData, len(m.fields))
+	if len(rows) == 0 {
+		for i, f := range m.fields {
+			columns[i] = ColumnData{Name: f.name, Values: reflect.MakeSlice(reflect.SliceOf(f.typ), 0, 0).Interface()}
+		}
+		return columns, nil
+	}
+
+	base := unsafe.Pointer(unsafe.SliceData(rows))
+	stride := unsafe.Sizeof(rows[0])
+	for i, f := range m.fields {
+		columns[i] = ColumnData{Name: f.name, Values: f.fill(base, len(rows), stride, f.offset)}
+	}
+	return columns, nil
+}
+
+// batchContext 按 WithBatchOptions 组织写入上下文：超时、Settings 与 BlockBufferSize
+func batchContext(ctx context.Context, o WithBatchOptions) (context.Context, context.CancelFunc) {
+	if o.Timeout <= 0 {
+		o.Timeout = 2 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+
+	settings := clickhouse.Settings{}
+	for k, v := range o.Settings {
+		settings[k] = v
+	}
+	if o.AsyncInsert {
+		settings["async_insert"] = 1
+		if o.WaitAsyncInsert {
+			settings["wait_for_async_insert"] = 1
+		} else {
+			settings["wait_for_async_insert"] = 0
+		}
+	}
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(settings))
+	if o.BlockBufferSize > 0 {
+		ctx = clickhouse.Context(ctx, clickhouse.WithBlockBufferSize(o.BlockBufferSize))
+	}
+	return ctx, cancel
+}
+
+// columnFiller 从 n 行中按偏移读取某个字段，返回该列的切片
+type columnFiller func(base unsafe.Pointer, n int, stride, offset uintptr) any
+
+// fieldMapper 结构体字段到列的映射
+type fieldMapper struct {
+	name   string
+	typ    reflect.Type
+	offset uintptr // 相对结构体起始位置的偏移，已包含匿名结构体的偏移
+	fill   columnFiller
+}
+
+// structMapper 结构体类型到列的映射，按类型缓存
+type structMapper struct {
+	fields []fieldMapper
+}
+
+var structMappers sync.Map // reflect.Type -> *structMapper
+
+func mapperFor(t reflect.Type) (*structMapper, error) {
+	if m, ok := structMappers.Load(t); ok {
+		return m.(*structMapper), nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", t)
+	}
+	m := &structMapper{}
+	collectFields(t, 0, &m.fields)
+	if len(m.fields) == 0 {
+		return nil, fmt.Errorf("%s has no columns", t)
+	}
+	actual, _ := structMappers.LoadOrStore(t, m)
+	return actual.(*structMapper), nil
+}
+
+// collectFields 规则与 appendStructColumns 一致：ch tag 为列名，ch:"-" 与未导出字段忽略，没有tag的匿名结构体展开
+func collectFields(t reflect.Type, offset uintptr, fields *[]fieldMapper) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, tagged := f.Tag.Lookup("ch")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && !tagged && f.Type.Kind() == reflect.Struct {
+			collectFields(f.Type, offset+f.Offset, fields)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		*fields = append(*fields, fieldMapper{name: name, typ: f.Type, offset: offset + f.Offset, fill: fillerFor(f.Type)})
+	}
+}
+
+// fillerFor 常见类型使用泛型的直接拷贝，其余类型通过反射拷贝
+func fillerFor(t reflect.Type) columnFiller {
+	switch t {
+	case reflect.TypeOf(""):
+		return fillTyped[string]
+	case reflect.TypeOf(false):
+		return fillTyped[bool]
+	case reflect.TypeOf(int8(0)):
+		return fillTyped[int8]
+	case reflect.TypeOf(int16(0)):
+		return fillTyped[int16]
+	case reflect.TypeOf(int32(0)):
+		return fillTyped[int32]
+	case reflect.TypeOf(int64(0)):
+		return fillTyped[int64]
+	case reflect.TypeOf(uint8(0)):
+		return fillTyped[uint8]
+	case reflect.TypeOf(uint16(0)):
+		return fillTyped[uint16]
+	case reflect.TypeOf(uint32(0)):
+		return fillTyped[uint32]
+	case reflect.TypeOf(uint64(0)):
+		return fillTyped[uint64]
+	case reflect.TypeOf(float32(0)):
+		return fillTyped[float32]
+	case reflect.TypeOf(float64(0)):
+		return fillTyped[float64]
+	case timeType:
+		return fillTyped[time.Time]
+	case reflect.TypeOf([]string(nil)):
+		return fillTyped[[]string]
+	case reflect.TypeOf((*string)(nil)):
+		return fillTyped[*string]
+	}
+	return func(base unsafe.Pointer, n int, stride, offset uintptr) any {
+		col := reflect.MakeSlice(reflect.SliceOf(t), n, n)
+		for i := 0; i < n; i++ {
+			col.Index(i).Set(reflect.NewAt(t, unsafe.Add(base, uintptr(i)*stride+offset)).Elem())
+		}
+		return col.Interface()
+	}
+}
+
+func fillTyped[F any](base unsafe.Pointer, n int, stride, offset uintptr) any {
+	col := make([]F, n)
+	for i := range col {
+		col[i] = *(*F)(unsafe.Add(base, uintptr(i)*stride+offset))
+	}
+	return col
+}
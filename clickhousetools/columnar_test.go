@@ -0,0 +1,168 @@
+package clickhousetools
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/proto"
+)
+
+type columnarMeta struct {
+	Source string `ch:"source"`
+}
+
+type columnarRow struct {
+	columnarMeta
+	ID      uint64            `ch:"id"`
+	Name    string            `ch:"name"`
+	Score   float64           `ch:"score"`
+	At      time.Time         `ch:"at"`
+	Tags    []string          `ch:"tags"`
+	Note    *string           `ch:"note"`
+	Attrs   map[string]string `ch:"attrs"`
+	Skipped int               `ch:"-"`
+}
+
+func TestStructToColumns(t *testing.T) {
+	note := "n"
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := []columnarRow{
+		{columnarMeta: columnarMeta{Source: "a"}, ID: 1, Name: "x", Score: 1.5, At: at, Tags: []string{"t1"}, Note: &note, Attrs: map[string]string{"k": "v"}},
+		{columnarMeta: columnarMeta{Source: "b"}, ID: 2, Name: "y", Score: 2.5, At: at.Add(time.Hour)},
+	}
+
+	columns, err := StructToColumns(rows)
+	if err != nil {
+		t.Fatalf("struct to columns: %v", err)
+	}
+	want := []ColumnData{
+		{"source", []string{"a", "b"}},
+		{"id", []uint64{1, 2}},
+		{"name", []string{"x", "y"}},
+		{"score", []float64{1.5, 2.5}},
+		{"at", []time.Time{at, at.Add(time.Hour)}},
+		{"tags", [][]string{{"t1"}, nil}},
+		{"note", []*string{&note, nil}},
+		{"attrs", []map[string]string{{"k": "v"}, nil}},
+	}
+	if !reflect.DeepEqual(columns, want) {
+		t.Errorf("unexpected columns\n got %#v\nwant %#v", columns, want)
+	}
+
+	empty, err := StructToColumns([]columnarRow{})
+	if err != nil || len(empty) != len(want) {
+		t.Errorf("unexpected empty columns %v, %v", empty, err)
+	}
+	if _, err := StructToColumns([]int{1}); err == nil {
+		t.Error("expected error for non-struct rows")
+	}
+}
+
+// -------- 基准测试 --------
+
+type benchRow struct {
+	ID    uint64    `ch:"id"`
+	Name  string    `ch:"name"`
+	Value float64   `ch:"value"`
+	At    time.Time `ch:"at"`
+	Tags  []string  `ch:"tags"`
+}
+
+var benchColumnTypes = []struct{ name, typ string }{
+	{"id", "UInt64"}, {"name", "String"}, {"value", "Float64"}, {"at", "DateTime64(3)"}, {"tags", "Array(String)"},
+}
+
+func benchRows(n int) []benchRow {
+	rows := make([]benchRow, n)
+	now := time.Now()
+	for i := range rows {
+		rows[i] = benchRow{ID: uint64(i), Name: fmt.Sprintf("name-%d", i), Value: float64(i), At: now, Tags: []string{"a", "b"}}
+	}
+	return rows
+}
+
+func newBenchBlock(b *testing.B) *proto.Block {
+	block := proto.NewBlock()
+	for _, c := range benchColumnTypes {
+		if err := block.AddColumn(c.name, column.Type(c.typ)); err != nil {
+			b.Fatalf("add column: %v", err)
+		}
+	}
+	return block
+}
+
+// BenchmarkEncodeRows 模拟 AppendStruct 的行式路径：逐行反射取字段后追加到块
+// 真实的 AppendStruct 需要服务端连接，这里只比较客户端编码部分的开销
+func BenchmarkEncodeRows(b *testing.B) {
+	rows := benchRows(10000)
+	t := reflect.TypeOf(benchRow{})
+	index := make([][]int, t.NumField())
+	for i := range index {
+		index[i] = t.Field(i).Index
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		block := newBenchBlock(b)
+		for r := range rows {
+			v := reflect.ValueOf(&rows[r]).Elem()
+			values := make([]any, len(index))
+			for f, idx := range index {
+				values[f] = v.FieldByIndex(idx).Interface()
+			}
+			if err := block.Append(values...); err != nil {
+				b.Fatalf("append row: %v", err)
+			}
+		}
+	}
+}
+
+// BenchmarkEncodeColumns 列式路径：缓存的映射一次生成整列后追加到块
+func BenchmarkEncodeColumns(b *testing.B) {
+	rows := benchRows(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		block := newBenchBlock(b)
+		columns, err := StructToColumns(rows)
+		if err != nil {
+			b.Fatalf("struct to columns: %v", err)
+		}
+		for c, col := range columns {
+			if _, err := block.Columns[c].Append(col.Values); err != nil {
+				b.Fatalf("append column %s: %v", col.Name, err)
+			}
+		}
+	}
+}
+
+// BenchmarkInsert_Server 在本地 ClickHouse 上比较两种写入路径，没有服务时跳过
+func BenchmarkInsert_Server(b *testing.B) {
+	client, err := NewClickHouseClient(&ClickHouseConfig{Addresses: []string{"127.0.0.1:9000"}, Username: "default", Database: "test_db"})
+	if err != nil {
+		b.Skipf("clickhouse not available: %v", err)
+	}
+	defer client.Close()
+	if err := CreateTableFromStruct[benchRow](client, "bench_rows", EngineSpec{OrderBy: []string{"id"}}); err != nil {
+		b.Fatalf("create table: %v", err)
+	}
+	rows := benchRows(10000)
+
+	b.Run("AddData", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := AddData(client, "bench_rows", rows); err != nil {
+				b.Fatalf("add data: %v", err)
+			}
+		}
+	})
+	b.Run("AddDataColumnar", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := AddDataColumnar(client, "bench_rows", rows); err != nil {
+				b.Fatalf("add data columnar: %v", err)
+			}
+		}
+	})
+}
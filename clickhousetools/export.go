@@ -0,0 +1,410 @@
+package clickhousetools
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// -------- 导出 --------
+
+// ExportFormat 导出格式
+type ExportFormat string
+
+const (
+	ExportCSV                   ExportFormat = "CSV"                   // 带表头的CSV
+	ExportNDJSON                ExportFormat = "NDJSON"                // 每行一个JSON对象
+	ExportTabSeparated          ExportFormat = "TabSeparated"          // 与 ClickHouse TabSeparated 相同的转义规则
+	ExportTabSeparatedWithNames ExportFormat = "TabSeparatedWithNames" // 首行为列名的 TabSeparated
+)
+
+// ErrExportRowLimit 结果超过 MaxRows，已导出的内容在第 MaxRows 行处截断
+var ErrExportRowLimit = errors.New("export row limit exceeded")
+
+// ExportOptions Export 的可选配置
+type ExportOptions struct {
+	Args             []any            // 查询参数
+	MaxRows          int64            // 最多导出的行数，超过时返回 ErrExportRowLimit，0 表示不限制
+	Progress         func(rows int64) // 进度回调，参数为已导出的行数
+	ProgressInterval int64            // 每导出多少行回调一次，默认10000；导出结束时总会回调一次
+}
+
+// Export 执行查询并将结果流式写入 w，不在内存中保留结果集，返回导出的行数
+// Array、Map 等复合类型在 CSV 与 TabSeparated 中按 ClickHouse 文本格式输出，如 ['a','b'] 与 {'k':1}，NULL 输出为 \N
+// 示例：n, err := client.Export(ctx, "SELECT * FROM db.events WHERE day = ?", ExportCSV, file, ExportOptions{Args: []any{day}, MaxRows: 1e6})
+func (c *ClickHouseClient) Export(ctx context.Context, query string, format ExportFormat, w io.Writer, opts ...ExportOptions) (int64, error) {
+	var opt ExportOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	if opt.ProgressInterval <= 0 {
+		opt.ProgressInterval = 10000
+	}
+
+	bw := bufio.NewWriter(w)
+	enc, err := newRowEncoder(format, bw)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := c.Query(ctx, query, opt.Args...)
+	if err != nil {
+		return 0, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	columns := rows.ColumnTypes()
+	if err := enc.header(columns); err != nil {
+		return 0, err
+	}
+
+	dest := make([]any, len(columns))
+	for i, col := range columns {
+		dest[i] = reflect.New(col.ScanType()).Interface()
+	}
+	values := make([]reflect.Value, len(columns))
+
+	var n int64
+	for rows.Next() {
+		if opt.MaxRows > 0 && n >= opt.MaxRows {
+			err = ErrExportRowLimit
+			break
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return n, fmt.Errorf("scan row %d: %w", n+1, err)
+		}
+		for i := range dest {
+			values[i] = reflect.ValueOf(dest[i]).Elem()
+		}
+		if err := enc.row(columns, values); err != nil {
+			return n, fmt.Errorf("write row %d: %w", n+1, err)
+		}
+		n++
+		if opt.Progress != nil && n%opt.ProgressInterval == 0 {
+			opt.Progress(n)
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+
+	if flushErr := enc.flush(); flushErr != nil && err == nil {
+		err = flushErr
+	}
+	if flushErr := bw.Flush(); flushErr != nil && err == nil {
+		err = flushErr
+	}
+	if opt.Progress != nil && n%opt.ProgressInterval != 0 {
+		opt.Progress(n)
+	}
+	return n, err
+}
+
+// rowEncoder 按格式输出表头与行
+type rowEncoder interface {
+	header(columns []driver.ColumnType) error
+	row(columns []driver.ColumnType, values []reflect.Value) error
+	flush() error
+}
+
+func newRowEncoder(format ExportFormat, w *bufio.Writer) (rowEncoder, error) {
+	switch format {
+	case ExportCSV:
+		return &csvEncoder{w: csv.NewWriter(w)}, nil
+	case ExportNDJSON:
+		return &ndjsonEncoder{w: w}, nil
+	case ExportTabSeparated:
+		return &tsvEncoder{w: w}, nil
+	case ExportTabSeparatedWithNames:
+		return &tsvEncoder{w: w, withNames: true}, nil
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	record []string
+}
+
+func (e *csvEncoder) header(columns []driver.ColumnType) error {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name()
+	}
+	return e.w.Write(names)
+}
+
+func (e *csvEncoder) row(columns []driver.ColumnType, values []reflect.Value) error {
+	e.record = e.record[:0]
+	for i, v := range values {
+		e.record = append(e.record, formatText(v, columns[i].DatabaseTypeName(), false))
+	}
+	return e.w.Write(e.record)
+}
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type tsvEncoder struct {
+	w         *bufio.Writer
+	withNames bool
+}
+
+func (e *tsvEncoder) header(columns []driver.ColumnType) error {
+	if !e.withNames {
+		return nil
+	}
+	for i, col := range columns {
+		if i > 0 {
+			e.w.WriteByte('\t')
+		}
+		e.w.WriteString(escapeTSV(col.Name()))
+	}
+	return e.w.WriteByte('\n')
+}
+
+func (e *tsvEncoder) row(columns []driver.ColumnType, values []reflect.Value) error {
+	for i, v := range values {
+		if i > 0 {
+			e.w.WriteByte('\t')
+		}
+		if isNull(v) {
+			e.w.WriteString(nullText)
+			continue
+		}
+		e.w.WriteString(escapeTSV(formatText(v, columns[i].DatabaseTypeName(), false)))
+	}
+	return e.w.WriteByte('\n')
+}
+
+func (e *tsvEncoder) flush() error { return nil }
+
+type ndjsonEncoder struct {
+	w *bufio.Writer
+}
+
+func (e *ndjsonEncoder) header([]driver.ColumnType) error { return nil }
+
+func (e *ndjsonEncoder) row(columns []driver.ColumnType, values []reflect.Value) error {
+	e.w.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			e.w.WriteByte(',')
+		}
+		name, _ := json.Marshal(columns[i].Name())
+		e.w.Write(name)
+		e.w.WriteByte(':')
+		data, err := jsonValue(v, columns[i].DatabaseTypeName())
+		if err != nil {
+			return fmt.Errorf("column %s: %w", columns[i].Name(), err)
+		}
+		e.w.Write(data)
+	}
+	e.w.WriteString("}\n")
+	return nil
+}
+
+func (e *ndjsonEncoder) flush() error { return nil }
+
+// jsonValue 编码单个值；Map 的key不能直接作为JSON对象key时退回到文本格式
+func jsonValue(v reflect.Value, dbType string) ([]byte, error) {
+	switch {
+	case !v.IsValid():
+		return []byte("null"), nil
+	case (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil():
+		return []byte("null"), nil
+	case v.Kind() == reflect.Slice && v.IsNil():
+		return []byte("[]"), nil
+	case v.Kind() == reflect.Map && v.IsNil():
+		return []byte("{}"), nil
+	}
+	if f, ok := floatValue(v); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+		return json.Marshal(formatFloat(f, 64))
+	}
+	if t, ok := v.Interface().(time.Time); ok && isDateType(dbType) {
+		return json.Marshal(t.Format(time.DateOnly))
+	}
+	if elemType := innerType(dbType, "Array("); elemType != "" && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) {
+		// 逐个元素编码：Array(UInt8) 扫描为 []uint8，整体 json.Marshal 会输出 base64
+		data := []byte{'['}
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				data = append(data, ',')
+			}
+			elem, err := jsonValue(v.Index(i), elemType)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, elem...)
+		}
+		return append(data, ']'), nil
+	}
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return json.Marshal(formatText(v, dbType, false))
+	}
+	return data, nil
+}
+
+// nullText 文本格式中的 NULL
+const nullText = `\N`
+
+// formatText 按 ClickHouse 文本格式输出值；nested 为true时处于 Array/Map/Tuple 内，字符串与时间需加单引号
+func formatText(v reflect.Value, dbType string, nested bool) string {
+	if !v.IsValid() {
+		return textNull(nested)
+	}
+	if v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return textNull(nested)
+		}
+		return formatText(v.Elem(), dbType, nested)
+	}
+
+	if t, ok := v.Interface().(time.Time); ok {
+		s := formatTime(t, dbType)
+		if nested {
+			return quoteText(s)
+		}
+		return s
+	}
+	switch v.Kind() {
+	case reflect.String:
+		if nested {
+			return quoteText(v.String())
+		}
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return formatFloat(v.Float(), v.Type().Bits())
+	case reflect.Slice, reflect.Array:
+		elemType := innerType(dbType, "Array(")
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = formatText(v.Index(i), elemType, true)
+		}
+		if strings.HasPrefix(dbType, "Tuple(") {
+			return "(" + strings.Join(parts, ",") + ")"
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	case reflect.Map:
+		keys := v.MapKeys()
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = formatText(k, "", true) + ":" + formatText(v.MapIndex(k), "", true)
+		}
+		// Go 的 map 没有顺序，按文本排序保证输出稳定
+		sort.Strings(parts)
+		return "{" + strings.Join(parts, ",") + "}"
+	}
+
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		text := s.String()
+		if nested && !strings.HasPrefix(dbType, "Decimal") {
+			return quoteText(text)
+		}
+		return text
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// isNull 判断值是否为 NULL（nil 指针或接口），字符串 \N 不是 NULL
+func isNull(v reflect.Value) bool {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	return !v.IsValid()
+}
+
+func textNull(nested bool) string {
+	if nested {
+		return "NULL"
+	}
+	return nullText
+}
+
+// formatTime Date 类型只输出日期，DateTime 有小数秒时输出去掉末尾0的小数部分
+func formatTime(t time.Time, dbType string) string {
+	if isDateType(dbType) {
+		return t.Format(time.DateOnly)
+	}
+	if t.Nanosecond() == 0 {
+		return t.Format(time.DateTime)
+	}
+	return t.Format("2006-01-02 15:04:05.999999999")
+}
+
+func isDateType(dbType string) bool {
+	dbType = strings.TrimPrefix(strings.TrimPrefix(dbType, "Nullable("), "LowCardinality(")
+	return strings.HasPrefix(dbType, "Date") && !strings.HasPrefix(dbType, "DateTime")
+}
+
+// innerType 去掉外层类型，如 innerType("Array(Date)", "Array(") 返回 "Date"
+func innerType(dbType, prefix string) string {
+	if strings.HasPrefix(dbType, prefix) && strings.HasSuffix(dbType, ")") {
+		return dbType[len(prefix) : len(dbType)-1]
+	}
+	return ""
+}
+
+func floatValue(v reflect.Value) (float64, bool) {
+	if v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64 {
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// formatFloat 与 ClickHouse 一致输出 inf、-inf、nan
+func formatFloat(f float64, bitSize int) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', -1, bitSize)
+}
+
+// quoteText 复合类型内的字符串加单引号，转义 '\' 与 '\”
+func quoteText(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+var tsvEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"\t", `\t`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\x00", `\0`,
+	"\b", `\b`,
+	"\f", `\f`,
+)
+
+// escapeTSV 按 ClickHouse TabSeparated 规则转义字段
+func escapeTSV(s string) string {
+	return tsvEscaper.Replace(s)
+}
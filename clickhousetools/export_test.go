@@ -0,0 +1,187 @@
+package clickhousetools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+type fakeColumnType struct {
+	name, dbType string
+	scanType     reflect.Type
+}
+
+func (c fakeColumnType) Name() string             { return c.name }
+func (c fakeColumnType) Nullable() bool           { return strings.HasPrefix(c.dbType, "Nullable(") }
+func (c fakeColumnType) ScanType() reflect.Type   { return c.scanType }
+func (c fakeColumnType) DatabaseTypeName() string { return c.dbType }
+
+// exportRows 按列类型返回固定数据
+type exportRows struct {
+	driver.Rows
+	types []driver.ColumnType
+	data  [][]any
+	idx   int
+}
+
+func (r *exportRows) ColumnTypes() []driver.ColumnType { return r.types }
+func (r *exportRows) Next() bool                       { r.idx++; return r.idx <= len(r.data) }
+func (r *exportRows) Err() error                       { return nil }
+func (r *exportRows) Close() error                     { return nil }
+
+func (r *exportRows) Scan(dest ...any) error {
+	for i, d := range dest {
+		v := reflect.ValueOf(r.data[r.idx-1][i])
+		if !v.IsValid() {
+			v = reflect.Zero(reflect.TypeOf(d).Elem())
+		}
+		reflect.ValueOf(d).Elem().Set(v)
+	}
+	return nil
+}
+
+type exportConn struct {
+	driver.Conn
+	rows *exportRows
+}
+
+func (c *exportConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	c.rows.idx = 0
+	return c.rows, nil
+}
+
+func newExportClient() *ClickHouseClient {
+	note := "it's"
+	day := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+	rows := &exportRows{
+		types: []driver.ColumnType{
+			fakeColumnType{"id", "UInt64", reflect.TypeOf(uint64(0))},
+			fakeColumnType{"name", "String", reflect.TypeOf("")},
+			fakeColumnType{"tags", "Array(String)", reflect.TypeOf([]string(nil))},
+			fakeColumnType{"attrs", "Map(String, UInt8)", reflect.TypeOf(map[string]uint8(nil))},
+			fakeColumnType{"note", "Nullable(String)", reflect.TypeOf((*string)(nil))},
+			fakeColumnType{"day", "Date", reflect.TypeOf(time.Time{})},
+			fakeColumnType{"score", "Float64", reflect.TypeOf(float64(0))},
+		},
+		data: [][]any{
+			{uint64(1), "a,\"b\"\tc\nd", []string{"x", "y'z"}, map[string]uint8{"b": 2, "a": 1}, &note, day, 1.5},
+			{uint64(2), `back\slash`, []string{}, map[string]uint8{}, nil, day, math.Inf(1)},
+		},
+	}
+	return &ClickHouseClient{conn: &exportConn{rows: rows}}
+}
+
+func TestExport_CSV(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := newExportClient().Export(context.Background(), "SELECT", ExportCSV, &buf)
+	if err != nil || n != 2 {
+		t.Fatalf("export: n=%d err=%v", n, err)
+	}
+	want := "id,name,tags,attrs,note,day,score\n" +
+		"1,\"a,\"\"b\"\"\tc\nd\",\"['x','y\\'z']\",\"{'a':1,'b':2}\",it's,2024-05-06,1.5\n" +
+		"2,back\\slash,[],{},\\N,2024-05-06,inf\n"
+	if buf.String() != want {
+		t.Errorf("unexpected csv\n got %q\nwant %q", buf.String(), want)
+	}
+}
+
+func TestExport_TabSeparated(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := newExportClient().Export(context.Background(), "SELECT", ExportTabSeparatedWithNames, &buf); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if lines[0] != "id\tname\ttags\tattrs\tnote\tday\tscore" {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if want := "1\ta,\"b\"\\tc\\nd\t['x','y\\\\'z']\t{'a':1,'b':2}\tit's\t2024-05-06\t1.5"; lines[1] != want {
+		t.Errorf("unexpected row\n got %q\nwant %q", lines[1], want)
+	}
+	if want := "2\tback\\\\slash\t[]\t{}\t\\N\t2024-05-06\tinf"; lines[2] != want {
+		t.Errorf("unexpected row\n got %q\nwant %q", lines[2], want)
+	}
+}
+
+func TestExport_NDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := newExportClient().Export(context.Background(), "SELECT", ExportNDJSON, &buf); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want0 := `{"id":1,"name":"a,\"b\"\tc\nd","tags":["x","y'z"],"attrs":{"a":1,"b":2},"note":"it's","day":"2024-05-06","score":1.5}`
+	want1 := `{"id":2,"name":"back\\slash","tags":[],"attrs":{},"note":null,"day":"2024-05-06","score":"inf"}`
+	if len(lines) != 2 || lines[0] != want0 || lines[1] != want1 {
+		t.Errorf("unexpected ndjson\n got %q\nwant %q\n     %q", lines, want0, want1)
+	}
+}
+
+func TestExport_LimitAndProgress(t *testing.T) {
+	var buf bytes.Buffer
+	var progress []int64
+	n, err := newExportClient().Export(context.Background(), "SELECT", ExportTabSeparated, &buf, ExportOptions{
+		MaxRows:          1,
+		ProgressInterval: 1,
+		Progress:         func(rows int64) { progress = append(progress, rows) },
+	})
+	if !errors.Is(err, ErrExportRowLimit) || n != 1 {
+		t.Fatalf("expected row limit error after 1 row, got n=%d err=%v", n, err)
+	}
+	if strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("expected output truncated to 1 row, got %q", buf.String())
+	}
+	if len(progress) != 1 || progress[0] != 1 {
+		t.Errorf("unexpected progress calls %v", progress)
+	}
+
+	if _, err := newExportClient().Export(context.Background(), "SELECT", "Parquet", &buf); err == nil {
+		t.Error("expected unsupported format error")
+	}
+}
+
+// newSpecialExportClient 返回文本与 NULL 相同的字符串等容易混淆的值
+func newSpecialExportClient() *ClickHouseClient {
+	rows := &exportRows{
+		types: []driver.ColumnType{
+			fakeColumnType{"raw", "String", reflect.TypeOf("")},
+			fakeColumnType{"opt", "Nullable(String)", reflect.TypeOf((*string)(nil))},
+			fakeColumnType{"codes", "Array(UInt8)", reflect.TypeOf([]uint8(nil))},
+		},
+		data: [][]any{
+			{`\N`, nil, []uint8{1, 2, 3}},
+		},
+	}
+	return &ClickHouseClient{conn: &exportConn{rows: rows}}
+}
+
+func TestExport_SpecialValues(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := newSpecialExportClient().Export(context.Background(), "SELECT", ExportTabSeparated, &buf); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if want := "\\\\N\t\\N\t[1,2,3]\n"; buf.String() != want {
+		t.Errorf("unexpected tsv\n got %q\nwant %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if _, err := newSpecialExportClient().Export(context.Background(), "SELECT", ExportCSV, &buf); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if want := "raw,opt,codes\n\\N,\\N,\"[1,2,3]\"\n"; buf.String() != want {
+		t.Errorf("unexpected csv\n got %q\nwant %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if _, err := newSpecialExportClient().Export(context.Background(), "SELECT", ExportNDJSON, &buf); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if want := `{"raw":"\\N","opt":null,"codes":[1,2,3]}` + "\n"; buf.String() != want {
+		t.Errorf("unexpected ndjson\n got %q\nwant %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,389 @@
+package clickhousetools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// -------- 版本化迁移 --------
+
+// OnClusterPlaceholder 迁移SQL中的占位符，设置 Cluster 时替换为 "ON CLUSTER `cluster`"，否则替换为空
+// 示例：CREATE TABLE IF NOT EXISTS events ${ON_CLUSTER} (id UInt64) ENGINE = MergeTree ORDER BY id
+const OnClusterPlaceholder = "${ON_CLUSTER}"
+
+// tableAlreadyExistsCode ClickHouse TABLE_ALREADY_EXISTS 错误码
+const tableAlreadyExistsCode = 57
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(.+)\.sql$`)
+
+// Migration 一个迁移版本，可以包含多条以 ';' 分隔的语句
+type Migration struct {
+	Version  int64  // 版本号，按从小到大执行
+	Name     string // 描述，取自文件名
+	SQL      string // 迁移内容
+	Checksum string // SQL 的 sha256，已执行的迁移内容被修改时拒绝继续
+}
+
+// NewMigration 创建迁移并计算校验和
+func NewMigration(version int64, name, sql string) Migration {
+	sum := sha256.Sum256([]byte(sql))
+	return Migration{Version: version, Name: name, SQL: sql, Checksum: hex.EncodeToString(sum[:])}
+}
+
+// LoadMigrations 从 fsys 的 dir 目录加载迁移，文件名格式为 "<版本号>_<描述>.sql"，如 "0001_create_events.sql"
+// fsys 可以是 embed.FS，也可以用 os.DirFS 读取磁盘目录；其他文件被忽略
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations dir %s: %w", dir, err)
+	}
+
+	var migrations []Migration
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		m := migrationFileRe.FindStringSubmatch(e.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", e.Name(), err)
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", e.Name(), err)
+		}
+		migrations = append(migrations, NewMigration(version, m[2], string(content)))
+	}
+	return migrations, sortMigrations(migrations)
+}
+
+// sortMigrations 按版本排序并检查版本号重复
+func sortMigrations(migrations []Migration) error {
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return fmt.Errorf("duplicate migration version %d: %s and %s", migrations[i].Version, migrations[i-1].Name, migrations[i].Name)
+		}
+	}
+	return nil
+}
+
+// MigrateOptions 迁移选项
+type MigrateOptions struct {
+	Table            string        // 记录已执行版本的表，默认 "schema_migrations"
+	TableEngine      string        // 记录表与锁表的引擎，默认 "MergeTree"；集群部署时通常为 "ReplicatedMergeTree"
+	Cluster          string        // 非空时所有语句以 ON CLUSTER 执行，迁移SQL中使用 ${ON_CLUSTER} 占位
+	DryRun           bool          // 只返回待执行的迁移，不执行也不加锁
+	LockTTL          time.Duration // 锁超过该时间视为持有者已崩溃并被清除，默认15分钟
+	LockTimeout      time.Duration // 等待锁的最长时间，默认1分钟
+	StatementTimeout time.Duration // 单条语句超时，默认5分钟
+}
+
+func (o MigrateOptions) withDefaults() MigrateOptions {
+	if o.Table == "" {
+		o.Table = "schema_migrations"
+	}
+	if o.TableEngine == "" {
+		o.TableEngine = "MergeTree"
+	}
+	if o.LockTTL <= 0 {
+		o.LockTTL = 15 * time.Minute
+	}
+	if o.LockTimeout <= 0 {
+		o.LockTimeout = time.Minute
+	}
+	if o.StatementTimeout <= 0 {
+		o.StatementTimeout = 5 * time.Minute
+	}
+	return o
+}
+
+// onCluster 返回 ON CLUSTER 子句，未设置集群时为空
+func (o MigrateOptions) onCluster() string {
+	if o.Cluster == "" {
+		return ""
+	}
+	return " ON CLUSTER " + quoteName(o.Cluster)
+}
+
+// appliedMigration schema_migrations 中的一条记录
+type appliedMigration struct {
+	Version  int64  `ch:"version"`
+	Name     string `ch:"name"`
+	Checksum string `ch:"checksum"`
+}
+
+// Migrate 按版本顺序执行尚未执行的迁移，返回本次执行（DryRun 时为将要执行）的迁移
+// 执行前加锁防止多个实例同时迁移；已执行迁移的校验和与当前内容不一致时返回错误且不执行任何迁移
+// ClickHouse DDL 没有事务，迁移中途失败时已执行的语句不会回滚，该版本也不会被记录
+func (c *ClickHouseClient) Migrate(ctx context.Context, migrations []Migration, opts MigrateOptions) ([]Migration, error) {
+	opts = opts.withDefaults()
+	migrations = append([]Migration(nil), migrations...)
+	if err := sortMigrations(migrations); err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		applied, err := c.loadAppliedMigrations(ctx, opts, true)
+		if err != nil {
+			return nil, err
+		}
+		return planMigrations(migrations, applied)
+	}
+
+	if err := c.ensureMigrationsTable(ctx, opts); err != nil {
+		return nil, err
+	}
+	release, err := c.acquireMigrationLock(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	applied, err := c.loadAppliedMigrations(ctx, opts, false)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := planMigrations(migrations, applied)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, m := range pending {
+		if err := c.applyMigration(ctx, m, opts); err != nil {
+			return pending[:i], err
+		}
+	}
+	return pending, nil
+}
+
+// planMigrations 校验已执行迁移的校验和，返回待执行的迁移
+func planMigrations(migrations []Migration, applied map[int64]appliedMigration) ([]Migration, error) {
+	var pending []Migration
+	for _, m := range migrations {
+		a, ok := applied[m.Version]
+		if !ok {
+			pending = append(pending, m)
+			continue
+		}
+		if a.Checksum != m.Checksum {
+			return nil, fmt.Errorf("migration %d_%s was modified after being applied (checksum %s, applied %s)", m.Version, m.Name, m.Checksum, a.Checksum)
+		}
+	}
+	return pending, nil
+}
+
+// applyMigration 依次执行迁移中的语句并记录版本
+func (c *ClickHouseClient) applyMigration(ctx context.Context, m Migration, opts MigrateOptions) error {
+	sql := strings.ReplaceAll(m.SQL, OnClusterPlaceholder, opts.onCluster())
+	for i, stmt := range splitStatements(sql) {
+		if err := c.execMigration(ctx, opts, stmt); err != nil {
+			return fmt.Errorf("migration %d_%s statement #%d: %w", m.Version, m.Name, i+1, err)
+		}
+	}
+
+	record := fmt.Sprintf("INSERT INTO %s (version, name, checksum, applied_at) VALUES (?, ?, ?, now64(3))", quoteIdentifier(opts.Table))
+	if err := c.execMigration(ctx, opts, record, m.Version, m.Name, m.Checksum); err != nil {
+		return fmt.Errorf("record migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
+
+func (c *ClickHouseClient) execMigration(ctx context.Context, opts MigrateOptions, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, opts.StatementTimeout)
+	defer cancel()
+	return c.conn.Exec(ctx, query, args...)
+}
+
+// ensureMigrationsTable 创建记录已执行版本的表
+func (c *ClickHouseClient) ensureMigrationsTable(ctx context.Context, opts MigrateOptions) error {
+	ddl := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s%s (
+	version Int64,
+	name String,
+	checksum String,
+	applied_at DateTime64(3)
+) ENGINE = %s ORDER BY version`, quoteIdentifier(opts.Table), opts.onCluster(), opts.TableEngine)
+	if err := c.execMigration(ctx, opts, ddl); err != nil {
+		return fmt.Errorf("create migrations table %s: %w", opts.Table, err)
+	}
+	return nil
+}
+
+// loadAppliedMigrations 读取已执行的版本；allowMissing 为true时记录表不存在视为没有执行过
+func (c *ClickHouseClient) loadAppliedMigrations(ctx context.Context, opts MigrateOptions, allowMissing bool) (map[int64]appliedMigration, error) {
+	if allowMissing {
+		exists, err := c.tableExists(ctx, opts.Table)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return map[int64]appliedMigration{}, nil
+		}
+	}
+
+	rows, err := Select[appliedMigration](ctx, c, fmt.Sprintf("SELECT version, name, checksum FROM %s ORDER BY version", quoteIdentifier(opts.Table)))
+	if err != nil {
+		return nil, fmt.Errorf("load applied migrations: %w", err)
+	}
+	applied := make(map[int64]appliedMigration, len(rows))
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// systemTablesFilter 生成查询 system.tables 的条件，"db.table" 形式按指定库查询，否则查询当前库
+func systemTablesFilter(table string) (string, []any) {
+	if db, name, ok := strings.Cut(table, "."); ok {
+		return "database = ? AND name = ?", []any{db, name}
+	}
+	return "database = currentDatabase() AND name = ?", []any{table}
+}
+
+// tableExists 判断表是否存在，未指定库名时查询当前库
+func (c *ClickHouseClient) tableExists(ctx context.Context, table string) (bool, error) {
+	where, args := systemTablesFilter(table)
+	rows, err := c.conn.Query(ctx, "SELECT 1 FROM system.tables WHERE "+where, args...)
+	if err != nil {
+		return false, fmt.Errorf("check table %s: %w", table, err)
+	}
+	defer rows.Close()
+	exists := rows.Next()
+	return exists, rows.Err()
+}
+
+// acquireMigrationLock 以建表作为互斥锁：CREATE TABLE 在表已存在时失败，成功创建者持有锁
+// 锁表存在超过 LockTTL 视为持有者崩溃，删除后重新争抢
+func (c *ClickHouseClient) acquireMigrationLock(ctx context.Context, opts MigrateOptions) (func(), error) {
+	lockTable := opts.Table + "_lock"
+	create := fmt.Sprintf("CREATE TABLE %s%s (locked_at DateTime) ENGINE = %s ORDER BY locked_at",
+		quoteIdentifier(lockTable), opts.onCluster(), opts.TableEngine)
+	drop := fmt.Sprintf("DROP TABLE IF EXISTS %s%s SYNC", quoteIdentifier(lockTable), opts.onCluster())
+
+	deadline := time.Now().Add(opts.LockTimeout)
+	for {
+		err := c.execMigration(ctx, opts, create)
+		if err == nil {
+			return func() {
+				// 释放锁不受调用方 ctx 取消的影响
+				_ = c.execMigration(context.Background(), opts, drop)
+			}, nil
+		}
+		var exc *clickhouse.Exception
+		if !errors.As(err, &exc) || exc.Code != tableAlreadyExistsCode {
+			return nil, fmt.Errorf("acquire migration lock: %w", err)
+		}
+
+		age, err := c.lockAge(ctx, lockTable)
+		if err != nil {
+			return nil, err
+		}
+		if age > opts.LockTTL {
+			if err := c.execMigration(ctx, opts, drop); err != nil {
+				return nil, fmt.Errorf("remove stale migration lock: %w", err)
+			}
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("acquire migration lock: held by another process for %s", age)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// lockAge 按服务端时间计算锁表已存在的时长，避免客户端时钟偏差
+func (c *ClickHouseClient) lockAge(ctx context.Context, lockTable string) (time.Duration, error) {
+	where, args := systemTablesFilter(lockTable)
+	rows, err := c.conn.Query(ctx, "SELECT toInt64(now() - metadata_modification_time) FROM system.tables WHERE "+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("check migration lock: %w", err)
+	}
+	defer rows.Close()
+	var seconds int64
+	if rows.Next() {
+		if err := rows.Scan(&seconds); err != nil {
+			return 0, fmt.Errorf("check migration lock: %w", err)
+		}
+	}
+	return time.Duration(seconds) * time.Second, rows.Err()
+}
+
+// splitStatements 按 ';' 拆分SQL，忽略字符串、引号标识符与注释中的 ';'，丢弃空语句
+func splitStatements(sql string) []string {
+	var (
+		stmts   []string
+		cur     strings.Builder
+		quote   byte // 当前所在的引号，0 表示不在引号中
+		hasCode bool // 当前语句是否包含注释以外的内容
+	)
+	flush := func() {
+		if hasCode {
+			stmts = append(stmts, strings.TrimSpace(cur.String()))
+		}
+		cur.Reset()
+		hasCode = false
+	}
+
+	for i := 0; i < len(sql); i++ {
+		ch := sql[i]
+		switch {
+		case quote != 0:
+			cur.WriteByte(ch)
+			if ch == '\\' && i+1 < len(sql) {
+				i++
+				cur.WriteByte(sql[i])
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+			hasCode = true
+			cur.WriteByte(ch)
+		case ch == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			cur.WriteString(sql[i : i+end])
+			i += end - 1
+		case ch == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				end = len(sql) - i - 2
+			} else {
+				end += 2
+			}
+			cur.WriteString(sql[i : i+2+end])
+			i += 1 + end
+		case ch == ';':
+			flush()
+		default:
+			if ch != ' ' && ch != '\t' && ch != '\n' && ch != '\r' {
+				hasCode = true
+			}
+			cur.WriteByte(ch)
+		}
+	}
+	flush()
+	return stmts
+}
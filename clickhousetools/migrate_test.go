@@ -0,0 +1,105 @@
+package clickhousetools
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_index.sql":     {Data: []byte("ALTER TABLE events ADD INDEX idx name TYPE bloom_filter GRANULARITY 4")},
+		"migrations/0001_create_events.sql": {Data: []byte("CREATE TABLE events (id UInt64) ENGINE = MergeTree ORDER BY id")},
+		"migrations/README.md":              {Data: []byte("ignored")},
+	}
+	migrations, err := LoadMigrations(fsys, "migrations")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Name != "add_index" {
+		t.Fatalf("unexpected migrations %+v", migrations)
+	}
+	if len(migrations[0].Checksum) != 64 {
+		t.Errorf("unexpected checksum %q", migrations[0].Checksum)
+	}
+
+	fsys["migrations/01_dup.sql"] = &fstest.MapFile{Data: []byte("SELECT 1")}
+	if _, err := LoadMigrations(fsys, "migrations"); err == nil {
+		t.Error("expected duplicate version error")
+	}
+}
+
+func TestPlanMigrations(t *testing.T) {
+	m1 := NewMigration(1, "a", "SELECT 1")
+	m2 := NewMigration(2, "b", "SELECT 2")
+
+	pending, err := planMigrations([]Migration{m1, m2}, map[int64]appliedMigration{1: {Version: 1, Checksum: m1.Checksum}})
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Version != 2 {
+		t.Errorf("unexpected pending %+v", pending)
+	}
+
+	if _, err := planMigrations([]Migration{m1}, map[int64]appliedMigration{1: {Version: 1, Checksum: "changed"}}); err == nil {
+		t.Error("expected checksum mismatch error")
+	}
+}
+
+func TestMigrate_DryRun(t *testing.T) {
+	m1 := NewMigration(1, "a", "SELECT 1")
+	m2 := NewMigration(2, "b", "SELECT 2")
+	conn := &fakeConn{rows: []map[string]any{{"version": int64(1), "name": "a", "checksum": m1.Checksum}}}
+	c := &ClickHouseClient{conn: conn}
+
+	pending, err := c.Migrate(context.Background(), []Migration{m2, m1}, MigrateOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Version != 2 {
+		t.Errorf("unexpected pending %+v", pending)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	sql := `-- create table; with comment
+CREATE TABLE t (s String DEFAULT 'a;b') ENGINE = Memory;
+/* block; comment */
+INSERT INTO ` + "`we;ird`" + ` VALUES ('it\'s;');
+-- trailing comment only
+`
+	stmts := splitStatements(sql)
+	if len(stmts) != 2 {
+		t.Fatalf("expected 2 statements, got %d: %q", len(stmts), stmts)
+	}
+	if !strings.HasSuffix(stmts[0], "ENGINE = Memory") || !strings.HasSuffix(stmts[1], `VALUES ('it\'s;')`) {
+		t.Errorf("unexpected statements %q", stmts)
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	cases := map[string]string{
+		"events":      "`events`",
+		"db.events":   "`db`.`events`",
+		"we`ird":      "`we\\`ird`",
+		"schema_lock": "`schema_lock`",
+	}
+	for in, want := range cases {
+		if got := quoteIdentifier(in); got != want {
+			t.Errorf("quoteIdentifier(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestSystemTablesFilter(t *testing.T) {
+	where, args := systemTablesFilter("schema_migrations_lock")
+	if where != "database = currentDatabase() AND name = ?" || !reflect.DeepEqual(args, []any{"schema_migrations_lock"}) {
+		t.Errorf("unexpected filter %q %v", where, args)
+	}
+	where, args = systemTablesFilter("ops.schema_migrations_lock")
+	if where != "database = ? AND name = ?" || !reflect.DeepEqual(args, []any{"ops", "schema_migrations_lock"}) {
+		t.Errorf("unexpected filter %q %v", where, args)
+	}
+}
@@ -0,0 +1,144 @@
+package clickhousetools
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+// -------- 连接选项 --------
+
+var compressionMethods = map[string]clickhouse.CompressionMethod{
+	"none":    clickhouse.CompressionNone,
+	"lz4":     clickhouse.CompressionLZ4,
+	"zstd":    clickhouse.CompressionZSTD,
+	"gzip":    clickhouse.CompressionGZIP,
+	"deflate": clickhouse.CompressionDeflate,
+	"br":      clickhouse.CompressionBrotli,
+}
+
+var connOpenStrategies = map[string]clickhouse.ConnOpenStrategy{
+	"round_robin": clickhouse.ConnOpenRoundRobin,
+	"in_order":    clickhouse.ConnOpenInOrder,
+	"random":      clickhouse.ConnOpenRandom,
+}
+
+// buildOptions 将 ClickHouseConfig 转换为 clickhouse.Options，连接指向目标数据库
+func buildOptions(chc *ClickHouseConfig) (*clickhouse.Options, error) {
+	if len(chc.Addresses) == 0 {
+		return nil, fmt.Errorf("clickhouse addresses cannot be empty")
+	}
+
+	opts := &clickhouse.Options{
+		Protocol: clickhouse.Native,
+		Addr:     chc.Addresses,
+		Auth: clickhouse.Auth{
+			Username: chc.Username,
+			Password: chc.Password,
+			Database: chc.Database,
+		},
+		DialTimeout:          durationOr(chc.DialTimeout, 3*time.Second),
+		ReadTimeout:          durationOr(chc.ReadTimeout, 3*time.Minute),
+		MaxIdleConns:         intOr(chc.MaxIdleConns, 32),
+		MaxOpenConns:         intOr(chc.MaxOpenConns, 128),
+		ConnMaxLifetime:      durationOr(chc.ConnMaxLifetime, 25*time.Minute),
+		MaxCompressionBuffer: intOr(chc.MaxCompressionBuffer, 32<<20), //32MiB
+		BlockBufferSize:      chc.BlockBufferSize,
+		HttpUrlPath:          chc.HTTPPath,
+		FreeBufOnConnRelease: false,
+	}
+
+	tlsEnabled := chc.TLSEnabled
+	switch strings.ToLower(strings.TrimSpace(chc.Protocol)) {
+	case "", "native":
+	case "http":
+		opts.Protocol = clickhouse.HTTP
+	case "https":
+		opts.Protocol = clickhouse.HTTP
+		tlsEnabled = true
+	default:
+		return nil, fmt.Errorf("unsupported clickhouse protocol %q, expected native, http or https", chc.Protocol)
+	}
+
+	compression := strings.ToLower(strings.TrimSpace(chc.Compression))
+	if compression == "" {
+		compression = "lz4"
+	}
+	method, ok := compressionMethods[compression]
+	if !ok {
+		return nil, fmt.Errorf("unsupported clickhouse compression %q", chc.Compression)
+	}
+	if opts.Protocol == clickhouse.Native && compression != "none" && compression != "lz4" && compression != "zstd" {
+		return nil, fmt.Errorf("compression %s is only supported over http", compression)
+	}
+	opts.Compression = &clickhouse.Compression{Method: method, Level: chc.CompressionLevel}
+
+	strategy := strings.ToLower(strings.TrimSpace(chc.ConnOpenStrategy))
+	if strategy == "" {
+		strategy = "round_robin"
+	}
+	if opts.ConnOpenStrategy, ok = connOpenStrategies[strategy]; !ok {
+		return nil, fmt.Errorf("unsupported clickhouse conn open strategy %q, expected round_robin, in_order or random", chc.ConnOpenStrategy)
+	}
+
+	if tlsEnabled {
+		tlsConfig, err := buildTLSConfig(chc)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLS = tlsConfig
+	}
+	return opts, nil
+}
+
+// buildTLSConfig 根据 ClickHouseConfig 中的TLS选项构建 tls.Config
+func buildTLSConfig(chc *ClickHouseConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         chc.TLSServerName,
+		InsecureSkipVerify: chc.TLSInsecureSkipVerify, // 仅用于测试环境
+	}
+
+	if chc.TLSCAFile != "" {
+		caPEM, err := os.ReadFile(chc.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read tls ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("tls ca: no valid certificates found")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if chc.TLSCertFile != "" || chc.TLSKeyFile != "" {
+		if chc.TLSCertFile == "" || chc.TLSKeyFile == "" {
+			return nil, fmt.Errorf("tls client certificate and key must be provided together")
+		}
+		cert, err := tls.LoadX509KeyPair(chc.TLSCertFile, chc.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load tls client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func durationOr(v, def time.Duration) time.Duration {
+	if v > 0 {
+		return v
+	}
+	return def
+}
+
+func intOr(v, def int) int {
+	if v > 0 {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,97 @@
+package clickhousetools
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+)
+
+func TestBuildOptions_Defaults(t *testing.T) {
+	opts, err := buildOptions(&ClickHouseConfig{Addresses: []string{"127.0.0.1:9000"}, Database: "test_db"})
+	if err != nil {
+		t.Fatalf("build options: %v", err)
+	}
+	if opts.Protocol != clickhouse.Native || opts.Auth.Database != "test_db" {
+		t.Errorf("unexpected protocol %v or database %q", opts.Protocol, opts.Auth.Database)
+	}
+	if opts.Compression.Method != clickhouse.CompressionLZ4 || opts.ConnOpenStrategy != clickhouse.ConnOpenRoundRobin {
+		t.Errorf("unexpected compression %v or strategy %v", opts.Compression.Method, opts.ConnOpenStrategy)
+	}
+	if opts.MaxOpenConns != 128 || opts.MaxIdleConns != 32 || opts.DialTimeout != 3*time.Second || opts.ReadTimeout != 3*time.Minute {
+		t.Errorf("unexpected pool or timeout defaults %+v", opts)
+	}
+	if opts.TLS != nil {
+		t.Error("tls should be disabled by default")
+	}
+}
+
+func TestBuildOptions_Custom(t *testing.T) {
+	opts, err := buildOptions(&ClickHouseConfig{
+		Addresses:        []string{"ch:8443"},
+		Protocol:         "HTTPS",
+		HTTPPath:         "/clickhouse",
+		Compression:      "gzip",
+		CompressionLevel: 5,
+		MaxOpenConns:     8,
+		ConnOpenStrategy: "in_order",
+		TLSServerName:    "ch.internal",
+	})
+	if err != nil {
+		t.Fatalf("build options: %v", err)
+	}
+	if opts.Protocol != clickhouse.HTTP || opts.TLS == nil || opts.TLS.ServerName != "ch.internal" || opts.HttpUrlPath != "/clickhouse" {
+		t.Errorf("unexpected https options %+v", opts)
+	}
+	if opts.Compression.Method != clickhouse.CompressionGZIP || opts.Compression.Level != 5 {
+		t.Errorf("unexpected compression %+v", opts.Compression)
+	}
+	if opts.MaxOpenConns != 8 || opts.ConnOpenStrategy != clickhouse.ConnOpenInOrder {
+		t.Errorf("unexpected pool options %+v", opts)
+	}
+}
+
+func TestBuildOptions_Invalid(t *testing.T) {
+	cases := map[string]ClickHouseConfig{
+		"no address":          {},
+		"unknown protocol":    {Addresses: []string{"a"}, Protocol: "grpc"},
+		"gzip over native":    {Addresses: []string{"a"}, Compression: "gzip"},
+		"unknown compression": {Addresses: []string{"a"}, Compression: "snappy"},
+		"unknown strategy":    {Addresses: []string{"a"}, ConnOpenStrategy: "fastest"},
+		"cert without key":    {Addresses: []string{"a"}, TLSEnabled: true, TLSCertFile: "cert.pem"},
+		"missing ca file":     {Addresses: []string{"a"}, TLSEnabled: true, TLSCAFile: "/nonexistent/ca.pem"},
+	}
+	for name, cfg := range cases {
+		if _, err := buildOptions(&cfg); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestCreateDatabaseSQL(t *testing.T) {
+	if got := createDatabaseSQL("test_db", ""); got != "CREATE DATABASE IF NOT EXISTS `test_db`" {
+		t.Errorf("unexpected sql %q", got)
+	}
+	if got := createDatabaseSQL("bad`; DROP", "main"); got != "CREATE DATABASE IF NOT EXISTS `bad\\`; DROP` ON CLUSTER `main`" {
+		t.Errorf("unexpected sql %q", got)
+	}
+	if got := createDatabaseSQL("a.b", "dc.1"); got != "CREATE DATABASE IF NOT EXISTS `a.b` ON CLUSTER `dc.1`" {
+		t.Errorf("dotted names should be quoted as one identifier, got %q", got)
+	}
+}
+
+func TestIsUnknownDatabase(t *testing.T) {
+	if !isUnknownDatabase(&clickhouse.Exception{Code: 81, Message: "Database test_db does not exist"}) {
+		t.Error("expected native exception to match")
+	}
+	if !isUnknownDatabase(errString("sendQuery: [HTTP 404] response body: \"Code: 81. DB::Exception: Database x does not exist. (UNKNOWN_DATABASE)\"")) {
+		t.Error("expected http error to match")
+	}
+	if isUnknownDatabase(&clickhouse.Exception{Code: 516}) {
+		t.Error("authentication error should not match")
+	}
+}
+
+type errString string
+
+func (e errString) Error() string { return string(e) }
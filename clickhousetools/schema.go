@@ -0,0 +1,360 @@
+package clickhousetools
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// -------- 由结构体生成表结构 --------
+
+// EngineSpec 建表时的引擎与表级子句
+type EngineSpec struct {
+	Engine      string            // 表引擎，默认 "MergeTree()"
+	OrderBy     []string          // ORDER BY 列或表达式，为空时为 tuple()
+	PartitionBy string            // PARTITION BY 表达式，如 "toYYYYMM(created_at)"
+	PrimaryKey  []string          // PRIMARY KEY，为空时与 ORDER BY 一致
+	TTL         string            // 表级 TTL，如 "created_at + INTERVAL 30 DAY"
+	Settings    map[string]string // SETTINGS，如 {"index_granularity": "8192"}
+	Cluster     string            // 非空时以 ON CLUSTER 建表
+}
+
+// Column 由结构体字段推导出的列
+type Column struct {
+	Name string
+	Type string
+}
+
+// 结构体字段上控制列类型的tag
+//
+//	chtype:"Decimal(18, 4)"      直接指定列类型
+//	chddl:"lowcardinality"       String 列使用 LowCardinality
+//	chddl:"precision=6"          time.Time 列使用 DateTime64(6)，默认精度3
+//	chddl:"tz=Asia/Shanghai"     time.Time 列的时区
+const (
+	tagColumnType = "chtype"
+	tagColumnDDL  = "chddl"
+)
+
+// CreateTableFromStruct 根据 T 的 ch tag 生成 CREATE TABLE IF NOT EXISTS 并执行
+// 示例：CreateTableFromStruct[Event](client, "db.events", EngineSpec{OrderBy: []string{"id"}, PartitionBy: "toYYYYMM(created_at)"})
+func CreateTableFromStruct[T any](c *ClickHouseClient, table string, spec EngineSpec) error {
+	ddl, err := CreateTableSQL[T](table, spec)
+	if err != nil {
+		return err
+	}
+	if err := c.execWithTimeout(time.Minute, ddl); err != nil {
+		return fmt.Errorf("create table %s: %w", table, err)
+	}
+	return nil
+}
+
+// CreateTableSQL 根据 T 的 ch tag 生成 CREATE TABLE IF NOT EXISTS 语句
+func CreateTableSQL[T any](table string, spec EngineSpec) (string, error) {
+	if table == "" {
+		return "", fmt.Errorf("table cannot be empty")
+	}
+	columns, err := StructColumns[T]()
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("CREATE TABLE IF NOT EXISTS ")
+	b.WriteString(quoteIdentifier(table))
+	if spec.Cluster != "" {
+		b.WriteString(" ON CLUSTER ")
+		b.WriteString(quoteName(spec.Cluster))
+	}
+	b.WriteString("\n(\n")
+	for i, col := range columns {
+		b.WriteString("    ")
+		b.WriteString(quoteIdentifier(col.Name))
+		b.WriteString(" ")
+		b.WriteString(col.Type)
+		if i < len(columns)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(")\n")
+
+	engine := spec.Engine
+	if engine == "" {
+		engine = "MergeTree()"
+	}
+	b.WriteString("ENGINE = " + engine)
+	if spec.PartitionBy != "" {
+		b.WriteString("\nPARTITION BY " + spec.PartitionBy)
+	}
+	if len(spec.OrderBy) > 0 {
+		b.WriteString("\nORDER BY (" + strings.Join(spec.OrderBy, ", ") + ")")
+	} else {
+		b.WriteString("\nORDER BY tuple()")
+	}
+	if len(spec.PrimaryKey) > 0 {
+		b.WriteString("\nPRIMARY KEY (" + strings.Join(spec.PrimaryKey, ", ") + ")")
+	}
+	if spec.TTL != "" {
+		b.WriteString("\nTTL " + spec.TTL)
+	}
+	if len(spec.Settings) > 0 {
+		keys := make([]string, 0, len(spec.Settings))
+		for k := range spec.Settings {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		settings := make([]string, len(keys))
+		for i, k := range keys {
+			settings[i] = k + " = " + spec.Settings[k]
+		}
+		b.WriteString("\nSETTINGS " + strings.Join(settings, ", "))
+	}
+	return b.String(), nil
+}
+
+// StructColumns 按字段顺序返回 T 对应的列，规则与 AppendStruct 一致：
+// 列名取 ch tag，没有tag时取字段名；ch:"-" 与未导出字段被忽略；没有tag的匿名结构体字段被展开
+func StructColumns[T any]() ([]Column, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", t)
+	}
+	var columns []Column
+	if err := appendStructColumns(t, &columns); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("%s has no columns", t)
+	}
+	return columns, nil
+}
+
+func appendStructColumns(t reflect.Type, columns *[]Column) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, tagged := f.Tag.Lookup("ch")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && !tagged && f.Type.Kind() == reflect.Struct {
+			if err := appendStructColumns(f.Type, columns); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		colType := f.Tag.Get(tagColumnType)
+		if colType == "" {
+			var err error
+			colType, err = columnType(f.Type, parseDDLTag(f.Tag.Get(tagColumnDDL)))
+			if err != nil {
+				return fmt.Errorf("field %s: %w", f.Name, err)
+			}
+		}
+		*columns = append(*columns, Column{Name: name, Type: colType})
+	}
+	return nil
+}
+
+// ddlOptions chddl tag 中的选项
+type ddlOptions struct {
+	lowCardinality bool
+	precision      int
+	timezone       string
+}
+
+func parseDDLTag(tag string) ddlOptions {
+	opts := ddlOptions{precision: 3}
+	for _, part := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch strings.ToLower(key) {
+		case "lowcardinality":
+			opts.lowCardinality = true
+		case "precision":
+			if p, err := strconv.Atoi(value); err == nil {
+				opts.precision = p
+			}
+		case "tz":
+			opts.timezone = value
+		}
+	}
+	return opts
+}
+
+// columnType 将Go类型映射为ClickHouse类型：指针为 Nullable，切片为 Array，map 为 Map，time.Time 为 DateTime64
+func columnType(t reflect.Type, opts ddlOptions) (string, error) {
+	switch {
+	case t == timeType:
+		if opts.timezone != "" {
+			return fmt.Sprintf("DateTime64(%d, '%s')", opts.precision, strings.ReplaceAll(opts.timezone, "'", "\\'")), nil
+		}
+		return fmt.Sprintf("DateTime64(%d)", opts.precision), nil
+	case t.Name() == "UUID" && t.PkgPath() == "github.com/google/uuid":
+		return "UUID", nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		inner, err := columnType(t.Elem(), ddlOptions{precision: opts.precision, timezone: opts.timezone})
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(inner, "Array(") || strings.HasPrefix(inner, "Map(") {
+			return "", fmt.Errorf("%s cannot be Nullable", inner)
+		}
+		inner = "Nullable(" + inner + ")"
+		if opts.lowCardinality && t.Elem().Kind() == reflect.String {
+			return "LowCardinality(" + inner + ")", nil
+		}
+		return inner, nil
+	case reflect.String:
+		if opts.lowCardinality {
+			return "LowCardinality(String)", nil
+		}
+		return "String", nil
+	case reflect.Bool:
+		return "Bool", nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return fmt.Sprintf("Int%d", t.Bits()), nil
+	case reflect.Int:
+		return "Int64", nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprintf("UInt%d", t.Bits()), nil
+	case reflect.Uint:
+		return "UInt64", nil
+	case reflect.Float32, reflect.Float64:
+		return fmt.Sprintf("Float%d", t.Bits()), nil
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("FixedString(%d)", t.Len()), nil
+		}
+		fallthrough
+	case reflect.Slice:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return "String", nil
+		}
+		elem, err := columnType(t.Elem(), opts)
+		if err != nil {
+			return "", err
+		}
+		return "Array(" + elem + ")", nil
+	case reflect.Map:
+		key, err := columnType(t.Key(), opts)
+		if err != nil {
+			return "", err
+		}
+		value, err := columnType(t.Elem(), opts)
+		if err != nil {
+			return "", err
+		}
+		return "Map(" + key + ", " + value + ")", nil
+	}
+	return "", fmt.Errorf("unsupported type %s, use the %s tag to specify the column type", t, tagColumnType)
+}
+
+// SchemaDiff 结构体与线上表结构的差异
+type SchemaDiff struct {
+	Missing    []Column       // 结构体中有、表中没有的列
+	Mismatched []ColumnChange // 两边都有但类型不同的列
+	Extra      []Column       // 表中有、结构体中没有的列
+}
+
+// ColumnChange 类型不一致的列
+type ColumnChange struct {
+	Name     string
+	Expected string // 由结构体推导的类型
+	Actual   string // 线上表的类型
+}
+
+// Empty 是否没有差异
+func (d SchemaDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Mismatched) == 0 && len(d.Extra) == 0
+}
+
+// AddColumnsSQL 为缺失的列生成 ALTER TABLE ... ADD COLUMN 语句
+func (d SchemaDiff) AddColumnsSQL(table string) string {
+	if len(d.Missing) == 0 {
+		return ""
+	}
+	adds := make([]string, len(d.Missing))
+	for i, col := range d.Missing {
+		adds[i] = "ADD COLUMN IF NOT EXISTS " + quoteIdentifier(col.Name) + " " + col.Type
+	}
+	return "ALTER TABLE " + quoteIdentifier(table) + " " + strings.Join(adds, ", ")
+}
+
+// liveColumn system.columns 中的一列
+type liveColumn struct {
+	Name string `ch:"name"`
+	Type string `ch:"type"`
+}
+
+// DiffSchema 比较 T 推导出的列与线上表 system.columns 中的列
+// table 可以是 "db.table"，不带库名时使用当前库
+func DiffSchema[T any](ctx context.Context, c *ClickHouseClient, table string) (SchemaDiff, error) {
+	expected, err := StructColumns[T]()
+	if err != nil {
+		return SchemaDiff{}, err
+	}
+
+	query := "SELECT name, type FROM system.columns WHERE database = currentDatabase() AND table = ? ORDER BY position"
+	args := []any{table}
+	if db, name, ok := strings.Cut(table, "."); ok {
+		query = "SELECT name, type FROM system.columns WHERE database = ? AND table = ? ORDER BY position"
+		args = []any{db, name}
+	}
+	live, err := Select[liveColumn](ctx, c, query, args...)
+	if err != nil {
+		return SchemaDiff{}, fmt.Errorf("describe table %s: %w", table, err)
+	}
+	if len(live) == 0 {
+		return SchemaDiff{}, fmt.Errorf("table %s not found", table)
+	}
+
+	actual := make([]Column, len(live))
+	for i, col := range live {
+		actual[i] = Column(col)
+	}
+	return diffColumns(expected, actual), nil
+}
+
+// diffColumns 按列名比较，类型比较忽略空白差异
+func diffColumns(expected, actual []Column) SchemaDiff {
+	var diff SchemaDiff
+	actualTypes := make(map[string]string, len(actual))
+	for _, col := range actual {
+		actualTypes[col.Name] = col.Type
+	}
+	expectedNames := make(map[string]bool, len(expected))
+	for _, col := range expected {
+		expectedNames[col.Name] = true
+		typ, ok := actualTypes[col.Name]
+		switch {
+		case !ok:
+			diff.Missing = append(diff.Missing, col)
+		case normalizeType(typ) != normalizeType(col.Type):
+			diff.Mismatched = append(diff.Mismatched, ColumnChange{Name: col.Name, Expected: col.Type, Actual: typ})
+		}
+	}
+	for _, col := range actual {
+		if !expectedNames[col.Name] {
+			diff.Extra = append(diff.Extra, col)
+		}
+	}
+	return diff
+}
+
+func normalizeType(t string) string {
+	return strings.ReplaceAll(t, " ", "")
+}
@@ -0,0 +1,121 @@
+package clickhousetools
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaBase struct {
+	TenantID uint32 `ch:"tenant_id"`
+}
+
+type schemaEvent struct {
+	schemaBase
+	ID        uint64            `ch:"id"`
+	Kind      string            `ch:"kind" chddl:"lowcardinality"`
+	Note      *string           `ch:"note"`
+	Region    *string           `ch:"region" chddl:"lowcardinality"`
+	Score     float64           `ch:"score"`
+	Amount    string            `ch:"amount" chtype:"Decimal(18, 4)"`
+	Tags      []string          `ch:"tags"`
+	Attrs     map[string]int32  `ch:"attrs"`
+	Labels    map[string]string `ch:"labels" chddl:"lowcardinality"`
+	Hash      [16]byte          `ch:"hash"`
+	Payload   []byte            `ch:"payload"`
+	CreatedAt time.Time         `ch:"created_at" chddl:"precision=6,tz=UTC"`
+	UpdatedAt *time.Time        `ch:"updated_at"`
+	Ignored   string            `ch:"-"`
+	internal  string
+}
+
+func TestStructColumns(t *testing.T) {
+	columns, err := StructColumns[schemaEvent]()
+	if err != nil {
+		t.Fatalf("columns: %v", err)
+	}
+	want := []Column{
+		{"tenant_id", "UInt32"},
+		{"id", "UInt64"},
+		{"kind", "LowCardinality(String)"},
+		{"note", "Nullable(String)"},
+		{"region", "LowCardinality(Nullable(String))"},
+		{"score", "Float64"},
+		{"amount", "Decimal(18, 4)"},
+		{"tags", "Array(String)"},
+		{"attrs", "Map(String, Int32)"},
+		{"labels", "Map(LowCardinality(String), LowCardinality(String))"},
+		{"hash", "FixedString(16)"},
+		{"payload", "String"},
+		{"created_at", "DateTime64(6, 'UTC')"},
+		{"updated_at", "Nullable(DateTime64(3))"},
+	}
+	if len(columns) != len(want) {
+		t.Fatalf("expected %d columns, got %d: %+v", len(want), len(columns), columns)
+	}
+	for i := range want {
+		if columns[i] != want[i] {
+			t.Errorf("column %d = %+v, want %+v", i, columns[i], want[i])
+		}
+	}
+
+	type bad struct {
+		Ch chan int `ch:"ch"`
+	}
+	if _, err := StructColumns[bad](); err == nil {
+		t.Error("expected unsupported type error")
+	}
+	type nullableArray struct {
+		Tags *[]string `ch:"tags"`
+	}
+	if _, err := StructColumns[nullableArray](); err == nil {
+		t.Error("expected error for Nullable(Array)")
+	}
+}
+
+func TestCreateTableSQL(t *testing.T) {
+	ddl, err := CreateTableSQL[TestUser]("db.users", EngineSpec{
+		Engine:      "ReplacingMergeTree()",
+		OrderBy:     []string{"user_id"},
+		PartitionBy: "age",
+		TTL:         "toDateTime(0) + INTERVAL 1 DAY",
+		Settings:    map[string]string{"index_granularity": "8192"},
+		Cluster:     "main",
+	})
+	if err != nil {
+		t.Fatalf("create table sql: %v", err)
+	}
+	want := "CREATE TABLE IF NOT EXISTS `db`.`users` ON CLUSTER `main`\n(\n" +
+		"    `user_id` UInt64,\n    `username` String,\n    `email` String,\n    `age` UInt8,\n    `is_active` Bool\n)\n" +
+		"ENGINE = ReplacingMergeTree()\nPARTITION BY age\nORDER BY (user_id)\nTTL toDateTime(0) + INTERVAL 1 DAY\nSETTINGS index_granularity = 8192"
+	if ddl != want {
+		t.Errorf("unexpected ddl:\n%s\nwant:\n%s", ddl, want)
+	}
+
+	ddl, _ = CreateTableSQL[TestUser]("users", EngineSpec{})
+	if !strings.HasSuffix(ddl, "ENGINE = MergeTree()\nORDER BY tuple()") {
+		t.Errorf("unexpected default engine clause:\n%s", ddl)
+	}
+}
+
+func TestDiffColumns(t *testing.T) {
+	expected := []Column{{"id", "UInt64"}, {"name", "LowCardinality(String)"}, {"at", "DateTime64(3, 'UTC')"}, {"new_col", "String"}}
+	actual := []Column{{"id", "UInt64"}, {"name", "String"}, {"at", "DateTime64(3,'UTC')"}, {"old_col", "Int32"}}
+
+	diff := diffColumns(expected, actual)
+	if len(diff.Missing) != 1 || diff.Missing[0].Name != "new_col" {
+		t.Errorf("unexpected missing %+v", diff.Missing)
+	}
+	if len(diff.Mismatched) != 1 || diff.Mismatched[0].Name != "name" || diff.Mismatched[0].Actual != "String" {
+		t.Errorf("unexpected mismatched %+v", diff.Mismatched)
+	}
+	if len(diff.Extra) != 1 || diff.Extra[0].Name != "old_col" {
+		t.Errorf("unexpected extra %+v", diff.Extra)
+	}
+	if got := diff.AddColumnsSQL("db.t"); got != "ALTER TABLE `db`.`t` ADD COLUMN IF NOT EXISTS `new_col` String" {
+		t.Errorf("unexpected alter sql %q", got)
+	}
+	if diffColumns(expected, expected).Empty() != true {
+		t.Error("expected no diff for identical columns")
+	}
+}
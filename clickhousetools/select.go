@@ -0,0 +1,69 @@
+package clickhousetools
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// -------- 查询：类型化结果 --------
+
+// Select 执行查询并将全部结果扫描为 []T（按结构体字段的 ch tag 对齐列名）
+// 结果集较大时使用 QueryIter 逐行处理，避免一次性加载到内存
+// 示例：events, err := Select[Event](ctx, client, "SELECT id, name FROM db.events WHERE id > ?", 10)
+func Select[T any](ctx context.Context, c *ClickHouseClient, query string, args ...any) ([]T, error) {
+	var result []T
+	for row, err := range QueryIter[T](ctx, c, query, args...) {
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, nil
+}
+
+// QueryIter 执行查询并以迭代器逐行返回结果，每次只在内存中保留一行
+// 迭代按需从服务端拉取数据，调用方处理得慢时读取也随之变慢；提前 break 会关闭结果集
+// 出错时产出零值与错误后结束迭代
+// 示例：
+//
+//	for ev, err := range QueryIter[Event](ctx, client, "SELECT * FROM db.events") {
+//		if err != nil { return err }
+//		handle(ev)
+//	}
+func QueryIter[T any](ctx context.Context, c *ClickHouseClient, query string, args ...any) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		rows, err := c.Query(ctx, query, args...)
+		if err != nil {
+			yield(zero, fmt.Errorf("query: %w", err))
+			return
+		}
+		defer rows.Close()
+
+		if !scanRows(rows, yield) {
+			return
+		}
+		if err := rows.Err(); err != nil {
+			yield(zero, fmt.Errorf("read rows: %w", err))
+		}
+	}
+}
+
+// scanRows 将每一行扫描为 T 交给 yield，yield 返回false或扫描失败时返回false
+func scanRows[T any](rows driver.Rows, yield func(T, error) bool) bool {
+	for rows.Next() {
+		var row T
+		if err := rows.ScanStruct(&row); err != nil {
+			var zero T
+			yield(zero, fmt.Errorf("scan row: %w", err))
+			return false
+		}
+		if !yield(row, nil) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package clickhousetools
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+// fakeConn 只实现 Query，其余方法未实现
+type fakeConn struct {
+	driver.Conn
+	rows     []map[string]any
+	queryErr error
+	scanErr  error
+	closed   bool
+}
+
+func (f *fakeConn) Query(ctx context.Context, query string, args ...any) (driver.Rows, error) {
+	if f.queryErr != nil {
+		return nil, f.queryErr
+	}
+	return &fakeRows{conn: f, idx: -1}, nil
+}
+
+// fakeRows 按 ch tag 将 map 行写入结构体
+type fakeRows struct {
+	driver.Rows
+	conn *fakeConn
+	idx  int
+}
+
+func (r *fakeRows) Next() bool {
+	r.idx++
+	return r.idx < len(r.conn.rows)
+}
+
+func (r *fakeRows) ScanStruct(dest any) error {
+	if r.conn.scanErr != nil {
+		return r.conn.scanErr
+	}
+	v := reflect.ValueOf(dest).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if val, ok := r.conn.rows[r.idx][v.Type().Field(i).Tag.Get("ch")]; ok {
+			v.Field(i).Set(reflect.ValueOf(val))
+		}
+	}
+	return nil
+}
+
+func (r *fakeRows) Err() error { return nil }
+
+func (r *fakeRows) Close() error {
+	r.conn.closed = true
+	return nil
+}
+
+func TestSelect(t *testing.T) {
+	conn := &fakeConn{rows: []map[string]any{
+		{"user_id": uint64(1), "username": "alice"},
+		{"user_id": uint64(2), "username": "bob"},
+	}}
+	c := &ClickHouseClient{conn: conn}
+
+	users, err := Select[TestUser](context.Background(), c, "SELECT user_id, username FROM users")
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	if len(users) != 2 || users[0].UserID != 1 || users[1].Username != "bob" {
+		t.Errorf("unexpected users %+v", users)
+	}
+	if !conn.closed {
+		t.Error("rows not closed")
+	}
+
+	conn.scanErr = errors.New("type mismatch")
+	if _, err := Select[TestUser](context.Background(), c, "SELECT 1"); !errors.Is(err, conn.scanErr) {
+		t.Errorf("expected scan error, got %v", err)
+	}
+	conn.queryErr = errors.New("syntax error")
+	if _, err := Select[TestUser](context.Background(), c, "SELEC"); !errors.Is(err, conn.queryErr) {
+		t.Errorf("expected query error, got %v", err)
+	}
+}
+
+func TestQueryIter_Break(t *testing.T) {
+	conn := &fakeConn{rows: []map[string]any{
+		{"user_id": uint64(1)}, {"user_id": uint64(2)}, {"user_id": uint64(3)},
+	}}
+	c := &ClickHouseClient{conn: conn}
+
+	var seen []uint64
+	for u, err := range QueryIter[TestUser](context.Background(), c, "SELECT user_id FROM users") {
+		if err != nil {
+			t.Fatalf("iterate: %v", err)
+		}
+		seen = append(seen, u.UserID)
+		if u.UserID == 2 {
+			break
+		}
+	}
+	if len(seen) != 2 || !conn.closed {
+		t.Errorf("expected early stop with rows closed, seen %v closed %v", seen, conn.closed)
+	}
+}
@@ -0,0 +1,419 @@
+package clickhousetools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// -------- 写入失败落盘与重放 --------
+
+var ErrSpoolFull = errors.New("spool disk limit exceeded")
+
+const (
+	spoolSegmentExt = ".seg"
+	spoolCursorFile = "cursor"
+)
+
+// SpoolConfig 本地落盘配置
+type SpoolConfig struct {
+	Dir             string           // 段文件目录，不存在时自动创建
+	MaxBytes        int64            // 段文件总大小上限，超过后 Spill 返回 ErrSpoolFull，默认1GiB
+	SegmentMaxBytes int64            // 单个段文件大小上限，超过后切换到新文件，默认64MiB
+	ReplayInterval  time.Duration    // 重放失败或没有数据时的等待间隔，默认5秒
+	BatchOptions    WithBatchOptions // 重放写入时的选项
+}
+
+func (c SpoolConfig) withDefaults() SpoolConfig {
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = 1 << 30
+	}
+	if c.SegmentMaxBytes <= 0 {
+		c.SegmentMaxBytes = 64 << 20
+	}
+	if c.ReplayInterval <= 0 {
+		c.ReplayInterval = 5 * time.Second
+	}
+	return c
+}
+
+// SpoolStats 落盘与重放统计
+type SpoolStats struct {
+	Segments        int    // 当前段文件数
+	DiskBytes       int64  // 当前段文件总大小
+	SpilledBatches  uint64 // 已落盘的批次数
+	SpilledRows     uint64 // 已落盘的行数
+	ReplayedBatches uint64 // 已重放成功的批次数
+	ReplayedRows    uint64 // 已重放成功的行数
+	ReplayErrors    uint64 // 重放失败次数
+	Rejected        uint64 // 因超过磁盘上限被拒绝的批次数
+	Corrupt         uint64 // 无法解析而被跳过的记录数
+}
+
+// spoolRecord 段文件中的一条记录（一行JSON），对应一次失败的写入
+type spoolRecord[T any] struct {
+	Table     string    `json:"table"`
+	SpilledAt time.Time `json:"spilled_at"`
+	Rows      []T       `json:"rows"`
+}
+
+// Spool 写入失败时将批次以JSON追加到本地段文件，后台按落盘顺序重放
+// 行类型 T 需要能被 encoding/json 正确往返；重放为至少一次语义，进程崩溃后最后一批可能重复写入
+type Spool[T any] struct {
+	config  SpoolConfig
+	insert  func(ctx context.Context, table string, rows []T) error
+	healthy func(ctx context.Context) error
+
+	mu         sync.Mutex
+	segments   []string // 已关闭、等待重放的段文件名，按顺序
+	active     *os.File // 当前追加的段文件
+	activeName string
+	activeSize int64
+	diskBytes  int64
+	nextSeq    uint64
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	spilledBatches  atomic.Uint64
+	spilledRows     atomic.Uint64
+	replayedBatches atomic.Uint64
+	replayedRows    atomic.Uint64
+	replayErrors    atomic.Uint64
+	rejected        atomic.Uint64
+	corrupt         atomic.Uint64
+}
+
+// NewSpool 创建落盘队列并启动后台重放，目录中已有的段文件会先被重放；使用完毕调用 Close
+// 示例：
+//
+//	spool, _ := NewSpool[Event](client, SpoolConfig{Dir: "/var/lib/app/ch-spool"})
+//	err := spool.AddData("db.events", events)
+func NewSpool[T any](c *ClickHouseClient, config SpoolConfig) (*Spool[T], error) {
+	if c == nil {
+		return nil, fmt.Errorf("clickhouse client cannot be nil")
+	}
+	return newSpool(config,
+		func(ctx context.Context, table string, rows []T) error {
+			return addData(ctx, c, table, rows, config.BatchOptions)
+		},
+		func(ctx context.Context) error { return c.conn.Ping(ctx) },
+	)
+}
+
+func newSpool[T any](config SpoolConfig, insert func(ctx context.Context, table string, rows []T) error, healthy func(ctx context.Context) error) (*Spool[T], error) {
+	if config.Dir == "" {
+		return nil, fmt.Errorf("spool dir cannot be empty")
+	}
+	config = config.withDefaults()
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+
+	s := &Spool[T]{config: config, insert: insert, healthy: healthy, done: make(chan struct{})}
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.replayLoop(ctx)
+	return s, nil
+}
+
+// recover 加载目录中已有的段文件，按文件名（序号）排序
+func (s *Spool[T]) recover() error {
+	entries, err := os.ReadDir(s.config.Dir)
+	if err != nil {
+		return fmt.Errorf("read spool dir: %w", err)
+	}
+	for _, e := range entries {
+		seq, ok := parseSegmentName(e.Name())
+		if !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return fmt.Errorf("stat segment %s: %w", e.Name(), err)
+		}
+		s.segments = append(s.segments, e.Name())
+		s.diskBytes += info.Size()
+		s.nextSeq = max(s.nextSeq, seq+1)
+	}
+	sort.Strings(s.segments)
+	return nil
+}
+
+// AddData 写入 ClickHouse，失败时落盘等待重放；只有写入与落盘都失败时返回错误
+func (s *Spool[T]) AddData(table string, rows []T) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	insertErr := s.insert(context.Background(), table, rows)
+	if insertErr == nil {
+		return nil
+	}
+	if err := s.Spill(table, rows); err != nil {
+		return fmt.Errorf("insert failed (%v) and spill failed: %w", insertErr, err)
+	}
+	return nil
+}
+
+// Spill 将一批行追加到当前段文件并落盘（fsync）
+func (s *Spool[T]) Spill(table string, rows []T) error {
+	line, err := json.Marshal(spoolRecord[T]{Table: table, SpilledAt: time.Now(), Rows: rows})
+	if err != nil {
+		return fmt.Errorf("encode spool record: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.diskBytes+int64(len(line)) > s.config.MaxBytes {
+		s.rejected.Add(1)
+		return ErrSpoolFull
+	}
+	if s.active != nil && s.activeSize+int64(len(line)) > s.config.SegmentMaxBytes && s.activeSize > 0 {
+		if err := s.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	if s.active == nil {
+		if err := s.openSegmentLocked(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.active.Write(line)
+	s.activeSize += int64(n)
+	s.diskBytes += int64(n)
+	if err != nil {
+		return fmt.Errorf("write segment %s: %w", s.activeName, err)
+	}
+	if err := s.active.Sync(); err != nil {
+		return fmt.Errorf("sync segment %s: %w", s.activeName, err)
+	}
+	s.spilledBatches.Add(1)
+	s.spilledRows.Add(uint64(len(rows)))
+	return nil
+}
+
+// Stats 返回落盘与重放统计
+func (s *Spool[T]) Stats() SpoolStats {
+	s.mu.Lock()
+	segments := len(s.segments)
+	if s.active != nil {
+		segments++
+	}
+	diskBytes := s.diskBytes
+	s.mu.Unlock()
+
+	return SpoolStats{
+		Segments:        segments,
+		DiskBytes:       diskBytes,
+		SpilledBatches:  s.spilledBatches.Load(),
+		SpilledRows:     s.spilledRows.Load(),
+		ReplayedBatches: s.replayedBatches.Load(),
+		ReplayedRows:    s.replayedRows.Load(),
+		ReplayErrors:    s.replayErrors.Load(),
+		Rejected:        s.rejected.Load(),
+		Corrupt:         s.corrupt.Load(),
+	}
+}
+
+// Close 停止后台重放并关闭当前段文件，未重放的数据保留在磁盘上，下次 NewSpool 时继续
+func (s *Spool[T]) Close() error {
+	s.cancel()
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.active = nil
+	return err
+}
+
+func (s *Spool[T]) openSegmentLocked() error {
+	name := fmt.Sprintf("%020d%s", s.nextSeq, spoolSegmentExt)
+	f, err := os.OpenFile(filepath.Join(s.config.Dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("create segment %s: %w", name, err)
+	}
+	s.nextSeq++
+	s.active, s.activeName, s.activeSize = f, name, 0
+	return nil
+}
+
+// rotateLocked 关闭当前段文件，加入待重放队列
+func (s *Spool[T]) rotateLocked() error {
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.segments = append(s.segments, s.activeName)
+	s.active, s.activeName, s.activeSize = nil, "", 0
+	if err != nil {
+		return fmt.Errorf("close segment: %w", err)
+	}
+	return nil
+}
+
+// oldestSegment 返回最早的待重放段文件；没有已关闭的段文件时关闭当前段文件以便重放
+func (s *Spool[T]) oldestSegment() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.segments) == 0 && s.activeSize > 0 {
+		if err := s.rotateLocked(); err != nil {
+			return "", err
+		}
+	}
+	if len(s.segments) == 0 {
+		return "", nil
+	}
+	return s.segments[0], nil
+}
+
+// replayLoop 按顺序重放段文件，某一批写入失败时等待后从该批重试，不跳过
+func (s *Spool[T]) replayLoop(ctx context.Context) {
+	defer close(s.done)
+	for {
+		wait := s.config.ReplayInterval
+		name, err := s.oldestSegment()
+		if err == nil && name != "" {
+			if err = s.replaySegment(ctx, name); err == nil {
+				err = s.removeSegment(name)
+				wait = 0
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			s.replayErrors.Add(1)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// replaySegment 从游标位置开始逐条重放段文件中的记录，每成功一条推进游标
+func (s *Spool[T]) replaySegment(ctx context.Context, name string) error {
+	if err := s.healthy(ctx); err != nil {
+		return fmt.Errorf("clickhouse unhealthy: %w", err)
+	}
+
+	f, err := os.Open(filepath.Join(s.config.Dir, name))
+	if err != nil {
+		return fmt.Errorf("open segment %s: %w", name, err)
+	}
+	defer f.Close()
+
+	offset := s.readCursor(name)
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("seek segment %s: %w", name, err)
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) == 0 && errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("read segment %s: %w", name, err)
+		}
+		next := offset + int64(len(line))
+
+		var record spoolRecord[T]
+		if decodeErr := json.Unmarshal(line, &record); decodeErr != nil || errors.Is(err, io.EOF) {
+			// 无法解析或没有换行结尾（写入时崩溃）的记录无法重放，跳过
+			s.corrupt.Add(1)
+		} else if len(record.Rows) > 0 {
+			if err := s.insert(ctx, record.Table, record.Rows); err != nil {
+				return fmt.Errorf("replay %s@%d into %s: %w", name, offset, record.Table, err)
+			}
+			s.replayedBatches.Add(1)
+			s.replayedRows.Add(uint64(len(record.Rows)))
+		}
+
+		if err := s.writeCursor(name, next); err != nil {
+			return err
+		}
+		offset = next
+	}
+}
+
+// removeSegment 删除已重放完的段文件
+func (s *Spool[T]) removeSegment(name string) error {
+	path := filepath.Join(s.config.Dir, name)
+	info, statErr := os.Stat(path)
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("remove segment %s: %w", name, err)
+	}
+	_ = os.Remove(filepath.Join(s.config.Dir, spoolCursorFile))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.segments) > 0 && s.segments[0] == name {
+		s.segments = s.segments[1:]
+	}
+	if statErr == nil {
+		s.diskBytes -= info.Size()
+	}
+	return nil
+}
+
+// readCursor 读取段文件的重放进度，游标不属于该段文件时从头开始
+func (s *Spool[T]) readCursor(name string) int64 {
+	data, err := os.ReadFile(filepath.Join(s.config.Dir, spoolCursorFile))
+	if err != nil {
+		return 0
+	}
+	segment, offset, ok := strings.Cut(strings.TrimSpace(string(data)), " ")
+	if !ok || segment != name {
+		return 0
+	}
+	n, err := strconv.ParseInt(offset, 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// writeCursor 原子地保存重放进度
+func (s *Spool[T]) writeCursor(name string, offset int64) error {
+	path := filepath.Join(s.config.Dir, spoolCursorFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(name+" "+strconv.FormatInt(offset, 10)), 0o644); err != nil {
+		return fmt.Errorf("write spool cursor: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("write spool cursor: %w", err)
+	}
+	return nil
+}
+
+func parseSegmentName(name string) (uint64, bool) {
+	base, ok := strings.CutSuffix(name, spoolSegmentExt)
+	if !ok {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(base, 10, 64)
+	return seq, err == nil
+}
@@ -0,0 +1,150 @@
+package clickhousetools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer 模拟可以宕机的 ClickHouse
+type flakyServer struct {
+	down atomic.Bool
+	mu   sync.Mutex
+	rows []writerRow
+}
+
+func (f *flakyServer) insert(ctx context.Context, table string, rows []writerRow) error {
+	if f.down.Load() {
+		return errors.New("connection refused")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rows = append(f.rows, rows...)
+	return nil
+}
+
+func (f *flakyServer) ping(ctx context.Context) error {
+	if f.down.Load() {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (f *flakyServer) ids() []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ids := make([]int, len(f.rows))
+	for i, r := range f.rows {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSpool_SpillAndReplayInOrder(t *testing.T) {
+	server := &flakyServer{}
+	server.down.Store(true)
+	s, err := newSpool(SpoolConfig{Dir: t.TempDir(), SegmentMaxBytes: 100, ReplayInterval: 10 * time.Millisecond}, server.insert, server.ping)
+	if err != nil {
+		t.Fatalf("new spool: %v", err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := s.AddData("t", []writerRow{{ID: i, Name: "row"}}); err != nil {
+			t.Fatalf("add data: %v", err)
+		}
+	}
+	st := s.Stats()
+	if st.SpilledBatches != 5 || st.Segments < 2 || st.DiskBytes == 0 {
+		t.Fatalf("unexpected stats after spill %+v", st)
+	}
+
+	server.down.Store(false)
+	waitFor(t, func() bool { return s.Stats().ReplayedBatches == 5 })
+	ids := server.ids()
+	for i, id := range ids {
+		if id != i {
+			t.Fatalf("replayed out of order: %v", ids)
+		}
+	}
+	waitFor(t, func() bool { st := s.Stats(); return st.Segments == 0 && st.DiskBytes == 0 })
+}
+
+func TestSpool_ResumesFromCursorAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	server := &flakyServer{}
+	server.down.Store(true)
+	s, _ := newSpool(SpoolConfig{Dir: dir, ReplayInterval: time.Hour}, server.insert, server.ping)
+	_ = s.Spill("t", []writerRow{{ID: 1}})
+	_ = s.Spill("t", []writerRow{{ID: 2}})
+	_ = s.Close()
+
+	// 模拟第一条已经重放完成，并在文件末尾留下一条写了一半的记录
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	if len(segments) != 1 {
+		t.Fatalf("expected 1 segment, got %v", segments)
+	}
+	data, _ := os.ReadFile(segments[0])
+	first := 0
+	for data[first] != '\n' {
+		first++
+	}
+	f, _ := os.OpenFile(segments[0], os.O_APPEND|os.O_WRONLY, 0o644)
+	_, _ = f.WriteString(`{"table":"t","rows":[{"ID":3`)
+	_ = f.Close()
+	s2 := &Spool[writerRow]{config: SpoolConfig{Dir: dir}}
+	if err := s2.writeCursor(filepath.Base(segments[0]), int64(first+1)); err != nil {
+		t.Fatalf("write cursor: %v", err)
+	}
+
+	server.down.Store(false)
+	s, err := newSpool(SpoolConfig{Dir: dir, ReplayInterval: 10 * time.Millisecond}, server.insert, server.ping)
+	if err != nil {
+		t.Fatalf("reopen spool: %v", err)
+	}
+	defer s.Close()
+	waitFor(t, func() bool { return s.Stats().Segments == 0 })
+
+	if ids := server.ids(); len(ids) != 1 || ids[0] != 2 {
+		t.Errorf("expected only row 2 replayed, got %v", ids)
+	}
+	if st := s.Stats(); st.Corrupt != 1 {
+		t.Errorf("expected 1 corrupt record, got %+v", st)
+	}
+}
+
+func TestSpool_DiskLimit(t *testing.T) {
+	server := &flakyServer{}
+	server.down.Store(true)
+	s, _ := newSpool(SpoolConfig{Dir: t.TempDir(), MaxBytes: 120, ReplayInterval: time.Hour}, server.insert, server.ping)
+	defer s.Close()
+
+	if err := s.Spill("t", []writerRow{{ID: 1, Name: "first"}}); err != nil {
+		t.Fatalf("spill: %v", err)
+	}
+	if err := s.Spill("t", []writerRow{{ID: 2, Name: "second"}}); !errors.Is(err, ErrSpoolFull) {
+		t.Fatalf("expected ErrSpoolFull, got %v", err)
+	}
+	if err := s.AddData("t", []writerRow{{ID: 3}}); !errors.Is(err, ErrSpoolFull) {
+		t.Errorf("expected AddData to surface ErrSpoolFull, got %v", err)
+	}
+	if st := s.Stats(); st.Rejected != 2 {
+		t.Errorf("expected 2 rejected batches, got %+v", st)
+	}
+}
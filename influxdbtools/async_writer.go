@@ -0,0 +1,466 @@
+package influxdbtools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// -------- 写入：异步 AsyncWriter --------
+
+var (
+	ErrBufferFull   = errors.New("async writer buffer full, oldest lines dropped")
+	ErrWriterClosed = errors.New("async writer closed")
+)
+
+// AsyncWriterConfig AsyncWriter 配置，零值字段使用默认值
+type AsyncWriterConfig struct {
+	BatchSize        int                             // 单批最大行数，默认5000
+	FlushInterval    time.Duration                   // 最长刷新间隔，默认1秒
+	MaxBufferLines   int                             // 内存缓冲区最大行数（含等待重试的批次），默认 BatchSize*20，超出时丢弃最旧的行
+	MaxRetries       int                             // 单批写入失败后的重试次数，默认5，小于0表示不重试
+	RetryInterval    time.Duration                   // 首次重试等待时间，之后每次翻倍，默认1秒
+	MaxRetryInterval time.Duration                   // 重试等待时间上限，默认2分钟
+	WriteTimeout     time.Duration                   // 单次写入请求的超时，默认30秒
+	OnError          func(lines []string, err error) // 行最终未写入（重试失败、不可重试或被丢弃）时回调，回调中不要阻塞
+}
+
+func (c AsyncWriterConfig) withDefaults() AsyncWriterConfig {
+	if c.BatchSize <= 0 {
+		c.BatchSize = 5000
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = time.Second
+	}
+	if c.MaxBufferLines <= 0 {
+		c.MaxBufferLines = c.BatchSize * 20
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = 5
+	} else if c.MaxRetries < 0 {
+		c.MaxRetries = 0
+	}
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = time.Second
+	}
+	if c.MaxRetryInterval <= 0 {
+		c.MaxRetryInterval = 2 * time.Minute
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = 30 * time.Second
+	}
+	return c
+}
+
+// AsyncWriterStats AsyncWriter 运行统计
+type AsyncWriterStats struct {
+	Buffered uint64 // 当前缓冲的行数，含正在写入的批次
+	Written  uint64 // 已成功写入的行数
+	Dropped  uint64 // 因缓冲区写满被丢弃的行数
+	Failed   uint64 // 重试后仍写入失败或不可重试的行数
+	Retries  uint64 // 重试次数
+	Batches  uint64 // 成功写入的批次数
+}
+
+// flushWaiter Flush 调用方等待 target 之前入队的所有行处理完毕
+type flushWaiter struct {
+	target uint64
+	done   chan struct{}
+	err    error
+}
+
+// AsyncWriter 非阻塞写入器：行先进入内存缓冲区，由单个后台协程按批写入
+// 达到 BatchSize 或 FlushInterval 时刷新；失败的批次留在缓冲区头部按指数退避重试，
+// 期间新写入继续进入缓冲区，超过 MaxBufferLines 时丢弃最旧的行
+type AsyncWriter struct {
+	config    AsyncWriterConfig
+	precision time.Duration
+	write     func(ctx context.Context, lines []string) error
+
+	mu       sync.Mutex
+	lines    []string
+	seqs     []uint64 // 与 lines 一一对应的入队序号，用于判断 Flush 是否完成
+	inflight []uint64 // 正在写入的批次的序号
+	enqueued uint64   // 累计入队的行数，即下一行的序号
+	attempts int      // 缓冲区头部批次已失败的次数
+	waiters  []*flushWaiter
+	closed   bool
+	closeErr error
+
+	kick     chan struct{} // 缓冲区达到 BatchSize
+	flushNow chan struct{} // Flush 或 Close，立即写入全部行并跳过重试等待
+	done     chan struct{}
+	ctx      context.Context // Close 超时后取消，中止正在进行的写入与重试
+	cancel   context.CancelFunc
+
+	written atomic.Uint64
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+	retries atomic.Uint64
+	batches atomic.Uint64
+}
+
+// NewAsyncWriter 创建写入配置中 Bucket 的 AsyncWriter
+// 客户端 Close 时会刷新并关闭由它创建的所有 AsyncWriter
+// 示例：w := client.NewAsyncWriter(AsyncWriterConfig{BatchSize: 1000, OnError: logDropped})
+func (i *InfluxClient) NewAsyncWriter(config AsyncWriterConfig) *AsyncWriter {
+	precision := time.Nanosecond
+	if i.client != nil {
+		precision = i.client.Options().WriteOptions().Precision()
+	}
+	w := newAsyncWriter(config, precision, func(ctx context.Context, lines []string) error {
+		if i.writeAPI == nil {
+			return fmt.Errorf("influx write api not initialized")
+		}
+		return i.writeAPI.WriteRecord(ctx, lines...)
+	})
+
+	i.mu.Lock()
+	i.writers = append(i.writers, w)
+	i.mu.Unlock()
+	return w
+}
+
+func newAsyncWriter(config AsyncWriterConfig, precision time.Duration, write func(ctx context.Context, lines []string) error) *AsyncWriter {
+	w := &AsyncWriter{
+		config:    config.withDefaults(),
+		precision: precision,
+		write:     write,
+		kick:      make(chan struct{}, 1),
+		flushNow:  make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	go w.run()
+	return w
+}
+
+// WritePoint 将数据点编码为 Line Protocol 后加入缓冲区，不等待写入完成
+func (w *AsyncWriter) WritePoint(points ...*write.Point) error {
+	lines := make([]string, len(points))
+	for n, p := range points {
+		lines[n] = strings.TrimSuffix(write.PointToLineProtocol(p, w.precision), "\n")
+	}
+	return w.WriteRecord(lines...)
+}
+
+// WriteRecord 将 Line Protocol 行加入缓冲区，不等待写入完成
+// 缓冲区写满时丢弃最旧的行并通过 OnError 回调 ErrBufferFull；Close 之后返回 ErrWriterClosed
+func (w *AsyncWriter) WriteRecord(lines ...string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrWriterClosed
+	}
+	for _, line := range lines {
+		w.lines = append(w.lines, line)
+		w.seqs = append(w.seqs, w.enqueued)
+		w.enqueued++
+	}
+	dropped := w.trimLocked()
+	full := len(w.lines) >= w.config.BatchSize
+	w.mu.Unlock()
+
+	w.reportDropped(dropped)
+	if full {
+		signal(w.kick)
+	}
+	return nil
+}
+
+// Flush 立即写入调用前已缓冲的所有行，并等待它们处理完毕
+// 期间有行最终未写入时返回错误；ctx 到期时返回 ctx 的错误，缓冲的行仍会继续在后台写入
+func (w *AsyncWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	if w.pendingFromLocked() >= w.enqueued {
+		w.mu.Unlock()
+		return nil
+	}
+	waiter := &flushWaiter{target: w.enqueued, done: make(chan struct{})}
+	w.waiters = append(w.waiters, waiter)
+	w.mu.Unlock()
+	signal(w.flushNow)
+
+	select {
+	case <-waiter.done:
+		return waiter.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats 返回运行统计
+func (w *AsyncWriter) Stats() AsyncWriterStats {
+	w.mu.Lock()
+	buffered := len(w.lines) + len(w.inflight)
+	w.mu.Unlock()
+	return AsyncWriterStats{
+		Buffered: uint64(buffered),
+		Written:  w.written.Load(),
+		Dropped:  w.dropped.Load(),
+		Failed:   w.failed.Load(),
+		Retries:  w.retries.Load(),
+		Batches:  w.batches.Load(),
+	}
+}
+
+// Close 停止接收新行并写入缓冲区中剩余的所有行
+// ctx 到期时中止写入，未写入的行交给 OnError 并返回错误；关闭期间有行最终未写入时同样返回错误
+func (w *AsyncWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	alreadyClosed := w.closed
+	w.closed = true
+	w.mu.Unlock()
+	if !alreadyClosed {
+		signal(w.flushNow)
+	}
+
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		w.cancel()
+		<-w.done
+	}
+	w.cancel()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closeErr
+}
+
+// signal 非阻塞地发送通知
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// run 后台写入协程：kick 时只写完整批次，定时、Flush 或关闭时写入全部行
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		all := true
+		select {
+		case <-w.kick:
+			all = false
+		case <-w.flushNow:
+		case <-ticker.C:
+		}
+		if !w.drain(all) {
+			return
+		}
+	}
+}
+
+// drain 依次写入缓冲区中的批次，返回false表示已关闭且缓冲区已清空（或关闭超时）
+func (w *AsyncWriter) drain(all bool) bool {
+	for {
+		batch, closed := w.take(all)
+		if len(batch) == 0 {
+			return !closed
+		}
+
+		ctx, cancel := context.WithTimeout(w.ctx, w.config.WriteTimeout)
+		err := w.write(ctx, batch)
+		cancel()
+		if err == nil {
+			w.complete(nil)
+			w.written.Add(uint64(len(batch)))
+			w.batches.Add(1)
+			continue
+		}
+
+		if w.ctx.Err() != nil {
+			// Close 超时：剩余的行不再尝试写入
+			w.requeue(batch)
+			w.abandon()
+			return false
+		}
+		delay, retry := w.retryDelay(err)
+		if !retry {
+			w.fail(batch, fmt.Errorf("write %d lines: %w", len(batch), err))
+			continue
+		}
+
+		w.retries.Add(1)
+		w.requeue(batch)
+		select {
+		case <-w.ctx.Done():
+			w.abandon()
+			return false
+		case <-w.flushNow:
+		case <-time.After(delay):
+		}
+		// 等待重试期间可能又有新行进入，重试时一并写入
+		all = true
+	}
+}
+
+// take 从缓冲区头部取出不超过 BatchSize 的行，行在处理完毕前仍计入未完成
+// all 为false时只取完整批次；关闭后总是取出剩余的行
+func (w *AsyncWriter) take(all bool) ([]string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	all = all || w.closed
+	if len(w.lines) == 0 || (!all && len(w.lines) < w.config.BatchSize) {
+		return nil, w.closed
+	}
+	batch, seqs := w.popLocked(min(len(w.lines), w.config.BatchSize))
+	w.inflight = seqs
+	return batch, w.closed
+}
+
+// requeue 将写入失败的批次放回缓冲区头部，超出 MaxBufferLines 的部分从最旧的行开始丢弃
+func (w *AsyncWriter) requeue(batch []string) {
+	w.mu.Lock()
+	w.attempts++
+	w.lines = append(batch[:len(batch):len(batch)], w.lines...)
+	w.seqs = append(w.inflight[:len(w.inflight):len(w.inflight)], w.seqs...)
+	w.inflight = nil
+	dropped := w.trimLocked()
+	w.mu.Unlock()
+
+	w.reportDropped(dropped)
+}
+
+// trimLocked 缓冲区与正在写入的批次合计超过 MaxBufferLines 时，从缓冲区头部丢弃最旧的行，调用方需持有锁
+func (w *AsyncWriter) trimLocked() []string {
+	over := len(w.lines) + len(w.inflight) - w.config.MaxBufferLines
+	if over <= 0 {
+		return nil
+	}
+	dropped, seqs := w.popLocked(min(over, len(w.lines)))
+	w.dropped.Add(uint64(len(dropped)))
+	w.notifyLocked(seqs[0], ErrBufferFull)
+	return dropped
+}
+
+func (w *AsyncWriter) reportDropped(dropped []string) {
+	if len(dropped) > 0 && w.config.OnError != nil {
+		w.config.OnError(dropped, ErrBufferFull)
+	}
+}
+
+// retryDelay 判断错误是否可重试并计算等待时间
+// 网络错误、429 与 5xx 可重试，其余 4xx（如 Line Protocol 解析失败）重试也不会成功
+func (w *AsyncWriter) retryDelay(err error) (time.Duration, bool) {
+	w.mu.Lock()
+	attempts := w.attempts
+	w.mu.Unlock()
+	if attempts >= w.config.MaxRetries {
+		return 0, false
+	}
+
+	var retryAfter time.Duration
+	var herr *http2.Error
+	if errors.As(err, &herr) {
+		if herr.StatusCode != 0 && herr.StatusCode != 429 && herr.StatusCode < 500 {
+			return 0, false
+		}
+		retryAfter = time.Duration(herr.RetryAfter) * time.Second
+	}
+
+	delay := w.config.RetryInterval
+	for n := 0; n < attempts && delay < w.config.MaxRetryInterval; n++ {
+		delay *= 2
+	}
+	delay = min(delay, w.config.MaxRetryInterval)
+	return max(delay, retryAfter), true
+}
+
+// complete 正在写入的批次处理完毕，err 不为空表示这些行最终未写入
+func (w *AsyncWriter) complete(err error) {
+	w.mu.Lock()
+	w.attempts = 0
+	first := w.enqueued
+	if len(w.inflight) > 0 {
+		first = w.inflight[0]
+	}
+	w.inflight = nil
+	w.notifyLocked(first, err)
+	w.mu.Unlock()
+}
+
+// fail 正在写入的批次（或 abandon 取出的行）最终写入失败
+func (w *AsyncWriter) fail(batch []string, err error) {
+	w.complete(err)
+	w.failed.Add(uint64(len(batch)))
+	if w.config.OnError != nil {
+		w.config.OnError(batch, err)
+	}
+	w.mu.Lock()
+	if w.closed {
+		w.closeErr = errors.Join(w.closeErr, err)
+	}
+	w.mu.Unlock()
+}
+
+// abandon 取出缓冲区中剩余的行并按失败处理
+func (w *AsyncWriter) abandon() {
+	w.mu.Lock()
+	lines, seqs := w.popLocked(len(w.lines))
+	w.inflight = seqs
+	w.mu.Unlock()
+	if len(lines) == 0 {
+		return
+	}
+	w.fail(lines, fmt.Errorf("%d lines not written before close: %w", len(lines), w.ctx.Err()))
+}
+
+// popLocked 从缓冲区头部取出 n 行及其序号，调用方需持有锁
+func (w *AsyncWriter) popLocked(n int) ([]string, []uint64) {
+	lines := make([]string, n)
+	copy(lines, w.lines[:n])
+	clear(w.lines[:n])
+	seqs := make([]uint64, n)
+	copy(seqs, w.seqs[:n])
+	w.lines, w.seqs = w.lines[n:], w.seqs[n:]
+	return lines, seqs
+}
+
+// pendingFromLocked 返回尚未处理完毕的最小序号，没有时返回 enqueued，调用方需持有锁
+// 正在写入的批次总是早于缓冲区中的行
+func (w *AsyncWriter) pendingFromLocked() uint64 {
+	switch {
+	case len(w.inflight) > 0:
+		return w.inflight[0]
+	case len(w.seqs) > 0:
+		return w.seqs[0]
+	}
+	return w.enqueued
+}
+
+// notifyLocked 有行处理完毕后唤醒已满足的 Flush，调用方需持有锁
+// err 不为空时记录到包含序号 first 的所有 Flush
+func (w *AsyncWriter) notifyLocked(first uint64, err error) {
+	pending := w.pendingFromLocked()
+	waiters := w.waiters[:0]
+	for _, waiter := range w.waiters {
+		if err != nil && waiter.err == nil && first < waiter.target {
+			waiter.err = err
+		}
+		if waiter.target <= pending {
+			close(waiter.done)
+			continue
+		}
+		waiters = append(waiters, waiter)
+	}
+	clear(w.waiters[len(waiters):])
+	w.waiters = waiters
+}
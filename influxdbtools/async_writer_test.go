@@ -0,0 +1,220 @@
+package influxdbtools
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// recordingSink 记录写入的批次，可按顺序返回预设的错误
+type recordingSink struct {
+	mu      sync.Mutex
+	batches [][]string
+	errs    []error
+}
+
+func (s *recordingSink) write(ctx context.Context, lines []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	s.batches = append(s.batches, append([]string(nil), lines...))
+	return nil
+}
+
+func (s *recordingSink) lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var all []string
+	for _, b := range s.batches {
+		all = append(all, b...)
+	}
+	return all
+}
+
+func TestAsyncWriter_BatchesBySize(t *testing.T) {
+	sink := &recordingSink{}
+	w := newAsyncWriter(AsyncWriterConfig{BatchSize: 2, FlushInterval: time.Hour}, time.Nanosecond, sink.write)
+
+	p := write.NewPoint("cpu", map[string]string{"host": "a b"}, map[string]interface{}{"v": int64(1)}, time.Unix(0, 42))
+	if err := w.WritePoint(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRecord("cpu v=2i", "cpu v=3i"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	want := []string{`cpu,host=a\ b v=1i 42`, "cpu v=2i", "cpu v=3i"}
+	if got := sink.lines(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected lines %q", got)
+	}
+	if len(sink.batches) != 2 {
+		t.Errorf("expected 2 batches, got %d", len(sink.batches))
+	}
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRecord("late v=1"); !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("expected ErrWriterClosed, got %v", err)
+	}
+}
+
+func TestAsyncWriter_FlushInterval(t *testing.T) {
+	sink := &recordingSink{}
+	w := newAsyncWriter(AsyncWriterConfig{BatchSize: 100, FlushInterval: 10 * time.Millisecond}, time.Nanosecond, sink.write)
+	defer w.Close(context.Background())
+
+	_ = w.WriteRecord("m v=1")
+	deadline := time.Now().Add(time.Second)
+	for len(sink.lines()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(sink.lines()) != 1 {
+		t.Fatal("expected partial batch to be written on interval")
+	}
+}
+
+func TestAsyncWriter_RetriesWithBackoff(t *testing.T) {
+	sink := &recordingSink{errs: []error{
+		&http2.Error{StatusCode: 503},
+		&http2.Error{StatusCode: 0, Err: errors.New("connection refused")},
+	}}
+	w := newAsyncWriter(AsyncWriterConfig{
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+		RetryInterval: time.Millisecond,
+	}, time.Nanosecond, sink.write)
+
+	_ = w.WriteRecord("m v=1", "m v=2")
+	if err := w.Flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if got := sink.lines(); len(got) != 2 {
+		t.Fatalf("expected lines written after retries, got %q", got)
+	}
+	if s := w.Stats(); s.Retries != 2 || s.Written != 2 || s.Batches != 1 || s.Buffered != 0 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	_ = w.Close(context.Background())
+}
+
+func TestAsyncWriter_NonRetryableAndExhausted(t *testing.T) {
+	var mu sync.Mutex
+	var failed []string
+	sink := &recordingSink{errs: []error{
+		&http2.Error{StatusCode: 400, Code: "invalid", Message: "unable to parse"},
+		errors.New("timeout"), errors.New("timeout"),
+	}}
+	w := newAsyncWriter(AsyncWriterConfig{
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+		MaxRetries:    1,
+		RetryInterval: time.Millisecond,
+		OnError: func(lines []string, err error) {
+			mu.Lock()
+			failed = append(failed, lines...)
+			mu.Unlock()
+		},
+	}, time.Nanosecond, sink.write)
+
+	_ = w.WriteRecord("bad", "slow", "good")
+	if err := w.Flush(context.Background()); err == nil {
+		t.Fatal("expected flush to report failed lines")
+	}
+	if got := sink.lines(); len(got) != 1 || got[0] != "good" {
+		t.Errorf("unexpected written lines %q", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(failed, ",") != "bad,slow" {
+		t.Errorf("unexpected failed lines %q", failed)
+	}
+	if s := w.Stats(); s.Failed != 2 || s.Retries != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	_ = w.Close(context.Background())
+}
+
+func TestAsyncWriter_DropsOldestWhenFull(t *testing.T) {
+	block := make(chan struct{})
+	var once sync.Once
+	started := make(chan struct{})
+	sink := &recordingSink{}
+	var dropped []string
+	w := newAsyncWriter(AsyncWriterConfig{
+		BatchSize:      2,
+		MaxBufferLines: 4,
+		FlushInterval:  time.Hour,
+		OnError: func(lines []string, err error) {
+			if errors.Is(err, ErrBufferFull) {
+				dropped = append(dropped, lines...)
+			}
+		},
+	}, time.Nanosecond, func(ctx context.Context, lines []string) error {
+		once.Do(func() { close(started) })
+		<-block
+		return sink.write(ctx, lines)
+	})
+
+	_ = w.WriteRecord("1", "2")
+	<-started
+	// 1、2 正在写入，缓冲区只剩2行空间
+	_ = w.WriteRecord("3", "4", "5")
+	if strings.Join(dropped, ",") != "3" {
+		t.Errorf("expected oldest buffered line dropped, got %q", dropped)
+	}
+	close(block)
+	if err := w.Flush(context.Background()); err != nil {
+		t.Errorf("flush: %v", err)
+	}
+	if got := strings.Join(sink.lines(), ","); got != "1,2,4,5" {
+		t.Errorf("unexpected written lines %q", got)
+	}
+	if s := w.Stats(); s.Dropped != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	_ = w.Close(context.Background())
+}
+
+func TestAsyncWriter_FlushContext(t *testing.T) {
+	sink := &recordingSink{errs: []error{errors.New("down"), errors.New("down"), errors.New("down")}}
+	var failed []string
+	w := newAsyncWriter(AsyncWriterConfig{
+		BatchSize:     10,
+		FlushInterval: time.Hour,
+		MaxRetries:    10,
+		RetryInterval: time.Hour,
+		OnError:       func(lines []string, err error) { failed = lines },
+	}, time.Nanosecond, sink.write)
+
+	_ = w.WriteRecord("m v=1")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	// Flush 会跳过一次重试等待，随后在一小时的退避中等待到 ctx 到期
+	if err := w.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelClose()
+	if err := w.Close(closeCtx); err == nil {
+		t.Fatal("expected close to report unwritten lines")
+	}
+	if len(failed) != 1 {
+		t.Errorf("expected unwritten line passed to OnError, got %q", failed)
+	}
+}
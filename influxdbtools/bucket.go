@@ -0,0 +1,244 @@
+package influxdbtools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	influxapi "github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+)
+
+// -------- Bucket 管理 --------
+
+// BucketSpec Bucket 定义
+type BucketSpec struct {
+	Name               string
+	Description        string
+	Retention          time.Duration // 数据保留时长，0表示永久保留；精度为秒
+	ShardGroupDuration time.Duration // 分片组时长，0表示使用服务端默认值（Cloud 不支持）
+}
+
+// BucketInfo Bucket 信息
+type BucketInfo struct {
+	ID                 string
+	Name               string
+	Description        string
+	Retention          time.Duration // 0表示永久保留
+	ShardGroupDuration time.Duration
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+func (s BucketSpec) validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("bucket name cannot be empty")
+	}
+	if s.Retention < 0 || s.Retention%time.Second != 0 {
+		return fmt.Errorf("bucket %s: retention must be a non-negative whole number of seconds, got %s", s.Name, s.Retention)
+	}
+	if s.ShardGroupDuration < 0 || s.ShardGroupDuration%time.Second != 0 {
+		return fmt.Errorf("bucket %s: shard group duration must be a non-negative whole number of seconds, got %s", s.Name, s.ShardGroupDuration)
+	}
+	return nil
+}
+
+func (s BucketSpec) retentionRules() domain.RetentionRules {
+	expire := domain.RetentionRuleTypeExpire
+	rule := domain.RetentionRule{EverySeconds: int64(s.Retention / time.Second), Type: &expire}
+	if s.ShardGroupDuration > 0 {
+		shard := int64(s.ShardGroupDuration / time.Second)
+		rule.ShardGroupDurationSeconds = &shard
+	}
+	return domain.RetentionRules{rule}
+}
+
+// matches 判断已有 Bucket 是否与定义一致，ShardGroupDuration 为0时不比较
+func (s BucketSpec) matches(b BucketInfo) bool {
+	return b.Description == s.Description && b.Retention == s.Retention &&
+		(s.ShardGroupDuration == 0 || b.ShardGroupDuration == s.ShardGroupDuration)
+}
+
+func bucketInfo(b *domain.Bucket) BucketInfo {
+	info := BucketInfo{Name: b.Name}
+	if b.Id != nil {
+		info.ID = *b.Id
+	}
+	if b.Description != nil {
+		info.Description = *b.Description
+	}
+	if b.CreatedAt != nil {
+		info.CreatedAt = *b.CreatedAt
+	}
+	if b.UpdatedAt != nil {
+		info.UpdatedAt = *b.UpdatedAt
+	}
+	for _, rule := range b.RetentionRules {
+		info.Retention = time.Duration(rule.EverySeconds) * time.Second
+		if rule.ShardGroupDurationSeconds != nil {
+			info.ShardGroupDuration = time.Duration(*rule.ShardGroupDurationSeconds) * time.Second
+		}
+	}
+	return info
+}
+
+// orgID 查询并缓存配置中 Org 的 ID
+func (i *InfluxClient) orgID(ctx context.Context) (string, error) {
+	if i.client == nil {
+		return "", fmt.Errorf("influx client not initialized")
+	}
+	i.mu.Lock()
+	id := i.orgIDCache
+	i.mu.Unlock()
+	if id != "" {
+		return id, nil
+	}
+
+	org, err := i.client.OrganizationsAPI().FindOrganizationByName(ctx, i.config.Org)
+	if err != nil {
+		return "", fmt.Errorf("find organization %s: %w", i.config.Org, err)
+	}
+	if org == nil || org.Id == nil {
+		return "", fmt.Errorf("organization %s not found", i.config.Org)
+	}
+	i.mu.Lock()
+	i.orgIDCache = *org.Id
+	i.mu.Unlock()
+	return *org.Id, nil
+}
+
+// findBucket 在配置的 Org 中按名称查找 Bucket，不存在时返回 nil
+// 按名称过滤列出 Bucket，结果为空才视为不存在，认证失败、网络错误等均返回错误
+func (i *InfluxClient) findBucket(ctx context.Context, name string) (*domain.Bucket, error) {
+	orgID, err := i.orgID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := i.client.APIClient().GetBuckets(ctx, &domain.GetBucketsParams{OrgID: &orgID, Name: &name})
+	if err != nil {
+		return nil, fmt.Errorf("find bucket %s: %w", name, err)
+	}
+	if resp.Buckets == nil {
+		return nil, nil
+	}
+	for n := range *resp.Buckets {
+		if b := &(*resp.Buckets)[n]; b.Name == name {
+			return b, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetBucket 按名称获取 Bucket，不存在时返回 nil
+func (i *InfluxClient) GetBucket(ctx context.Context, name string) (*BucketInfo, error) {
+	b, err := i.findBucket(ctx, name)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	info := bucketInfo(b)
+	return &info, nil
+}
+
+// CreateBucket 在配置的 Org 中创建 Bucket
+func (i *InfluxClient) CreateBucket(ctx context.Context, spec BucketSpec) (*BucketInfo, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+	orgID, err := i.orgID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b := &domain.Bucket{Name: spec.Name, OrgID: &orgID, RetentionRules: spec.retentionRules()}
+	if spec.Description != "" {
+		b.Description = &spec.Description
+	}
+	created, err := i.client.BucketsAPI().CreateBucket(ctx, b)
+	if err != nil {
+		return nil, fmt.Errorf("create bucket %s: %w", spec.Name, err)
+	}
+	info := bucketInfo(created)
+	return &info, nil
+}
+
+// UpdateBucket 按名称更新 Bucket 的描述与保留策略
+func (i *InfluxClient) UpdateBucket(ctx context.Context, spec BucketSpec) (*BucketInfo, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+	b, err := i.findBucket(ctx, spec.Name)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, fmt.Errorf("bucket %s not found", spec.Name)
+	}
+	return i.updateBucket(ctx, b, spec)
+}
+
+func (i *InfluxClient) updateBucket(ctx context.Context, b *domain.Bucket, spec BucketSpec) (*BucketInfo, error) {
+	b.Description = &spec.Description
+	b.RetentionRules = spec.retentionRules()
+	updated, err := i.client.BucketsAPI().UpdateBucket(ctx, b)
+	if err != nil {
+		return nil, fmt.Errorf("update bucket %s: %w", spec.Name, err)
+	}
+	info := bucketInfo(updated)
+	return &info, nil
+}
+
+// EnsureBucket 确保 Bucket 存在且与定义一致：不存在时创建，描述或保留策略不同时更新
+func (i *InfluxClient) EnsureBucket(ctx context.Context, spec BucketSpec) (*BucketInfo, error) {
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+	b, err := i.findBucket(ctx, spec.Name)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return i.CreateBucket(ctx, spec)
+	}
+	if info := bucketInfo(b); spec.matches(info) {
+		return &info, nil
+	}
+	return i.updateBucket(ctx, b, spec)
+}
+
+// ListBuckets 列出配置的 Org 中的所有 Bucket，包括 _monitoring 等系统 Bucket
+func (i *InfluxClient) ListBuckets(ctx context.Context) ([]BucketInfo, error) {
+	orgID, err := i.orgID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	const pageSize = 100
+	var infos []BucketInfo
+	for offset := 0; ; offset += pageSize {
+		page, err := i.client.BucketsAPI().FindBucketsByOrgID(ctx, orgID,
+			influxapi.PagingWithLimit(pageSize), influxapi.PagingWithOffset(offset))
+		if err != nil {
+			return nil, fmt.Errorf("list buckets: %w", err)
+		}
+		if page == nil {
+			break
+		}
+		for n := range *page {
+			infos = append(infos, bucketInfo(&(*page)[n]))
+		}
+		if len(*page) < pageSize {
+			break
+		}
+	}
+	return infos, nil
+}
+
+// DeleteBucket 按名称删除 Bucket 及其中的全部数据，Bucket 不存在时不报错
+func (i *InfluxClient) DeleteBucket(ctx context.Context, name string) error {
+	b, err := i.findBucket(ctx, name)
+	if err != nil || b == nil {
+		return err
+	}
+	if err := i.client.BucketsAPI().DeleteBucket(ctx, b); err != nil {
+		return fmt.Errorf("delete bucket %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package influxdbtools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+)
+
+// fakeInflux 模拟 InfluxDB 的 orgs、buckets 与 tasks 接口
+type fakeInflux struct {
+	mu      sync.Mutex
+	nextID  int
+	buckets map[string]*domain.Bucket
+	tasks   map[string]*domain.Task
+	calls   []string // "METHOD path"，不含查询
+	status  int      // 非0时 buckets 接口直接返回该状态码
+}
+
+var taskNameRe = regexp.MustCompile(`option task = \{name: "((?:[^"\\]|\\.)*)"`)
+
+func newFakeInflux(t *testing.T) (*fakeInflux, *InfluxClient) {
+	f := &fakeInflux{buckets: map[string]*domain.Bucket{}, tasks: map[string]*domain.Task{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	client := influxdb2.NewClient(srv.URL, "token")
+	t.Cleanup(client.Close)
+	return f, &InfluxClient{config: InfluxConfig{URL: srv.URL, Org: "acme", Bucket: "raw"}, client: client}
+}
+
+func (f *fakeInflux) id() string {
+	f.nextID++
+	return fmt.Sprintf("%016d", f.nextID)
+}
+
+func (f *fakeInflux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v2/")
+	if r.Method != http.MethodGet {
+		f.calls = append(f.calls, r.Method+" "+path)
+	}
+	resource, id, _ := strings.Cut(path, "/")
+	query := r.URL.Query()
+	reply := func(status int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	notFound := func() {
+		reply(http.StatusNotFound, map[string]string{"code": "not found", "message": resource + " not found"})
+	}
+
+	switch {
+	case resource == "buckets" && f.status != 0:
+		reply(f.status, map[string]string{"code": "unauthorized", "message": http.StatusText(f.status)})
+	case resource == "orgs" && r.Method == http.MethodGet:
+		orgID, name := "org1", "acme"
+		if query.Get("org") != name {
+			reply(http.StatusOK, domain.Organizations{Orgs: &[]domain.Organization{}})
+			return
+		}
+		reply(http.StatusOK, domain.Organizations{Orgs: &[]domain.Organization{{Id: &orgID, Name: name}}})
+
+	case resource == "buckets" && id == "" && r.Method == http.MethodGet:
+		var list []domain.Bucket
+		for _, b := range f.buckets {
+			if name := query.Get("name"); name == "" || b.Name == name {
+				list = append(list, *b)
+			}
+		}
+		reply(http.StatusOK, domain.Buckets{Buckets: &list})
+	case resource == "buckets" && id == "" && r.Method == http.MethodPost:
+		var req domain.PostBucketRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		bid := f.id()
+		b := &domain.Bucket{Id: &bid, Name: req.Name, OrgID: &req.OrgID, Description: req.Description}
+		if req.RetentionRules != nil {
+			b.RetentionRules = *req.RetentionRules
+		}
+		f.buckets[bid] = b
+		reply(http.StatusCreated, b)
+	case resource == "buckets" && r.Method == http.MethodPatch:
+		b, ok := f.buckets[id]
+		if !ok {
+			notFound()
+			return
+		}
+		var req domain.PatchBucketRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		b.Description = req.Description
+		if req.RetentionRules != nil {
+			b.RetentionRules = nil
+			for _, rule := range *req.RetentionRules {
+				b.RetentionRules = append(b.RetentionRules, domain.RetentionRule{
+					EverySeconds: rule.EverySeconds, ShardGroupDurationSeconds: rule.ShardGroupDurationSeconds,
+				})
+			}
+		}
+		reply(http.StatusOK, b)
+	case resource == "buckets" && r.Method == http.MethodDelete:
+		if _, ok := f.buckets[id]; !ok {
+			notFound()
+			return
+		}
+		delete(f.buckets, id)
+		w.WriteHeader(http.StatusNoContent)
+
+	case resource == "tasks" && id == "" && r.Method == http.MethodGet:
+		list := []domain.Task{}
+		for _, task := range f.tasks {
+			if name := query.Get("name"); name == "" || task.Name == name {
+				list = append(list, *task)
+			}
+		}
+		reply(http.StatusOK, domain.Tasks{Tasks: &list})
+	case resource == "tasks" && id == "" && r.Method == http.MethodPost:
+		var req domain.TaskCreateRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		m := taskNameRe.FindStringSubmatch(req.Flux)
+		if m == nil {
+			reply(http.StatusBadRequest, map[string]string{"code": "invalid", "message": "task option required"})
+			return
+		}
+		tid := f.id()
+		task := &domain.Task{Id: tid, Name: m[1], Flux: req.Flux, OrgID: *req.OrgID, Status: req.Status}
+		f.tasks[tid] = task
+		reply(http.StatusCreated, task)
+	case resource == "tasks" && r.Method == http.MethodPatch:
+		task, ok := f.tasks[id]
+		if !ok {
+			notFound()
+			return
+		}
+		var req domain.TaskUpdateRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Flux != nil {
+			task.Flux = *req.Flux
+		}
+		if req.Status != nil {
+			task.Status = req.Status
+		}
+		reply(http.StatusOK, task)
+	case resource == "tasks" && r.Method == http.MethodDelete:
+		if _, ok := f.tasks[id]; !ok {
+			notFound()
+			return
+		}
+		delete(f.tasks, id)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		notFound()
+	}
+}
+
+func (f *fakeInflux) takeCalls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	calls := f.calls
+	f.calls = nil
+	return calls
+}
+
+func TestBuckets_Lifecycle(t *testing.T) {
+	f, client := newFakeInflux(t)
+	ctx := context.Background()
+
+	created, err := client.CreateBucket(ctx, BucketSpec{Name: "metrics", Retention: 7 * 24 * time.Hour, Description: "raw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || created.Retention != 7*24*time.Hour || created.Description != "raw" {
+		t.Errorf("unexpected bucket %+v", created)
+	}
+
+	// 定义一致时不更新
+	f.takeCalls()
+	if _, err := client.EnsureBucket(ctx, BucketSpec{Name: "metrics", Retention: 7 * 24 * time.Hour, Description: "raw"}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := f.takeCalls(); len(calls) != 0 {
+		t.Errorf("expected no writes, got %v", calls)
+	}
+
+	updated, err := client.EnsureBucket(ctx, BucketSpec{Name: "metrics", Retention: 30 * 24 * time.Hour, ShardGroupDuration: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Retention != 30*24*time.Hour || updated.ShardGroupDuration != 24*time.Hour || updated.Description != "" {
+		t.Errorf("unexpected updated bucket %+v", updated)
+	}
+	if calls := f.takeCalls(); len(calls) != 1 || !strings.HasPrefix(calls[0], "PATCH buckets/") {
+		t.Errorf("expected one PATCH, got %v", calls)
+	}
+
+	if _, err := client.EnsureBucket(ctx, BucketSpec{Name: "forever"}); err != nil {
+		t.Fatal(err)
+	}
+	list, err := client.ListBuckets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Errorf("expected 2 buckets, got %+v", list)
+	}
+
+	if err := client.DeleteBucket(ctx, "metrics"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := client.GetBucket(ctx, "metrics"); err != nil || b != nil {
+		t.Errorf("expected bucket deleted, got %+v, %v", b, err)
+	}
+	if err := client.DeleteBucket(ctx, "metrics"); err != nil {
+		t.Errorf("deleting a missing bucket should succeed, got %v", err)
+	}
+	if _, err := client.UpdateBucket(ctx, BucketSpec{Name: "metrics"}); err == nil {
+		t.Error("expected error updating a missing bucket")
+	}
+}
+
+func TestBuckets_Validation(t *testing.T) {
+	_, client := newFakeInflux(t)
+	ctx := context.Background()
+	for _, spec := range []BucketSpec{
+		{},
+		{Name: "b", Retention: -time.Hour},
+		{Name: "b", Retention: 1500 * time.Millisecond},
+		{Name: "b", ShardGroupDuration: time.Millisecond},
+	} {
+		if _, err := client.CreateBucket(ctx, spec); err == nil {
+			t.Errorf("expected validation error for %+v", spec)
+		}
+	}
+
+	client.config.Org = "missing"
+	if _, err := client.CreateBucket(ctx, BucketSpec{Name: "b"}); err == nil {
+		t.Error("expected error for missing organization")
+	}
+}
+
+func TestEnsureBucketExists(t *testing.T) {
+	f, client := newFakeInflux(t)
+	if err := client.ensureBucketExists(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.buckets) != 1 {
+		t.Fatalf("expected bucket created, got %d buckets", len(f.buckets))
+	}
+	f.takeCalls()
+	if err := client.ensureBucketExists(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls := f.takeCalls(); len(calls) != 0 {
+		t.Errorf("expected no writes for an existing bucket, got %v", calls)
+	}
+}
+
+func TestBuckets_ServerError(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusInternalServerError} {
+		f, client := newFakeInflux(t)
+		ctx := context.Background()
+		f.status = status
+
+		if b, err := client.GetBucket(ctx, "raw"); err == nil {
+			t.Errorf("%d: expected GetBucket error, got %+v", status, b)
+		}
+		if err := client.DeleteBucket(ctx, "raw"); err == nil {
+			t.Errorf("%d: expected DeleteBucket error", status)
+		}
+		if _, err := client.EnsureBucket(ctx, BucketSpec{Name: "raw"}); err == nil {
+			t.Errorf("%d: expected EnsureBucket error", status)
+		}
+		if err := client.ensureBucketExists(ctx); err == nil {
+			t.Errorf("%d: expected ensureBucketExists error", status)
+		}
+		if calls := f.takeCalls(); len(calls) != 0 {
+			t.Errorf("%d: expected no create or delete attempts, got %v", status, calls)
+		}
+	}
+}
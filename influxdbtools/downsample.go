@@ -0,0 +1,220 @@
+package influxdbtools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	influxapi "github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+)
+
+// -------- 降采样任务 --------
+
+// DownsampleTaskPrefix 托管的降采样任务名称前缀，SyncDownsampleTasks 只会删除带此前缀的任务
+const DownsampleTaskPrefix = "downsample:"
+
+// DownsampleSpec 降采样任务定义：每隔 Every 将 SourceBucket 最近 Every 时间内的数据聚合后写入 TargetBucket
+type DownsampleSpec struct {
+	Name         string        // 任务名（不含前缀），默认 "<source>_<every>_<aggregate>"
+	SourceBucket string        // 源 Bucket
+	TargetBucket string        // 目标 Bucket，需已存在
+	Every        time.Duration // 执行间隔，同时也是聚合窗口
+	Aggregate    AggregateFunc // 聚合函数，默认 mean
+	Offset       time.Duration // 延迟执行，等待迟到的数据写入，默认0
+	Measurements []string      // 只处理这些 measurement，为空表示全部
+	Fields       []string      // 只处理这些 field，为空表示全部（非数值 field 需选择适用的聚合函数）
+}
+
+func (s DownsampleSpec) withDefaults() DownsampleSpec {
+	if s.Aggregate == "" {
+		s.Aggregate = AggMean
+	}
+	if s.Name == "" {
+		s.Name = fmt.Sprintf("%s_%s_%s", s.SourceBucket, formatFluxDuration(s.Every), s.Aggregate)
+	}
+	return s
+}
+
+// TaskName 返回服务端的任务名称
+func (s DownsampleSpec) TaskName() string {
+	return DownsampleTaskPrefix + s.withDefaults().Name
+}
+
+// Flux 生成任务脚本，包含 option task 声明
+func (s DownsampleSpec) Flux(org string) (string, error) {
+	s = s.withDefaults()
+	if s.SourceBucket == "" || s.TargetBucket == "" {
+		return "", fmt.Errorf("downsample %s: source and target bucket cannot be empty", s.Name)
+	}
+	if s.SourceBucket == s.TargetBucket {
+		return "", fmt.Errorf("downsample %s: source and target bucket must differ", s.Name)
+	}
+	if s.Every < time.Second {
+		return "", fmt.Errorf("downsample %s: every must be at least 1s, got %s", s.Name, s.Every)
+	}
+	if s.Offset < 0 {
+		return "", fmt.Errorf("downsample %s: offset cannot be negative", s.Name)
+	}
+
+	q := NewFluxQuery(s.SourceBucket).pipe(func(r *fluxRenderer) string {
+		return "range(start: -task.every)"
+	})
+	if len(s.Measurements) > 0 {
+		q.Measurement(s.Measurements...)
+	}
+	if len(s.Fields) > 0 {
+		q.Fields(s.Fields...)
+	}
+	q.AggregateWindow(s.Every, s.Aggregate, false).pipe(func(r *fluxRenderer) string {
+		return fmt.Sprintf("to(bucket: %s, org: %s)", quoteFlux(s.TargetBucket), quoteFlux(org))
+	})
+	body, err := q.Flux()
+	if err != nil {
+		return "", fmt.Errorf("downsample %s: %w", s.Name, err)
+	}
+
+	option := fmt.Sprintf("option task = {name: %s, every: %s", quoteFlux(DownsampleTaskPrefix+s.Name), formatFluxDuration(s.Every))
+	if s.Offset > 0 {
+		option += ", offset: " + formatFluxDuration(s.Offset)
+	}
+	return option + "}\n\n" + body + "\n", nil
+}
+
+// EnsureDownsampleTask 创建或更新降采样任务，使其脚本与定义一致并处于启用状态
+func (i *InfluxClient) EnsureDownsampleTask(ctx context.Context, spec DownsampleSpec) (*domain.Task, error) {
+	flux, err := spec.Flux(i.config.Org)
+	if err != nil {
+		return nil, err
+	}
+	orgID, err := i.orgID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := i.findTasks(ctx, orgID, spec.TaskName())
+	if err != nil {
+		return nil, err
+	}
+	tasks := i.client.TasksAPI()
+
+	// 同名任务只保留一个
+	for n := 1; n < len(existing); n++ {
+		if err := tasks.DeleteTask(ctx, &existing[n]); err != nil {
+			return nil, fmt.Errorf("delete duplicate task %s: %w", existing[n].Name, err)
+		}
+	}
+	if len(existing) == 0 {
+		task, err := tasks.CreateTaskByFlux(ctx, flux, orgID)
+		if err != nil {
+			return nil, fmt.Errorf("create task %s: %w", spec.TaskName(), err)
+		}
+		return task, nil
+	}
+
+	task := existing[0]
+	if task.Flux == flux && task.Status != nil && *task.Status == domain.TaskStatusTypeActive {
+		return &task, nil
+	}
+	// every 与 offset 由脚本中的 option task 决定
+	active := domain.TaskStatusTypeActive
+	task.Flux = flux
+	task.Status = &active
+	task.Every, task.Cron, task.Offset = nil, nil, nil
+	updated, err := tasks.UpdateTask(ctx, &task)
+	if err != nil {
+		return nil, fmt.Errorf("update task %s: %w", task.Name, err)
+	}
+	return updated, nil
+}
+
+// SyncDownsampleTasks 使托管的降采样任务与 specs 一致：创建或更新 specs 中的任务，
+// 删除带 DownsampleTaskPrefix 前缀但不在 specs 中的任务
+func (i *InfluxClient) SyncDownsampleTasks(ctx context.Context, specs []DownsampleSpec) error {
+	wanted := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		name := spec.TaskName()
+		if wanted[name] {
+			return fmt.Errorf("duplicate downsample task %s", name)
+		}
+		wanted[name] = true
+	}
+	for _, spec := range specs {
+		if _, err := i.EnsureDownsampleTask(ctx, spec); err != nil {
+			return err
+		}
+	}
+
+	managed, err := i.ListDownsampleTasks(ctx)
+	if err != nil {
+		return err
+	}
+	for n := range managed {
+		if wanted[managed[n].Name] {
+			continue
+		}
+		if err := i.client.TasksAPI().DeleteTask(ctx, &managed[n]); err != nil {
+			return fmt.Errorf("delete task %s: %w", managed[n].Name, err)
+		}
+	}
+	return nil
+}
+
+// ListDownsampleTasks 列出所有托管的降采样任务
+func (i *InfluxClient) ListDownsampleTasks(ctx context.Context) ([]domain.Task, error) {
+	orgID, err := i.orgID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	all, err := i.findTasks(ctx, orgID, "")
+	if err != nil {
+		return nil, err
+	}
+	var managed []domain.Task
+	for _, task := range all {
+		if strings.HasPrefix(task.Name, DownsampleTaskPrefix) {
+			managed = append(managed, task)
+		}
+	}
+	return managed, nil
+}
+
+// DeleteDownsampleTask 删除降采样任务，任务不存在时不报错
+func (i *InfluxClient) DeleteDownsampleTask(ctx context.Context, spec DownsampleSpec) error {
+	orgID, err := i.orgID(ctx)
+	if err != nil {
+		return err
+	}
+	existing, err := i.findTasks(ctx, orgID, spec.TaskName())
+	if err != nil {
+		return err
+	}
+	for n := range existing {
+		if err := i.client.TasksAPI().DeleteTask(ctx, &existing[n]); err != nil {
+			return fmt.Errorf("delete task %s: %w", existing[n].Name, err)
+		}
+	}
+	return nil
+}
+
+// findTasks 分页查询 Org 中的任务，name 不为空时只返回同名任务
+func (i *InfluxClient) findTasks(ctx context.Context, orgID, name string) ([]domain.Task, error) {
+	const pageSize = 500
+	filter := &influxapi.TaskFilter{OrgID: orgID, Name: name, Limit: pageSize}
+	var tasks []domain.Task
+	for {
+		page, err := i.client.TasksAPI().FindTasks(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("find tasks: %w", err)
+		}
+		for _, task := range page {
+			if name == "" || task.Name == name {
+				tasks = append(tasks, task)
+			}
+		}
+		if len(page) < pageSize {
+			return tasks, nil
+		}
+		filter.After = page[len(page)-1].Id
+	}
+}
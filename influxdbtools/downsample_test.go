@@ -0,0 +1,121 @@
+package influxdbtools
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+)
+
+func TestDownsampleSpec_Flux(t *testing.T) {
+	spec := DownsampleSpec{
+		SourceBucket: "raw",
+		TargetBucket: "raw_1h",
+		Every:        time.Hour,
+		Offset:       5 * time.Minute,
+		Measurements: []string{"cpu"},
+		Fields:       []string{"usage", "load"},
+	}
+	flux, err := spec.Flux("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `option task = {name: "downsample:raw_1h_mean", every: 1h, offset: 5m}
+
+from(bucket: "raw")
+  |> range(start: -task.every)
+  |> filter(fn: (r) => r._measurement == "cpu")
+  |> filter(fn: (r) => r._field == "usage" or r._field == "load")
+  |> aggregateWindow(every: 1h, fn: mean, createEmpty: false)
+  |> to(bucket: "raw_1h", org: "acme")
+`
+	if flux != want {
+		t.Errorf("unexpected flux\n got:\n%s\nwant:\n%s", flux, want)
+	}
+	if name := spec.TaskName(); name != "downsample:raw_1h_mean" {
+		t.Errorf("unexpected task name %q", name)
+	}
+
+	for _, bad := range []DownsampleSpec{
+		{TargetBucket: "t", Every: time.Hour},
+		{SourceBucket: "s", TargetBucket: "s", Every: time.Hour},
+		{SourceBucket: "s", TargetBucket: "t", Every: time.Millisecond},
+		{SourceBucket: "s", TargetBucket: "t", Every: time.Hour, Aggregate: "mean)"},
+	} {
+		if _, err := bad.Flux("acme"); err == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestSyncDownsampleTasks(t *testing.T) {
+	f, client := newFakeInflux(t)
+	ctx := context.Background()
+
+	hourly := DownsampleSpec{SourceBucket: "raw", TargetBucket: "raw_1h", Every: time.Hour}
+	daily := DownsampleSpec{Name: "daily", SourceBucket: "raw_1h", TargetBucket: "raw_1d", Every: 24 * time.Hour, Aggregate: AggMax}
+	// 非托管任务不应被删除
+	f.tasks["manual"] = &domain.Task{Id: "manual", Name: "manual-task", Flux: "x"}
+
+	if err := client.SyncDownsampleTasks(ctx, []DownsampleSpec{hourly, daily}); err != nil {
+		t.Fatal(err)
+	}
+	managed, err := client.ListDownsampleTasks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(managed) != 2 {
+		t.Fatalf("expected 2 managed tasks, got %d", len(managed))
+	}
+
+	// 再次同步不产生写入
+	f.takeCalls()
+	if err := client.SyncDownsampleTasks(ctx, []DownsampleSpec{hourly, daily}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := f.takeCalls(); len(calls) != 0 {
+		t.Errorf("expected no writes, got %v", calls)
+	}
+
+	// 定义变化时更新脚本，被停用的任务重新启用
+	inactive := domain.TaskStatusTypeInactive
+	for _, task := range f.tasks {
+		if task.Name == hourly.TaskName() {
+			task.Status = &inactive
+		}
+	}
+	hourly.Measurements = []string{"cpu"}
+	if err := client.SyncDownsampleTasks(ctx, []DownsampleSpec{hourly}); err != nil {
+		t.Fatal(err)
+	}
+	calls := f.takeCalls()
+	if len(calls) != 2 || !strings.HasPrefix(calls[0], "PATCH tasks/") || !strings.HasPrefix(calls[1], "DELETE tasks/") {
+		t.Errorf("expected update and delete, got %v", calls)
+	}
+
+	want, _ := hourly.Flux("acme")
+	names := map[string]bool{}
+	for _, task := range f.tasks {
+		names[task.Name] = true
+		if task.Name == hourly.TaskName() {
+			if task.Flux != want || *task.Status != domain.TaskStatusTypeActive {
+				t.Errorf("task not synced: status=%v flux=\n%s", *task.Status, task.Flux)
+			}
+		}
+	}
+	if !names["manual-task"] || !names[hourly.TaskName()] || names[daily.TaskName()] || len(names) != 2 {
+		t.Errorf("unexpected tasks after sync %v", names)
+	}
+
+	if err := client.SyncDownsampleTasks(ctx, []DownsampleSpec{hourly, hourly}); err == nil {
+		t.Error("expected error for duplicate specs")
+	}
+	if err := client.DeleteDownsampleTask(ctx, hourly); err != nil {
+		t.Fatal(err)
+	}
+	if managed, _ := client.ListDownsampleTasks(ctx); len(managed) != 0 {
+		t.Errorf("expected no managed tasks, got %d", len(managed))
+	}
+}
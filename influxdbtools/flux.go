@@ -0,0 +1,405 @@
+package influxdbtools
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// -------- Flux 查询构建 --------
+
+// FluxOp 过滤条件中的比较运算符
+type FluxOp string
+
+const (
+	OpEq FluxOp = "=="
+	OpNe FluxOp = "!="
+	OpLt FluxOp = "<"
+	OpLe FluxOp = "<="
+	OpGt FluxOp = ">"
+	OpGe FluxOp = ">="
+)
+
+// AggregateFunc aggregateWindow 使用的聚合函数
+type AggregateFunc string
+
+const (
+	AggMean   AggregateFunc = "mean"
+	AggMedian AggregateFunc = "median"
+	AggSum    AggregateFunc = "sum"
+	AggCount  AggregateFunc = "count"
+	AggMin    AggregateFunc = "min"
+	AggMax    AggregateFunc = "max"
+	AggFirst  AggregateFunc = "first"
+	AggLast   AggregateFunc = "last"
+)
+
+// FluxQuery Flux 查询构建器，按调用顺序生成管道
+// 所有字符串都会转义；Flux() 生成内联字面量的查询，Params() 生成使用 params 的参数化查询
+// 示例：
+//
+//	q := NewFluxQuery("weather").RangeLast(time.Hour).Measurement("weather").Tag("location", "sensor-1").
+//		Fields("temperature").AggregateWindow(time.Minute, AggMean, false)
+//	rows, err := client.QueryFlux(ctx, q)
+type FluxQuery struct {
+	bucket string
+	pipes  []func(r *fluxRenderer) string
+	err    error
+}
+
+// NewFluxQuery 创建从 bucket 读取的查询
+func NewFluxQuery(bucket string) *FluxQuery {
+	q := &FluxQuery{bucket: bucket}
+	if bucket == "" {
+		q.err = fmt.Errorf("bucket cannot be empty")
+	}
+	return q
+}
+
+func (q *FluxQuery) pipe(f func(r *fluxRenderer) string) *FluxQuery {
+	q.pipes = append(q.pipes, f)
+	return q
+}
+
+func (q *FluxQuery) fail(format string, args ...any) *FluxQuery {
+	if q.err == nil {
+		q.err = fmt.Errorf(format, args...)
+	}
+	return q
+}
+
+// Range 查询 [start, stop) 的数据，stop 为零值时查询到当前时间
+func (q *FluxQuery) Range(start, stop time.Time) *FluxQuery {
+	if start.IsZero() {
+		return q.fail("range start cannot be zero")
+	}
+	if !stop.IsZero() && !stop.After(start) {
+		return q.fail("range stop %s must be after start %s", stop, start)
+	}
+	return q.pipe(func(r *fluxRenderer) string {
+		if stop.IsZero() {
+			return fmt.Sprintf("range(start: %s)", r.value(start))
+		}
+		return fmt.Sprintf("range(start: %s, stop: %s)", r.value(start), r.value(stop))
+	})
+}
+
+// RangeLast 查询最近 d 时间内的数据，如 RangeLast(time.Hour) 生成 range(start: -1h)
+func (q *FluxQuery) RangeLast(d time.Duration) *FluxQuery {
+	if d <= 0 {
+		return q.fail("range duration must be positive, got %s", d)
+	}
+	return q.pipe(func(r *fluxRenderer) string {
+		return fmt.Sprintf("range(start: -%s)", formatFluxDuration(d))
+	})
+}
+
+// Measurement 按 measurement 过滤，多个值之间为或
+func (q *FluxQuery) Measurement(names ...string) *FluxQuery {
+	return q.in("_measurement", names)
+}
+
+// Tag 按 tag 的值过滤，多个值之间为或
+func (q *FluxQuery) Tag(key string, values ...string) *FluxQuery {
+	if key == "" {
+		return q.fail("tag key cannot be empty")
+	}
+	return q.in(key, values)
+}
+
+// Fields 按 field 名称过滤，多个名称之间为或
+func (q *FluxQuery) Fields(names ...string) *FluxQuery {
+	return q.in("_field", names)
+}
+
+func (q *FluxQuery) in(column string, values []string) *FluxQuery {
+	if len(values) == 0 {
+		return q.fail("filter on %s requires at least one value", column)
+	}
+	return q.pipe(func(r *fluxRenderer) string {
+		conds := make([]string, len(values))
+		for n, v := range values {
+			conds[n] = fmt.Sprintf("%s == %s", fluxColumn(column), r.value(v))
+		}
+		if len(conds) == 1 {
+			return fmt.Sprintf("filter(fn: (r) => %s)", conds[0])
+		}
+		return fmt.Sprintf("filter(fn: (r) => %s)", strings.Join(conds, " or "))
+	})
+}
+
+// Where 按列值比较过滤，value 支持字符串、整数、浮点数、布尔值与 time.Time
+// 示例：Where("_value", OpGt, 30.0)
+func (q *FluxQuery) Where(column string, op FluxOp, value any) *FluxQuery {
+	switch op {
+	case OpEq, OpNe, OpLt, OpLe, OpGt, OpGe:
+	default:
+		return q.fail("unsupported operator %q", op)
+	}
+	if column == "" {
+		return q.fail("column cannot be empty")
+	}
+	if _, err := fluxLiteral(value); err != nil {
+		return q.fail("where %s: %w", column, err)
+	}
+	return q.pipe(func(r *fluxRenderer) string {
+		return fmt.Sprintf("filter(fn: (r) => %s %s %s)", fluxColumn(column), op, r.value(value))
+	})
+}
+
+// AggregateWindow 按 every 划分时间窗口并聚合，createEmpty 为true时为没有数据的窗口生成空值
+func (q *FluxQuery) AggregateWindow(every time.Duration, fn AggregateFunc, createEmpty bool) *FluxQuery {
+	if every <= 0 {
+		return q.fail("aggregate window must be positive, got %s", every)
+	}
+	if !isFluxIdentifier(string(fn)) {
+		return q.fail("invalid aggregate function %q", fn)
+	}
+	return q.pipe(func(r *fluxRenderer) string {
+		return fmt.Sprintf("aggregateWindow(every: %s, fn: %s, createEmpty: %t)", formatFluxDuration(every), fn, createEmpty)
+	})
+}
+
+// Group 按列重新分组，不指定列时合并为一个表
+func (q *FluxQuery) Group(columns ...string) *FluxQuery {
+	return q.pipe(func(r *fluxRenderer) string {
+		if len(columns) == 0 {
+			return "group()"
+		}
+		return fmt.Sprintf("group(columns: %s)", fluxStringArray(columns))
+	})
+}
+
+// Pivot 将 columnKey 的值转为列
+func (q *FluxQuery) Pivot(rowKey, columnKey []string, valueColumn string) *FluxQuery {
+	if len(rowKey) == 0 || len(columnKey) == 0 || valueColumn == "" {
+		return q.fail("pivot requires rowKey, columnKey and valueColumn")
+	}
+	return q.pipe(func(r *fluxRenderer) string {
+		return fmt.Sprintf("pivot(rowKey: %s, columnKey: %s, valueColumn: %s)",
+			fluxStringArray(rowKey), fluxStringArray(columnKey), quoteFlux(valueColumn))
+	})
+}
+
+// PivotFields 将每个 field 转为一列，每个时间点一行，结果可直接用于 QueryInto
+func (q *FluxQuery) PivotFields() *FluxQuery {
+	return q.Pivot([]string{"_time"}, []string{"_field"}, "_value")
+}
+
+// Sort 按列排序，不指定列时按 _value 排序
+func (q *FluxQuery) Sort(desc bool, columns ...string) *FluxQuery {
+	return q.pipe(func(r *fluxRenderer) string {
+		if len(columns) == 0 {
+			return fmt.Sprintf("sort(desc: %t)", desc)
+		}
+		return fmt.Sprintf("sort(columns: %s, desc: %t)", fluxStringArray(columns), desc)
+	})
+}
+
+// Limit 每个表最多返回 n 行
+func (q *FluxQuery) Limit(n int) *FluxQuery {
+	if n <= 0 {
+		return q.fail("limit must be positive, got %d", n)
+	}
+	return q.pipe(func(r *fluxRenderer) string {
+		return fmt.Sprintf("limit(n: %d)", n)
+	})
+}
+
+// Flux 生成内联字面量的 Flux 查询
+func (q *FluxQuery) Flux() (string, error) {
+	flux, _, err := q.render(false)
+	return flux, err
+}
+
+// Params 生成参数化查询，值通过 params.pN 引用，需配合 QueryWithParams 执行
+// 注意：参数化查询仅 InfluxDB Cloud 支持，自建 InfluxDB OSS 请使用 Flux()
+func (q *FluxQuery) Params() (string, map[string]any, error) {
+	return q.render(true)
+}
+
+func (q *FluxQuery) render(parameterized bool) (string, map[string]any, error) {
+	if q.err != nil {
+		return "", nil, q.err
+	}
+	r := &fluxRenderer{parameterized: parameterized, params: map[string]any{}}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "from(bucket: %s)", quoteFlux(q.bucket))
+	for _, p := range q.pipes {
+		sb.WriteString("\n  |> ")
+		sb.WriteString(p(r))
+	}
+	if r.err != nil {
+		return "", nil, r.err
+	}
+	return sb.String(), r.params, nil
+}
+
+// fluxRenderer 生成查询中的值：内联为字面量，或登记为参数
+type fluxRenderer struct {
+	parameterized bool
+	params        map[string]any
+	err           error
+}
+
+func (r *fluxRenderer) value(v any) string {
+	if !r.parameterized {
+		lit, err := fluxLiteral(v)
+		if err != nil && r.err == nil {
+			r.err = err
+		}
+		return lit
+	}
+
+	name := fmt.Sprintf("p%d", len(r.params))
+	ref := "params." + name
+	if _, err := fluxLiteral(v); err != nil && r.err == nil {
+		r.err = err
+	}
+	// 参数以 JSON 传递，数值与时间需显式转换，避免整数与浮点数混淆
+	switch x := v.(type) {
+	case time.Duration:
+		// 参数不支持持续时间类型，始终内联
+		return formatFluxDuration(x)
+	case time.Time:
+		r.params[name] = x.UTC().Format(time.RFC3339Nano)
+		return fmt.Sprintf("time(v: %s)", ref)
+	case float32, float64:
+		r.params[name] = x
+		return fmt.Sprintf("float(v: %s)", ref)
+	case int, int8, int16, int32, int64:
+		r.params[name] = x
+		return fmt.Sprintf("int(v: %s)", ref)
+	case uint, uint8, uint16, uint32, uint64:
+		r.params[name] = x
+		return fmt.Sprintf("uint(v: %s)", ref)
+	}
+	r.params[name] = v
+	return ref
+}
+
+// fluxLiteral 将 Go 值格式化为 Flux 字面量
+func fluxLiteral(v any) (string, error) {
+	switch x := v.(type) {
+	case string:
+		return quoteFlux(x), nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	case int:
+		return strconv.FormatInt(int64(x), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(x), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(x), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(x), 10), nil
+	case int64:
+		return strconv.FormatInt(x, 10), nil
+	case uint:
+		return fmt.Sprintf("uint(v: %d)", x), nil
+	case uint8:
+		return fmt.Sprintf("uint(v: %d)", x), nil
+	case uint16:
+		return fmt.Sprintf("uint(v: %d)", x), nil
+	case uint32:
+		return fmt.Sprintf("uint(v: %d)", x), nil
+	case uint64:
+		return fmt.Sprintf("uint(v: %d)", x), nil
+	case float32:
+		return formatFluxFloat(float64(x), 32)
+	case float64:
+		return formatFluxFloat(x, 64)
+	case time.Time:
+		return x.UTC().Format(time.RFC3339Nano), nil
+	case time.Duration:
+		return formatFluxDuration(x), nil
+	}
+	return "", fmt.Errorf("unsupported flux value type %T", v)
+}
+
+// formatFluxFloat Flux 的浮点数字面量必须带小数点，且没有 Inf/NaN 字面量
+func formatFluxFloat(f float64, bitSize int) (string, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", fmt.Errorf("flux has no literal for %v", f)
+	}
+	s := strconv.FormatFloat(f, 'f', -1, bitSize)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s, nil
+}
+
+// formatFluxDuration 将时间间隔格式化为 Flux 持续时间字面量，如 1h30m、250ms
+func formatFluxDuration(d time.Duration) string {
+	if d == 0 {
+		return "0s"
+	}
+	var sb strings.Builder
+	if d < 0 {
+		sb.WriteByte('-')
+		d = -d
+	}
+	for _, unit := range []struct {
+		d    time.Duration
+		name string
+	}{
+		{time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"},
+		{time.Millisecond, "ms"}, {time.Microsecond, "us"}, {time.Nanosecond, "ns"},
+	} {
+		if n := d / unit.d; n > 0 {
+			sb.WriteString(strconv.FormatInt(int64(n), 10))
+			sb.WriteString(unit.name)
+			d -= n * unit.d
+		}
+	}
+	return sb.String()
+}
+
+// fluxEscaper 转义 Flux 字符串中的反斜杠、双引号、插值与控制字符
+var fluxEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", `\${`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// quoteFlux 生成 Flux 字符串字面量
+func quoteFlux(s string) string {
+	return `"` + fluxEscaper.Replace(s) + `"`
+}
+
+func fluxStringArray(values []string) string {
+	quoted := make([]string, len(values))
+	for n, v := range values {
+		quoted[n] = quoteFlux(v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+var fluxIdentifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// fluxKeywords 不能作为 r.xxx 形式访问的关键字
+var fluxKeywords = map[string]bool{
+	"and": true, "builtin": true, "else": true, "exists": true, "if": true, "import": true, "in": true,
+	"not": true, "option": true, "or": true, "package": true, "return": true, "testing": true, "then": true,
+}
+
+func isFluxIdentifier(s string) bool {
+	return fluxIdentifierRe.MatchString(s) && !fluxKeywords[s]
+}
+
+// fluxColumn 生成记录的列引用，非标识符的列名使用 r["..."]
+func fluxColumn(name string) string {
+	if isFluxIdentifier(name) {
+		return "r." + name
+	}
+	return "r[" + quoteFlux(name) + "]"
+}
+
+// QueryFlux 执行构建器生成的查询（内联字面量）
+func (i *InfluxClient) QueryFlux(ctx context.Context, q *FluxQuery) ([]map[string]interface{}, error) {
+	flux, err := q.Flux()
+	if err != nil {
+		return nil, fmt.Errorf("build flux: %w", err)
+	}
+	return i.Query(ctx, flux)
+}
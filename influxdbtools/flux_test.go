@@ -0,0 +1,116 @@
+package influxdbtools
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+func TestFluxQuery_Golden(t *testing.T) {
+	start := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	cases := map[string]*FluxQuery{
+		"range_last": NewFluxQuery("weather").RangeLast(90 * time.Minute),
+		"filters": NewFluxQuery("weather").
+			Range(start, start.Add(6*time.Hour)).
+			Measurement("weather").
+			Tag("location", "sensor-1", "sensor-2").
+			Tag("wind dir", "N").
+			Fields("temperature", "humidity").
+			Where("_value", OpGt, 30.0).
+			Where("count", OpLe, int64(10)),
+		"escaping": NewFluxQuery(`b"ucket`).
+			RangeLast(time.Hour).
+			Measurement(`cpu\load`).
+			Tag("host", "a\"b${c}\nd").
+			Tag("in", "x"),
+		"aggregate": NewFluxQuery("metrics").
+			Range(start, time.Time{}).
+			Measurement("cpu").
+			AggregateWindow(5*time.Minute+30*time.Second, AggMean, false).
+			Group("host").
+			PivotFields().
+			Sort(true, "_time").
+			Limit(100),
+		"group_all": NewFluxQuery("metrics").RangeLast(24 * time.Hour).Group().Sort(false).Limit(1),
+	}
+
+	for name, q := range cases {
+		t.Run(name, func(t *testing.T) {
+			flux, err := q.Flux()
+			if err != nil {
+				t.Fatal(err)
+			}
+			pflux, params, err := q.Params()
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded, err := json.MarshalIndent(params, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := flux + "\n\n// params\n" + pflux + "\n\n" + string(encoded) + "\n"
+
+			path := filepath.Join("testdata", "flux", name+".golden")
+			if *updateGolden {
+				if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("read golden file (run with -update to create): %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("output differs from %s\n got:\n%s\nwant:\n%s", path, got, want)
+			}
+		})
+	}
+}
+
+func TestFluxQuery_Errors(t *testing.T) {
+	cases := map[string]*FluxQuery{
+		"empty bucket":   NewFluxQuery(""),
+		"zero start":     NewFluxQuery("b").Range(time.Time{}, time.Time{}),
+		"stop <= start":  NewFluxQuery("b").Range(time.Unix(10, 0), time.Unix(5, 0)),
+		"no tag values":  NewFluxQuery("b").Tag("host"),
+		"bad operator":   NewFluxQuery("b").Where("_value", "=~", "x"),
+		"bad value type": NewFluxQuery("b").Where("_value", OpEq, []int{1}),
+		"nan":            NewFluxQuery("b").Where("_value", OpEq, nan()),
+		"bad aggregate":  NewFluxQuery("b").AggregateWindow(time.Minute, "mean)", false),
+		"zero limit":     NewFluxQuery("b").Limit(0),
+	}
+	for name, q := range cases {
+		if _, err := q.Flux(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+		if _, _, err := q.Params(); err == nil {
+			t.Errorf("%s: expected error from Params", name)
+		}
+	}
+}
+
+func nan() float64 {
+	zero := 0.0
+	return zero / zero
+}
+
+func TestFormatFluxDuration(t *testing.T) {
+	cases := map[time.Duration]string{
+		0:                                   "0s",
+		time.Hour:                           "1h",
+		90 * time.Minute:                    "1h30m",
+		1500 * time.Millisecond:             "1s500ms",
+		-2*time.Second - 3*time.Microsecond: "-2s3us",
+		26*time.Hour + 7*time.Nanosecond:    "26h7ns",
+	}
+	for d, want := range cases {
+		if got := formatFluxDuration(d); got != want {
+			t.Errorf("formatFluxDuration(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -3,13 +3,14 @@ package influxdbtools
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	influxapi "github.com/influxdata/influxdb-client-go/v2/api"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
-	"github.com/influxdata/influxdb-client-go/v2/domain"
 )
 
 // InfluxConfig InfluxDB集群配置
@@ -23,7 +24,8 @@ type InfluxConfig struct {
 	// 可选项
 	UseGzip       bool          `json:"use_gzip,omitempty"`
 	TLSSkipVerify bool          `json:"tls_skip_verify,omitempty"`
-	PingTimeout   time.Duration `json:"ping_timeout,omitempty"` // 连接探活超时
+	PingTimeout   time.Duration `json:"ping_timeout,omitempty"`  // 连接探活超时
+	FlushTimeout  time.Duration `json:"flush_timeout,omitempty"` // Close 时等待 AsyncWriter 写完剩余数据的超时，默认30秒
 }
 
 type InfluxClient struct {
@@ -31,6 +33,10 @@ type InfluxClient struct {
 	client   influxdb2.Client
 	writeAPI influxapi.WriteAPIBlocking
 	queryAPI influxapi.QueryAPI
+
+	mu         sync.Mutex
+	writers    []*AsyncWriter // 由 NewAsyncWriter 创建，Close 时一并关闭
+	orgIDCache string
 }
 
 // initialize 初始化InfluxDB客户端
@@ -100,44 +106,63 @@ func NewInfluxClient(cfg *InfluxConfig) (*InfluxClient, error) {
 	return client, nil
 }
 
-// Close 关闭InfluxDB客户端
+// Close 关闭InfluxDB客户端，先关闭由它创建的 AsyncWriter 并在 FlushTimeout 内写完剩余数据
 func (i *InfluxClient) Close() error {
+	i.mu.Lock()
+	writers := i.writers
+	i.writers = nil
+	i.mu.Unlock()
+
+	var errs []error
+	if len(writers) > 0 {
+		timeout := i.config.FlushTimeout
+		if timeout <= 0 {
+			timeout = 30 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		for _, w := range writers {
+			if err := w.Close(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
 	if i.client != nil {
 		i.client.Close()
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 // -------- 写入功能 --------
 
-// WritePoint 写入单个数据点（使用官方类型）
-func (i *InfluxClient) WritePoint(p *write.Point) error {
+// WritePoint 同步写入单个数据点（使用官方类型），不需要阻塞调用方时使用 NewAsyncWriter
+func (i *InfluxClient) WritePoint(ctx context.Context, p *write.Point) error {
 	if i.writeAPI == nil {
 		return fmt.Errorf("influx write api not initialized")
 	}
-	return i.writeAPI.WritePoint(context.Background(), p)
+	return i.writeAPI.WritePoint(ctx, p)
 }
 
-// WriteBatch 批量写入数据点
-func (i *InfluxClient) WriteBatch(points []*write.Point) error {
+// WriteBatch 同步批量写入数据点
+func (i *InfluxClient) WriteBatch(ctx context.Context, points []*write.Point) error {
 	if len(points) == 0 {
 		return nil
 	}
 	if i.writeAPI == nil {
 		return fmt.Errorf("influx write api not initialized")
 	}
-	return i.writeAPI.WritePoint(context.Background(), points...)
+	return i.writeAPI.WritePoint(ctx, points...)
 }
 
-// WriteLineProtocol 以Line Protocol写入
-func (i *InfluxClient) WriteLineProtocol(lines []string) error {
+// WriteLineProtocol 以Line Protocol同步写入
+func (i *InfluxClient) WriteLineProtocol(ctx context.Context, lines []string) error {
 	if len(lines) == 0 {
 		return nil
 	}
 	if i.writeAPI == nil {
 		return fmt.Errorf("influx write api not initialized")
 	}
-	return i.writeAPI.WriteRecord(context.Background(), lines...)
+	return i.writeAPI.WriteRecord(ctx, lines...)
 }
 
 // -------- 查询功能 --------
@@ -151,6 +176,24 @@ func (i *InfluxClient) Query(ctx context.Context, flux string) ([]map[string]int
 	if err != nil {
 		return nil, fmt.Errorf("query influxdb: %w", err)
 	}
+	return collectRows(res)
+}
+
+// QueryWithParams 执行参数化Flux查询，查询中通过 params.xxx 引用参数，params 为 map 或结构体
+// 参数化查询仅 InfluxDB Cloud 支持
+func (i *InfluxClient) QueryWithParams(ctx context.Context, flux string, params interface{}) ([]map[string]interface{}, error) {
+	if i.queryAPI == nil {
+		return nil, fmt.Errorf("influx query api not initialized")
+	}
+	res, err := i.queryAPI.QueryWithParams(ctx, flux, params)
+	if err != nil {
+		return nil, fmt.Errorf("query influxdb: %w", err)
+	}
+	return collectRows(res)
+}
+
+// collectRows 读取全部记录，返回每行记录的值映射
+func collectRows(res *influxapi.QueryTableResult) ([]map[string]interface{}, error) {
 	defer res.Close()
 
 	var rows []map[string]interface{}
@@ -176,16 +219,9 @@ func (i *InfluxClient) Query(ctx context.Context, flux string) ([]map[string]int
 
 // ensureBucketExists 确保Bucket存在（失败仅警告，不中断功能）
 func (i *InfluxClient) ensureBucketExists(ctx context.Context) error {
-	if i.client == nil {
-		return fmt.Errorf("influx client not initialized")
-	}
-	buckets := i.client.BucketsAPI()
-	if buckets == nil {
-		return fmt.Errorf("buckets api not available")
-	}
-	b, err := buckets.FindBucketByName(ctx, i.config.Bucket)
+	b, err := i.findBucket(ctx, i.config.Bucket)
 	if err != nil {
-		return fmt.Errorf("find bucket: %w", err)
+		return err
 	}
 	if b != nil {
 		return nil
@@ -193,20 +229,8 @@ func (i *InfluxClient) ensureBucketExists(ctx context.Context) error {
 
 	// 不存在则打印警告并创建
 	fmt.Printf("Warning: bucket %q not found in org %q, creating...\n", i.config.Bucket, i.config.Org)
-	orgAPI := i.client.OrganizationsAPI()
-	if orgAPI == nil {
-		return fmt.Errorf("organizations api not available")
-	}
-	var org *domain.Organization
-	org, err = orgAPI.FindOrganizationByName(ctx, i.config.Org)
-	if err != nil {
-		return fmt.Errorf("find organization %s: %w", i.config.Org, err)
-	}
-	if org == nil {
-		return fmt.Errorf("organization %s not found", i.config.Org)
-	}
-	if _, err := buckets.CreateBucketWithName(ctx, org, i.config.Bucket); err != nil {
-		return fmt.Errorf("create bucket %s: %w", i.config.Bucket, err)
+	if _, err := i.CreateBucket(ctx, BucketSpec{Name: i.config.Bucket}); err != nil {
+		return err
 	}
 	fmt.Printf("Info: bucket %q created successfully.\n", i.config.Bucket)
 	return nil
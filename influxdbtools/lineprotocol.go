@@ -0,0 +1,891 @@
+package influxdbtools
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+// -------- Line Protocol 解析与编码 --------
+//
+// 转义规则：
+//   - measurement：逗号与空格需要以反斜杠转义
+//   - tag 的键与值、field 的键：逗号、等号与空格需要转义
+//   - 字符串 field 值：双引号与反斜杠需要转义，其余字符（包括换行）原样保留
+//   - 除字符串 field 值外不能包含换行，反斜杠也不能位于结尾或需转义的字符之前，编码器拒绝这类名字与值
+//
+// 其他位置的反斜杠按普通字符处理。解析得到的键与值都是输入中的原始字节（仍带转义），
+// 不复制也不分配内存，需要明文时使用 AppendUnescaped 系列函数
+
+// FieldType field 值的类型
+type FieldType int
+
+const (
+	FieldFloat FieldType = iota
+	FieldInt
+	FieldUint
+	FieldBool
+	FieldString
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case FieldFloat:
+		return "float"
+	case FieldInt:
+		return "int"
+	case FieldUint:
+		return "uint"
+	case FieldBool:
+		return "bool"
+	case FieldString:
+		return "string"
+	}
+	return fmt.Sprintf("FieldType(%d)", int(t))
+}
+
+// LineTag 一个 tag，Key 与 Value 为带转义的原始字节
+type LineTag struct {
+	Key   []byte
+	Value []byte
+}
+
+// LineField 一个 field，按 Type 读取对应的值；Key 与 Str 为带转义的原始字节（Str 不含引号）
+type LineField struct {
+	Key   []byte
+	Type  FieldType
+	Int   int64
+	Uint  uint64
+	Float float64
+	Bool  bool
+	Str   []byte
+}
+
+// Line 一行数据点，由 LineParser 复用，下次调用 Next 后失效
+type Line struct {
+	Measurement []byte // 带转义的原始字节
+	Tags        []LineTag
+	Fields      []LineField
+	Timestamp   int64 // 写入方精度下的时间戳，HasTime 为false时无意义
+	HasTime     bool
+}
+
+// Time 按 precision 将时间戳转换为 time.Time，没有时间戳时返回零值
+func (l *Line) Time(precision time.Duration) time.Time {
+	if !l.HasTime {
+		return time.Time{}
+	}
+	switch precision {
+	case time.Second:
+		return time.Unix(l.Timestamp, 0)
+	case time.Millisecond:
+		return time.UnixMilli(l.Timestamp)
+	case time.Microsecond:
+		return time.UnixMicro(l.Timestamp)
+	}
+	return time.Unix(0, l.Timestamp)
+}
+
+// Tag 按明文键查找 tag，返回带转义的原始值
+func (l *Line) Tag(key string) ([]byte, bool) {
+	for _, t := range l.Tags {
+		if equalUnescaped(t.Key, key, keyEscapes) {
+			return t.Value, true
+		}
+	}
+	return nil, false
+}
+
+// SetTag 设置 tag 的明文键与值，已存在时替换，否则追加
+// 键或值为空、或无法用 Line Protocol 表示时返回错误，tag 保持不变；删除 tag 使用 DeleteTag
+func (l *Line) SetTag(key, value string) error {
+	if key == "" || value == "" {
+		return fmt.Errorf("tag %q=%q: key and value cannot be empty", key, value)
+	}
+	if !encodable(key, keyEscapes) || !encodable(value, keyEscapes) {
+		return fmt.Errorf("tag %q=%q cannot be encoded: newline or backslash before a separator", key, value)
+	}
+	v := appendEscaped(nil, value, keyEscapes)
+	for n := range l.Tags {
+		if equalUnescaped(l.Tags[n].Key, key, keyEscapes) {
+			l.Tags[n].Value = v
+			return nil
+		}
+	}
+	l.Tags = append(l.Tags, LineTag{Key: appendEscaped(nil, key, keyEscapes), Value: v})
+	return nil
+}
+
+// DeleteTag 删除 tag，返回是否存在
+func (l *Line) DeleteTag(key string) bool {
+	for n := range l.Tags {
+		if equalUnescaped(l.Tags[n].Key, key, keyEscapes) {
+			l.Tags = slices.Delete(l.Tags, n, n+1)
+			return true
+		}
+	}
+	return false
+}
+
+// SortTags 按键排序 tag，InfluxDB 推荐写入排序后的 tag 以提升性能
+func (l *Line) SortTags() {
+	slices.SortFunc(l.Tags, func(a, b LineTag) int { return bytes.Compare(a.Key, b.Key) })
+}
+
+// LineParseError 解析错误，Line 与 Column 从1开始，Column 按字节计数
+type LineParseError struct {
+	Line   int
+	Column int
+	Offset int // 在整个输入中的字节偏移
+	Msg    string
+}
+
+func (e *LineParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// LineParser 逐行解析 Line Protocol
+// 示例：
+//
+//	p := NewLineParser(body)
+//	for {
+//		line, err := p.Next()
+//		if err == io.EOF {
+//			break
+//		}
+//		if err != nil {
+//			return err // *LineParseError，包含行号与列号
+//		}
+//		...
+//	}
+type LineParser struct {
+	data      []byte
+	pos       int
+	lineNo    int
+	lineStart int
+	line      Line
+}
+
+// NewLineParser 创建解析器，data 在解析期间不能修改
+func NewLineParser(data []byte) *LineParser {
+	return &LineParser{data: data}
+}
+
+// Next 解析下一行数据点，跳过空行与以 # 开头的注释行；没有更多数据时返回 io.EOF
+// 出错时返回 *LineParseError，并跳到下一行，可以继续调用 Next
+func (p *LineParser) Next() (*Line, error) {
+	for p.pos < len(p.data) {
+		p.lineNo++
+		p.lineStart = p.pos
+		p.skip(' ', '\t')
+		if p.pos >= len(p.data) {
+			break
+		}
+		switch p.data[p.pos] {
+		case '\n':
+			p.pos++
+			continue
+		case '\r':
+			if p.pos+1 < len(p.data) && p.data[p.pos+1] == '\n' {
+				p.pos += 2
+				continue
+			}
+		case '#':
+			p.skipLine()
+			continue
+		}
+
+		if err := p.parseLine(); err != nil {
+			p.skipLine()
+			return nil, err
+		}
+		return &p.line, nil
+	}
+	return nil, io.EOF
+}
+
+func (p *LineParser) errorf(pos int, format string, args ...any) error {
+	return &LineParseError{Line: p.lineNo, Column: pos - p.lineStart + 1, Offset: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *LineParser) skip(chars ...byte) {
+	for p.pos < len(p.data) && slices.Contains(chars, p.data[p.pos]) {
+		p.pos++
+	}
+}
+
+// skipLine 跳到下一行开头，字符串 field 中的换行不作为行尾
+func (p *LineParser) skipLine() {
+	inString := false
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch {
+		case c == '\\' && inString:
+			p.pos++
+		case c == '"':
+			inString = !inString
+		case c == '\n' && !inString:
+			return
+		}
+	}
+}
+
+func (p *LineParser) atLineEnd() bool {
+	if p.pos >= len(p.data) {
+		return true
+	}
+	c := p.data[p.pos]
+	return c == '\n' || (c == '\r' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '\n')
+}
+
+// token 读取到未转义的分隔符为止，返回原始字节；遇到行尾或输入结束时停止
+func (p *LineParser) token(delims string) []byte {
+	start := p.pos
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == '\\' && p.pos+1 < len(p.data) && p.data[p.pos+1] != '\n' {
+			p.pos += 2
+			continue
+		}
+		if c == '\n' || (c == '\r' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '\n') {
+			break
+		}
+		if indexByte(delims, c) >= 0 {
+			break
+		}
+		p.pos++
+	}
+	return p.data[start:p.pos]
+}
+
+func (p *LineParser) parseLine() error {
+	l := &p.line
+	l.Tags, l.Fields = l.Tags[:0], l.Fields[:0]
+	l.Timestamp, l.HasTime = 0, false
+
+	// measurement
+	start := p.pos
+	l.Measurement = p.token(", ")
+	if len(l.Measurement) == 0 {
+		return p.errorf(start, "missing measurement")
+	}
+	if p.atLineEnd() {
+		return p.errorf(p.pos, "missing fields")
+	}
+
+	// tags
+	for p.data[p.pos] == ',' {
+		p.pos++
+		keyStart := p.pos
+		key := p.token(",= ")
+		if len(key) == 0 {
+			return p.errorf(keyStart, "missing tag key")
+		}
+		if p.atLineEnd() || p.data[p.pos] != '=' {
+			return p.errorf(p.pos, "expected '=' after tag key %q", key)
+		}
+		p.pos++
+		valueStart := p.pos
+		value := p.token(",= ")
+		if len(value) == 0 {
+			return p.errorf(valueStart, "missing value for tag %q", key)
+		}
+		if !p.atLineEnd() && p.data[p.pos] == '=' {
+			return p.errorf(p.pos, "unexpected '=' in value of tag %q", key)
+		}
+		l.Tags = append(l.Tags, LineTag{Key: key, Value: value})
+		if p.atLineEnd() {
+			return p.errorf(p.pos, "missing fields")
+		}
+	}
+	if p.data[p.pos] != ' ' {
+		return p.errorf(p.pos, "unexpected character %q", p.data[p.pos])
+	}
+	p.skip(' ')
+	if p.atLineEnd() {
+		return p.errorf(p.pos, "missing fields")
+	}
+
+	// fields
+	for {
+		keyStart := p.pos
+		key := p.token(",= ")
+		if len(key) == 0 {
+			return p.errorf(keyStart, "missing field key")
+		}
+		if p.atLineEnd() || p.data[p.pos] != '=' {
+			return p.errorf(p.pos, "expected '=' after field key %q", key)
+		}
+		p.pos++
+		f := LineField{Key: key}
+		if err := p.parseFieldValue(&f); err != nil {
+			return err
+		}
+		l.Fields = append(l.Fields, f)
+		if p.atLineEnd() || p.data[p.pos] != ',' {
+			break
+		}
+		p.pos++
+	}
+
+	// timestamp
+	if !p.atLineEnd() {
+		if p.data[p.pos] != ' ' {
+			return p.errorf(p.pos, "unexpected character %q after field", p.data[p.pos])
+		}
+		p.skip(' ')
+		if !p.atLineEnd() {
+			tsStart := p.pos
+			for p.pos < len(p.data) && p.data[p.pos] != ' ' && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+			ts, ok := parseInt(p.data[tsStart:p.pos])
+			if !ok {
+				return p.errorf(tsStart, "invalid timestamp %q", p.data[tsStart:p.pos])
+			}
+			l.Timestamp, l.HasTime = ts, true
+			p.skip(' ')
+			if !p.atLineEnd() {
+				return p.errorf(p.pos, "unexpected data after timestamp")
+			}
+		}
+	}
+
+	// 消费行尾
+	if p.pos < len(p.data) {
+		if p.data[p.pos] == '\r' {
+			p.pos++
+		}
+		p.pos++
+	}
+	return nil
+}
+
+func (p *LineParser) parseFieldValue(f *LineField) error {
+	start := p.pos
+	if p.pos < len(p.data) && p.data[p.pos] == '"' {
+		p.pos++
+		for p.pos < len(p.data) && p.data[p.pos] != '"' {
+			if p.data[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= len(p.data) {
+			return p.errorf(start, "unterminated string value for field %q", f.Key)
+		}
+		f.Type, f.Str = FieldString, p.data[start+1:p.pos]
+		p.pos++
+		return nil
+	}
+
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == ',' || c == ' ' || c == '\n' || c == '\r' {
+			break
+		}
+		p.pos++
+	}
+	raw := p.data[start:p.pos]
+	if len(raw) == 0 {
+		return p.errorf(start, "missing value for field %q", f.Key)
+	}
+
+	var ok bool
+	switch last := raw[len(raw)-1]; {
+	case raw[0] == 't' || raw[0] == 'T' || raw[0] == 'f' || raw[0] == 'F':
+		f.Type = FieldBool
+		f.Bool, ok = parseBool(raw)
+	case last == 'i':
+		f.Type = FieldInt
+		f.Int, ok = parseInt(raw[:len(raw)-1])
+	case last == 'u':
+		f.Type = FieldUint
+		f.Uint, ok = parseUint(raw[:len(raw)-1])
+	default:
+		f.Type = FieldFloat
+		f.Float, ok = parseFloat(raw)
+	}
+	if !ok {
+		return p.errorf(start, "invalid %s value %q for field %q", f.Type, raw, f.Key)
+	}
+	return nil
+}
+
+func parseUint(b []byte) (uint64, bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+	var n uint64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		d := uint64(c - '0')
+		if n > (math.MaxUint64-d)/10 {
+			return 0, false
+		}
+		n = n*10 + d
+	}
+	return n, true
+}
+
+func parseInt(b []byte) (int64, bool) {
+	neg := len(b) > 0 && b[0] == '-'
+	if neg {
+		b = b[1:]
+	}
+	u, ok := parseUint(b)
+	if !ok {
+		return 0, false
+	}
+	if neg {
+		if u > 1<<63 {
+			return 0, false
+		}
+		return -int64(u), true
+	}
+	if u > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(u), true
+}
+
+func parseBool(b []byte) (bool, bool) {
+	switch string(b) {
+	case "t", "T", "true", "True", "TRUE":
+		return true, true
+	case "f", "F", "false", "False", "FALSE":
+		return false, true
+	}
+	return false, false
+}
+
+// parseFloat 只接受十进制形式，拒绝 strconv 额外支持的 Inf、NaN、十六进制与下划线
+func parseFloat(b []byte) (float64, bool) {
+	digits := false
+	for _, c := range b {
+		switch {
+		case c >= '0' && c <= '9':
+			digits = true
+		case c == '.' || c == 'e' || c == 'E' || c == '+' || c == '-':
+		default:
+			return 0, false
+		}
+	}
+	if !digits {
+		return 0, false
+	}
+	// 错误信息会引用字符串，这里只取结果，不保留 err，因此不会逃逸
+	f, err := strconv.ParseFloat(unsafe.String(unsafe.SliceData(b), len(b)), 64)
+	if err != nil || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// ValidateLineProtocol 校验整段 Line Protocol，返回数据点行数与第一个错误
+func ValidateLineProtocol(data []byte) (int, error) {
+	p := NewLineParser(data)
+	n := 0
+	for {
+		_, err := p.Next()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// -------- 转义 --------
+
+const (
+	measurementEscapes = ", "
+	keyEscapes         = ",= "
+	stringEscapes      = `"\`
+)
+
+func indexByte(s string, c byte) int {
+	for n := 0; n < len(s); n++ {
+		if s[n] == c {
+			return n
+		}
+	}
+	return -1
+}
+
+func appendEscaped(dst []byte, s string, escapes string) []byte {
+	for n := 0; n < len(s); n++ {
+		if indexByte(escapes, s[n]) >= 0 {
+			dst = append(dst, '\\')
+		}
+		dst = append(dst, s[n])
+	}
+	return dst
+}
+
+func appendUnescaped(dst, raw []byte, escapes string) []byte {
+	for n := 0; n < len(raw); n++ {
+		if raw[n] == '\\' && n+1 < len(raw) && indexByte(escapes, raw[n+1]) >= 0 {
+			n++
+		}
+		dst = append(dst, raw[n])
+	}
+	return dst
+}
+
+// equalUnescaped 比较原始字节解除转义后是否等于 s，不分配内存
+func equalUnescaped(raw []byte, s string, escapes string) bool {
+	n := 0
+	for m := 0; m < len(raw); m++ {
+		if raw[m] == '\\' && m+1 < len(raw) && indexByte(escapes, raw[m+1]) >= 0 {
+			m++
+		}
+		if n >= len(s) || s[n] != raw[m] {
+			return false
+		}
+		n++
+	}
+	return n == len(s)
+}
+
+// AppendUnescapedMeasurement 将 measurement 的原始字节解除转义后追加到 dst
+func AppendUnescapedMeasurement(dst, raw []byte) []byte {
+	return appendUnescaped(dst, raw, measurementEscapes)
+}
+
+// AppendUnescapedKey 将 tag 键、tag 值或 field 键的原始字节解除转义后追加到 dst
+func AppendUnescapedKey(dst, raw []byte) []byte {
+	return appendUnescaped(dst, raw, keyEscapes)
+}
+
+// AppendUnescapedString 将字符串 field 值的原始字节解除转义后追加到 dst
+func AppendUnescapedString(dst, raw []byte) []byte {
+	return appendUnescaped(dst, raw, stringEscapes)
+}
+
+// -------- 编码 --------
+
+// LineEncoder 将数据点编码为 Line Protocol，缓冲区可通过 Reset 复用
+// 每行按 StartLine、AddTag、AddField*、EndLine 的顺序调用；出错后后续调用均被忽略，通过 Err 获取第一个错误
+// 示例：
+//
+//	e := NewLineEncoder(time.Millisecond)
+//	e.StartLine("cpu")
+//	e.AddTag("host", "web 1")
+//	e.AddFieldFloat("usage", 0.5)
+//	e.EndLine(time.Now())
+//	body, err := e.Bytes(), e.Err()
+type LineEncoder struct {
+	buf       []byte
+	precision time.Duration
+	lineStart int
+	section   int // 0：行外，1：measurement 与 tag，2：field
+	err       error
+}
+
+// NewLineEncoder 创建编码器，precision 为时间戳精度：time.Nanosecond、Microsecond、Millisecond 或 Second
+func NewLineEncoder(precision time.Duration) *LineEncoder {
+	return &LineEncoder{precision: precision, err: checkPrecision(precision)}
+}
+
+func checkPrecision(precision time.Duration) error {
+	switch precision {
+	case time.Nanosecond, time.Microsecond, time.Millisecond, time.Second:
+		return nil
+	}
+	return fmt.Errorf("unsupported precision %s", precision)
+}
+
+// Bytes 返回已编码的完整行，每行以换行结尾
+func (e *LineEncoder) Bytes() []byte {
+	return e.buf[:e.lineStart]
+}
+
+// Err 返回第一个编码错误
+func (e *LineEncoder) Err() error {
+	return e.err
+}
+
+// Reset 清空缓冲区与错误，保留已分配的内存；精度不受支持的错误不会被清除
+func (e *LineEncoder) Reset() {
+	e.buf, e.lineStart, e.section = e.buf[:0], 0, 0
+	e.err = checkPrecision(e.precision)
+}
+
+func (e *LineEncoder) fail(format string, args ...any) {
+	if e.err == nil {
+		e.err = fmt.Errorf(format, args...)
+	}
+	e.buf, e.section = e.buf[:e.lineStart], 0
+}
+
+// encodable 判断 measurement、键或 tag 值能否用 Line Protocol 表示：换行无法转义；
+// 位于结尾或需转义字符之前的反斜杠会与其后的分隔符或转义符组成转义序列，解析结果与原值不同
+func encodable(s, escapes string) bool {
+	for n := 0; n < len(s); n++ {
+		switch {
+		case s[n] == '\n':
+			return false
+		case s[n] == '\\' && (n+1 == len(s) || indexByte(escapes, s[n+1]) >= 0):
+			return false
+		}
+	}
+	return true
+}
+
+// validEscaped 判断带转义的原始字节能否原样写入：escapes 中的字符都已转义，不含换行，也不以单独的反斜杠结尾
+func validEscaped(raw []byte, escapes string) bool {
+	for n := 0; n < len(raw); n++ {
+		switch c := raw[n]; {
+		case c == '\\' && n+1 < len(raw) && raw[n+1] != '\n':
+			n++
+		case c == '\\' || c == '\n' || indexByte(escapes, c) >= 0:
+			return false
+		}
+	}
+	return true
+}
+
+// StartLine 开始新的一行
+func (e *LineEncoder) StartLine(measurement string) {
+	if e.err != nil {
+		return
+	}
+	if e.section != 0 {
+		e.fail("StartLine called before EndLine")
+		return
+	}
+	if measurement == "" {
+		e.fail("measurement cannot be empty")
+		return
+	}
+	if !encodable(measurement, measurementEscapes) {
+		e.fail("measurement %q cannot be encoded: newline or backslash before a separator", measurement)
+		return
+	}
+	e.buf = appendEscaped(e.buf, measurement, measurementEscapes)
+	e.section = 1
+}
+
+// AddTag 添加 tag，需在所有 field 之前调用；空值的 tag 在 Line Protocol 中无法表示，直接忽略
+func (e *LineEncoder) AddTag(key, value string) {
+	if e.err != nil {
+		return
+	}
+	if e.section != 1 {
+		e.fail("AddTag %q must follow StartLine and precede fields", key)
+		return
+	}
+	if key == "" {
+		e.fail("tag key cannot be empty")
+		return
+	}
+	if !encodable(key, keyEscapes) || !encodable(value, keyEscapes) {
+		e.fail("tag %q=%q cannot be encoded: newline or backslash before a separator", key, value)
+		return
+	}
+	if value == "" {
+		return
+	}
+	e.buf = append(e.buf, ',')
+	e.buf = appendEscaped(e.buf, key, keyEscapes)
+	e.buf = append(e.buf, '=')
+	e.buf = appendEscaped(e.buf, value, keyEscapes)
+}
+
+// fieldKey 写入 field 键及前面的分隔符
+func (e *LineEncoder) fieldKey(key string) bool {
+	if e.err != nil {
+		return false
+	}
+	switch {
+	case e.section == 0:
+		e.fail("field %q added outside a line", key)
+		return false
+	case key == "":
+		e.fail("field key cannot be empty")
+		return false
+	case !encodable(key, keyEscapes):
+		e.fail("field key %q cannot be encoded: newline or backslash before a separator", key)
+		return false
+	case e.section == 1:
+		e.buf = append(e.buf, ' ')
+		e.section = 2
+	default:
+		e.buf = append(e.buf, ',')
+	}
+	e.buf = appendEscaped(e.buf, key, keyEscapes)
+	e.buf = append(e.buf, '=')
+	return true
+}
+
+// AddFieldFloat 添加浮点数 field，不支持 NaN 与 Inf
+func (e *LineEncoder) AddFieldFloat(key string, value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		if e.err == nil {
+			e.fail("field %q: %v is not supported", key, value)
+		}
+		return
+	}
+	if e.fieldKey(key) {
+		e.buf = strconv.AppendFloat(e.buf, value, 'g', -1, 64)
+	}
+}
+
+// AddFieldInt 添加整数 field
+func (e *LineEncoder) AddFieldInt(key string, value int64) {
+	if e.fieldKey(key) {
+		e.buf = strconv.AppendInt(e.buf, value, 10)
+		e.buf = append(e.buf, 'i')
+	}
+}
+
+// AddFieldUint 添加无符号整数 field
+func (e *LineEncoder) AddFieldUint(key string, value uint64) {
+	if e.fieldKey(key) {
+		e.buf = strconv.AppendUint(e.buf, value, 10)
+		e.buf = append(e.buf, 'u')
+	}
+}
+
+// AddFieldBool 添加布尔 field
+func (e *LineEncoder) AddFieldBool(key string, value bool) {
+	if e.fieldKey(key) {
+		e.buf = strconv.AppendBool(e.buf, value)
+	}
+}
+
+// AddFieldString 添加字符串 field
+func (e *LineEncoder) AddFieldString(key, value string) {
+	if e.fieldKey(key) {
+		e.buf = append(e.buf, '"')
+		e.buf = appendEscaped(e.buf, value, stringEscapes)
+		e.buf = append(e.buf, '"')
+	}
+}
+
+// EndLine 结束当前行，t 为零值时不写时间戳，由服务端使用写入时间
+func (e *LineEncoder) EndLine(t time.Time) {
+	if e.err != nil {
+		return
+	}
+	if e.section != 2 {
+		e.fail("line must have at least one field")
+		return
+	}
+	if !t.IsZero() {
+		ts, ok := timestampAt(t, e.precision)
+		if !ok {
+			e.fail("time %s out of range for precision %s", t, e.precision)
+			return
+		}
+		e.buf = append(e.buf, ' ')
+		e.buf = strconv.AppendInt(e.buf, ts, 10)
+	}
+	e.endLine()
+}
+
+func (e *LineEncoder) endLine() {
+	e.buf = append(e.buf, '\n')
+	e.lineStart, e.section = len(e.buf), 0
+}
+
+// AppendLine 写入解析得到的一行，键与值按原始字节写入，时间戳原样写入（需与编码器精度一致）
+func (e *LineEncoder) AppendLine(l *Line) {
+	if e.err != nil {
+		return
+	}
+	if e.section != 0 {
+		e.fail("AppendLine called before EndLine")
+		return
+	}
+	if len(l.Measurement) == 0 || len(l.Fields) == 0 {
+		e.fail("line must have a measurement and at least one field")
+		return
+	}
+	if !validEscaped(l.Measurement, measurementEscapes) {
+		e.fail("measurement %q is not properly escaped", l.Measurement)
+		return
+	}
+	e.buf = append(e.buf, l.Measurement...)
+	for _, t := range l.Tags {
+		if len(t.Key) == 0 || len(t.Value) == 0 {
+			e.fail("tag with empty key or value")
+			return
+		}
+		if !validEscaped(t.Key, keyEscapes) || !validEscaped(t.Value, keyEscapes) {
+			e.fail("tag %q=%q is not properly escaped", t.Key, t.Value)
+			return
+		}
+		e.buf = append(e.buf, ',')
+		e.buf = append(e.buf, t.Key...)
+		e.buf = append(e.buf, '=')
+		e.buf = append(e.buf, t.Value...)
+	}
+	for n, f := range l.Fields {
+		if n == 0 {
+			e.buf = append(e.buf, ' ')
+		} else {
+			e.buf = append(e.buf, ',')
+		}
+		if len(f.Key) == 0 || !validEscaped(f.Key, keyEscapes) {
+			e.fail("field key %q is empty or not properly escaped", f.Key)
+			return
+		}
+		e.buf = append(e.buf, f.Key...)
+		e.buf = append(e.buf, '=')
+		switch f.Type {
+		case FieldFloat:
+			if math.IsNaN(f.Float) || math.IsInf(f.Float, 0) {
+				e.fail("field %q: %v is not supported", f.Key, f.Float)
+				return
+			}
+			e.buf = strconv.AppendFloat(e.buf, f.Float, 'g', -1, 64)
+		case FieldInt:
+			e.buf = strconv.AppendInt(e.buf, f.Int, 10)
+			e.buf = append(e.buf, 'i')
+		case FieldUint:
+			e.buf = strconv.AppendUint(e.buf, f.Uint, 10)
+			e.buf = append(e.buf, 'u')
+		case FieldBool:
+			e.buf = strconv.AppendBool(e.buf, f.Bool)
+		case FieldString:
+			e.buf = append(e.buf, '"')
+			e.buf = append(e.buf, f.Str...)
+			e.buf = append(e.buf, '"')
+		default:
+			e.fail("field %q: unknown type %d", f.Key, f.Type)
+			return
+		}
+	}
+	if l.HasTime {
+		e.buf = append(e.buf, ' ')
+		e.buf = strconv.AppendInt(e.buf, l.Timestamp, 10)
+	}
+	e.endLine()
+}
+
+// timestampAt 将时间转换为指定精度的时间戳，超出 int64 范围时返回false
+func timestampAt(t time.Time, precision time.Duration) (int64, bool) {
+	sec, nsec := t.Unix(), int64(t.Nanosecond())
+	perSec := int64(time.Second / precision)
+	if sec > math.MaxInt64/perSec-1 || sec < math.MinInt64/perSec+1 {
+		return 0, false
+	}
+	ts := sec * perSec
+	frac := nsec / int64(precision)
+	if ts > math.MaxInt64-frac {
+		return 0, false
+	}
+	return ts + frac, true
+}
@@ -0,0 +1,364 @@
+package influxdbtools
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLineParser_Fields(t *testing.T) {
+	data := "# 注释\n\n" +
+		`weather\ station,site=north\,1,loc\=x=a\ b temp=21.5,hum=40i,cnt=7u,ok=T,bad=false,note="say \"hi\"\\ ok",neg=-3i,exp=1e3 1700000000000` + "\r\n" +
+		"cpu value=1\n"
+	p := NewLineParser([]byte(data))
+
+	line, err := p.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(AppendUnescapedMeasurement(nil, line.Measurement)); got != "weather station" {
+		t.Errorf("unexpected measurement %q", got)
+	}
+	if len(line.Tags) != 2 {
+		t.Fatalf("expected 2 tags, got %d", len(line.Tags))
+	}
+	if v, ok := line.Tag("site"); !ok || string(AppendUnescapedKey(nil, v)) != "north,1" {
+		t.Errorf("unexpected site tag %q", v)
+	}
+	if v, ok := line.Tag("loc=x"); !ok || string(AppendUnescapedKey(nil, v)) != "a b" {
+		t.Errorf("unexpected loc=x tag %q", v)
+	}
+
+	fields := map[string]LineField{}
+	for _, f := range line.Fields {
+		fields[string(f.Key)] = f
+	}
+	checks := []struct {
+		key string
+		ok  bool
+	}{
+		{"temp", fields["temp"].Type == FieldFloat && fields["temp"].Float == 21.5},
+		{"hum", fields["hum"].Type == FieldInt && fields["hum"].Int == 40},
+		{"cnt", fields["cnt"].Type == FieldUint && fields["cnt"].Uint == 7},
+		{"ok", fields["ok"].Type == FieldBool && fields["ok"].Bool},
+		{"bad", fields["bad"].Type == FieldBool && !fields["bad"].Bool},
+		{"note", fields["note"].Type == FieldString && string(AppendUnescapedString(nil, fields["note"].Str)) == `say "hi"\ ok`},
+		{"neg", fields["neg"].Type == FieldInt && fields["neg"].Int == -3},
+		{"exp", fields["exp"].Type == FieldFloat && fields["exp"].Float == 1000},
+	}
+	for _, c := range checks {
+		if !c.ok {
+			t.Errorf("unexpected field %s: %+v", c.key, fields[c.key])
+		}
+	}
+	if !line.HasTime || !line.Time(time.Millisecond).Equal(time.UnixMilli(1700000000000)) {
+		t.Errorf("unexpected timestamp %d", line.Timestamp)
+	}
+
+	line, err = p.Next()
+	if err != nil || string(line.Measurement) != "cpu" || line.HasTime || !line.Time(time.Nanosecond).IsZero() {
+		t.Fatalf("unexpected second line %+v, %v", line, err)
+	}
+	if _, err := p.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestLineParser_StringWithNewline(t *testing.T) {
+	n, err := ValidateLineProtocol([]byte("log msg=\"a\nb\" 1\nlog msg=\"c\"\n"))
+	if err != nil || n != 2 {
+		t.Errorf("expected 2 lines, got %d, %v", n, err)
+	}
+}
+
+func TestLineParser_Errors(t *testing.T) {
+	cases := []struct {
+		input  string
+		column int
+		msg    string
+	}{
+		{",a=b f=1", 1, "missing measurement"},
+		{"m", 2, "missing fields"},
+		{"m,t=v", 6, "missing fields"},
+		{"m,=v f=1", 3, "missing tag key"},
+		{"m,t f=1", 4, "expected '='"},
+		{"m,t= f=1", 5, "missing value for tag"},
+		{"m f", 4, "expected '='"},
+		{"m f=", 5, "missing value"},
+		{"m f=1x", 5, "invalid float"},
+		{"m f=12.5i", 5, "invalid int"},
+		{"m f=-1u", 5, "invalid uint"},
+		{"m f=99999999999999999999i", 5, "invalid int"},
+		{"m f=tru", 5, "invalid bool"},
+		{"m f=NaN", 5, "invalid float"},
+		{"m f=1e400", 5, "invalid float"},
+		{`m f="abc`, 5, "unterminated string"},
+		{"m f=1 12a", 7, "invalid timestamp"},
+		{"m f=1 1 2", 9, "unexpected data after timestamp"},
+		{`m f="a"x`, 8, "unexpected character"},
+	}
+	for _, c := range cases {
+		_, err := NewLineParser([]byte(c.input)).Next()
+		var perr *LineParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("%q: expected *LineParseError, got %v", c.input, err)
+			continue
+		}
+		if perr.Line != 1 || perr.Column != c.column || !strings.Contains(perr.Msg, c.msg) {
+			t.Errorf("%q: unexpected error %v (column %d), want column %d %q", c.input, perr, perr.Column, c.column, c.msg)
+		}
+	}
+
+	// 出错后继续解析后续行，行号与偏移正确
+	p := NewLineParser([]byte("a f=1\nb f=\nc f=3\n"))
+	if _, err := p.Next(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := p.Next()
+	var perr *LineParseError
+	if !errors.As(err, &perr) || perr.Line != 2 || perr.Column != 5 || perr.Offset != 10 {
+		t.Errorf("unexpected error %#v", err)
+	}
+	if line, err := p.Next(); err != nil || string(line.Measurement) != "c" {
+		t.Errorf("expected to resume at line 3, got %v", err)
+	}
+}
+
+func TestLineEncoder(t *testing.T) {
+	e := NewLineEncoder(time.Millisecond)
+	e.StartLine("weather station")
+	e.AddTag("site", "north,1")
+	e.AddTag("loc=x", "a b")
+	e.AddTag("empty", "")
+	e.AddFieldFloat("temp", 21.5)
+	e.AddFieldInt("hum", -40)
+	e.AddFieldUint("cnt", math.MaxUint64)
+	e.AddFieldBool("ok", true)
+	e.AddFieldString("note", `say "hi"\`)
+	e.EndLine(time.UnixMilli(1700000000123).Add(456 * time.Microsecond))
+	e.StartLine("cpu")
+	e.AddFieldFloat("v", 1)
+	e.EndLine(time.Time{})
+	if err := e.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := `weather\ station,site=north\,1,loc\=x=a\ b temp=21.5,hum=-40i,cnt=18446744073709551615u,ok=true,note="say \"hi\"\\" 1700000000123` + "\n" +
+		"cpu v=1\n"
+	if got := string(e.Bytes()); got != want {
+		t.Errorf("unexpected output\n got: %s\nwant: %s", got, want)
+	}
+
+	// 编码结果可以被解析器还原
+	p := NewLineParser(e.Bytes())
+	line, err := p.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := line.Tag("loc=x"); string(AppendUnescapedKey(nil, v)) != "a b" || line.Fields[2].Uint != math.MaxUint64 {
+		t.Errorf("round trip mismatch %+v", line)
+	}
+
+	for _, precision := range []time.Duration{time.Nanosecond, time.Microsecond, time.Second} {
+		ts := time.Unix(1700000000, 123456789)
+		e := NewLineEncoder(precision)
+		e.StartLine("m")
+		e.AddFieldInt("f", 1)
+		e.EndLine(ts)
+		line, err := NewLineParser(e.Bytes()).Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := line.Time(precision); !got.Equal(ts.Truncate(precision)) {
+			t.Errorf("precision %s: got %s", precision, got)
+		}
+	}
+}
+
+func TestLineEncoder_Errors(t *testing.T) {
+	if NewLineEncoder(time.Minute).Err() == nil {
+		t.Error("expected error for unsupported precision")
+	}
+
+	e := NewLineEncoder(time.Nanosecond)
+	e.StartLine("ok")
+	e.AddFieldInt("f", 1)
+	e.EndLine(time.Time{})
+	e.StartLine("m")
+	e.AddFieldFloat("f", math.NaN())
+	e.EndLine(time.Time{})
+	if e.Err() == nil {
+		t.Fatal("expected error for NaN")
+	}
+	// 出错的行被丢弃，之前完成的行保留
+	if got := string(e.Bytes()); got != "ok f=1i\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+
+	for name, f := range map[string]func(e *LineEncoder){
+		"no fields":       func(e *LineEncoder) { e.StartLine("m"); e.EndLine(time.Time{}) },
+		"tag after field": func(e *LineEncoder) { e.StartLine("m"); e.AddFieldInt("f", 1); e.AddTag("t", "v") },
+		"empty key":       func(e *LineEncoder) { e.StartLine("m"); e.AddFieldInt("", 1) },
+		"no line":         func(e *LineEncoder) { e.AddFieldInt("f", 1) },
+		"trailing backslash tag": func(e *LineEncoder) {
+			e.StartLine("m")
+			e.AddTag("path", `C:\`)
+			e.AddFieldInt("v", 1)
+			e.EndLine(time.Time{})
+		},
+		"newline in tag":         func(e *LineEncoder) { e.StartLine("m"); e.AddTag("host", "a\nb") },
+		"newline in measurement": func(e *LineEncoder) { e.StartLine("a\nb") },
+		"backslash measurement":  func(e *LineEncoder) { e.StartLine(`m\`) },
+		"backslash tag key":      func(e *LineEncoder) { e.StartLine("m"); e.AddTag(`k\`, "v") },
+		"backslash field key":    func(e *LineEncoder) { e.StartLine("m"); e.AddFieldInt(`f\`, 1) },
+		"backslash before comma": func(e *LineEncoder) { e.StartLine("m"); e.AddTag("t", `x\,y`) },
+		"out of range": func(e *LineEncoder) {
+			e.StartLine("m")
+			e.AddFieldInt("f", 1)
+			e.EndLine(time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC))
+		},
+	} {
+		e.Reset()
+		f(e)
+		if e.Err() == nil {
+			t.Errorf("%s: expected error", name)
+		}
+		if len(e.Bytes()) != 0 {
+			t.Errorf("%s: expected no output, got %q", name, e.Bytes())
+		}
+	}
+}
+
+func TestLineEncoder_RoundTrip(t *testing.T) {
+	tags := [][2]string{
+		{"path", `C:\dir`},
+		{"a\\b", `x\y`},
+		{"q=1", "v a,l"},
+		{"uni", "温度 °C"},
+	}
+	e := NewLineEncoder(time.Nanosecond)
+	e.StartLine(`my measure,ment=\x`)
+	for _, tag := range tags {
+		e.AddTag(tag[0], tag[1])
+	}
+	e.AddFieldString(`k\ey=`, "line1\nline2\\")
+	e.AddFieldInt("n", 1)
+	e.EndLine(time.Unix(0, 1))
+	if err := e.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := ValidateLineProtocol(e.Bytes()); err != nil || n != 1 {
+		t.Fatalf("encoder output rejected by parser: %v\n%s", err, e.Bytes())
+	}
+
+	line, err := NewLineParser(e.Bytes()).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(AppendUnescapedMeasurement(nil, line.Measurement)); got != `my measure,ment=\x` {
+		t.Errorf("measurement %q", got)
+	}
+	if len(line.Tags) != len(tags) {
+		t.Fatalf("expected %d tags, got %d", len(tags), len(line.Tags))
+	}
+	for n, tag := range tags {
+		k, v := AppendUnescapedKey(nil, line.Tags[n].Key), AppendUnescapedKey(nil, line.Tags[n].Value)
+		if string(k) != tag[0] || string(v) != tag[1] {
+			t.Errorf("tag %d: got %q=%q, want %q=%q", n, k, v, tag[0], tag[1])
+		}
+	}
+	f := line.Fields[0]
+	if string(AppendUnescapedKey(nil, f.Key)) != `k\ey=` || string(AppendUnescapedString(nil, f.Str)) != "line1\nline2\\" {
+		t.Errorf("field %q=%q", f.Key, f.Str)
+	}
+}
+
+func TestLine_RewriteTags(t *testing.T) {
+	p := NewLineParser([]byte("cpu,host=a,region=us\\ east,tmp=x usage=0.5,msg=\"a\\\"b\" 42\n"))
+	e := NewLineEncoder(time.Nanosecond)
+	line, err := p.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := line.SetTag("host", "b 2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := line.SetTag("dc", "x,y"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range [][2]string{{"host", "x\ny"}, {"zone", `bad\`}, {"zone", ""}, {"", "v"}} {
+		if err := line.SetTag(tag[0], tag[1]); err == nil {
+			t.Errorf("SetTag(%q, %q): expected error", tag[0], tag[1])
+		}
+	}
+	if !line.DeleteTag("tmp") || line.DeleteTag("missing") {
+		t.Error("unexpected DeleteTag result")
+	}
+	line.SortTags()
+	e.AppendLine(line)
+	if err := e.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := `cpu,dc=x\,y,host=b\ 2,region=us\ east usage=0.5,msg="a\"b" 42` + "\n"
+	if got := string(e.Bytes()); got != want {
+		t.Errorf("unexpected output\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestLineEncoder_AppendLineInvalid(t *testing.T) {
+	valid := func() *Line {
+		return &Line{
+			Measurement: []byte("cpu"),
+			Tags:        []LineTag{{Key: []byte("host"), Value: []byte(`a\ b`)}},
+			Fields:      []LineField{{Key: []byte("v"), Type: FieldInt, Int: 1}},
+		}
+	}
+	e := NewLineEncoder(time.Nanosecond)
+	e.AppendLine(valid())
+	if err := e.Err(); err != nil || string(e.Bytes()) != "cpu,host=a\\ b v=1i\n" {
+		t.Fatalf("unexpected output %q, %v", e.Bytes(), err)
+	}
+
+	for name, change := range map[string]func(l *Line){
+		"newline in tag":      func(l *Line) { l.Tags[0].Value = []byte("x\ny") },
+		"trailing backslash":  func(l *Line) { l.Tags[0].Value = []byte(`bad\`) },
+		"unescaped comma":     func(l *Line) { l.Tags[0].Key = []byte("a,b") },
+		"unescaped space":     func(l *Line) { l.Measurement = []byte("c pu") },
+		"unescaped field key": func(l *Line) { l.Fields[0].Key = []byte("v=1") },
+		"escaped newline":     func(l *Line) { l.Tags[0].Value = []byte("x\\\ny") },
+		"empty field key":     func(l *Line) { l.Fields[0].Key = nil },
+	} {
+		l := valid()
+		change(l)
+		e.Reset()
+		e.AppendLine(l)
+		if e.Err() == nil {
+			t.Errorf("%s: expected error, got %q", name, e.Bytes())
+		}
+		if len(e.Bytes()) != 0 {
+			t.Errorf("%s: expected no output, got %q", name, e.Bytes())
+		}
+	}
+}
+
+func TestLineParser_Allocs(t *testing.T) {
+	data := []byte(strings.Repeat("cpu,host=a,region=b usage=0.5,count=3i,ok=t,msg=\"x\" 1700000000000000000\n", 10))
+	p := NewLineParser(data)
+	e := NewLineEncoder(time.Nanosecond)
+	allocs := testing.AllocsPerRun(100, func() {
+		*p = LineParser{data: data, line: p.line}
+		e.Reset()
+		for {
+			line, err := p.Next()
+			if err != nil {
+				break
+			}
+			e.AppendLine(line)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("expected zero allocations after warm-up, got %v", allocs)
+	}
+}
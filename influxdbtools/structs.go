@@ -0,0 +1,451 @@
+package influxdbtools
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/query"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// -------- 结构体映射 --------
+//
+// 结构体字段通过 influx tag 映射到数据点：
+//
+//	type CPU struct {
+//		Measurement string    `influx:"measurement"` // 数据点的 measurement，不能为空
+//		Host        string    `influx:"host,tag"`
+//		Usage       float64   `influx:"usage,field"`
+//		Temp        *float64  `influx:"temp,field"` // 指针为 nil 时不写入该 field
+//		Time        time.Time `influx:"time"`       // 零值时由服务端使用写入时间
+//		Note        string    `influx:"-"`
+//	}
+//
+// 没有 influx tag 的字段忽略；只写名称（如 `influx:"usage"`）时视为 field
+// tag 支持字符串、整数、浮点数与布尔值；field 另支持 time.Time（按 RFC3339Nano 写为字符串）
+
+type influxFieldKind int
+
+const (
+	influxMeasurement influxFieldKind = iota
+	influxTag
+	influxField
+	influxTime
+)
+
+type influxFieldMapping struct {
+	name  string
+	kind  influxFieldKind
+	index []int
+	typ   reflect.Type // 去掉指针后的类型
+}
+
+// influxMapping 结构体类型的映射，按类型缓存
+type influxMapping struct {
+	fields      []influxFieldMapping
+	measurement int // measurement 字段在 fields 中的下标
+}
+
+var influxMappings sync.Map // reflect.Type -> *influxMapping
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func influxMappingFor(t reflect.Type) (*influxMapping, error) {
+	if m, ok := influxMappings.Load(t); ok {
+		return m.(*influxMapping), nil
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", t)
+	}
+
+	m := &influxMapping{measurement: -1}
+	fieldCount, timeCount := 0, 0
+	for _, f := range reflect.VisibleFields(t) {
+		tag, ok := f.Tag.Lookup("influx")
+		if !ok || tag == "-" || !f.IsExported() {
+			continue
+		}
+		fm := influxFieldMapping{index: f.Index, typ: f.Type}
+		if fm.typ.Kind() == reflect.Pointer {
+			fm.typ = fm.typ.Elem()
+		}
+
+		name, kind, _ := strings.Cut(tag, ",")
+		switch {
+		case kind == "" && name == "measurement":
+			if m.measurement >= 0 {
+				return nil, fmt.Errorf("%s: multiple measurement fields", t)
+			}
+			if fm.typ.Kind() != reflect.String {
+				return nil, fmt.Errorf("%s.%s: measurement must be a string", t, f.Name)
+			}
+			fm.kind = influxMeasurement
+			m.measurement = len(m.fields)
+		case kind == "" && name == "time":
+			if fm.typ != timeType {
+				return nil, fmt.Errorf("%s.%s: time must be time.Time", t, f.Name)
+			}
+			fm.kind = influxTime
+			timeCount++
+		case kind == "tag":
+			if !isInfluxScalar(fm.typ) {
+				return nil, fmt.Errorf("%s.%s: unsupported tag type %s", t, f.Name, f.Type)
+			}
+			fm.kind = influxTag
+		case kind == "field" || kind == "":
+			if !isInfluxScalar(fm.typ) && fm.typ != timeType {
+				return nil, fmt.Errorf("%s.%s: unsupported field type %s", t, f.Name, f.Type)
+			}
+			fm.kind = influxField
+			fieldCount++
+		default:
+			return nil, fmt.Errorf("%s.%s: invalid influx tag %q", t, f.Name, tag)
+		}
+		if fm.kind == influxTag || fm.kind == influxField {
+			if name == "" {
+				return nil, fmt.Errorf("%s.%s: influx name cannot be empty", t, f.Name)
+			}
+			fm.name = name
+		}
+		m.fields = append(m.fields, fm)
+	}
+
+	if m.measurement < 0 {
+		return nil, fmt.Errorf("%s: no field tagged influx:\"measurement\"", t)
+	}
+	if fieldCount == 0 {
+		return nil, fmt.Errorf("%s: no field tagged as influx field", t)
+	}
+	if timeCount > 1 {
+		return nil, fmt.Errorf("%s: multiple time fields", t)
+	}
+	actual, _ := influxMappings.LoadOrStore(t, m)
+	return actual.(*influxMapping), nil
+}
+
+func isInfluxScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// structType 返回 T 对应的结构体类型，T 可以是结构体或结构体指针
+func structType[T any]() reflect.Type {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// StructsToPoints 按 influx tag 将结构体切片转换为数据点，T 可以是结构体或结构体指针
+func StructsToPoints[T any](rows []T) ([]*write.Point, error) {
+	m, err := influxMappingFor(structType[T]())
+	if err != nil {
+		return nil, err
+	}
+	points := make([]*write.Point, 0, len(rows))
+	for n, row := range rows {
+		v := reflect.ValueOf(row)
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return nil, fmt.Errorf("row %d: nil pointer", n)
+			}
+			v = v.Elem()
+		}
+		p, err := m.toPoint(v)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", n, err)
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+func (m *influxMapping) toPoint(v reflect.Value) (*write.Point, error) {
+	measurement := v.FieldByIndex(m.fields[m.measurement].index)
+	if measurement.Kind() == reflect.Pointer {
+		measurement = reflect.Indirect(measurement)
+	}
+	if !measurement.IsValid() || measurement.String() == "" {
+		return nil, fmt.Errorf("measurement cannot be empty")
+	}
+
+	tags := make(map[string]string)
+	fields := make(map[string]any)
+	var ts time.Time
+	for _, f := range m.fields {
+		fv := v.FieldByIndex(f.index)
+		if fv.Kind() == reflect.Pointer {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		switch f.kind {
+		case influxTag:
+			tags[f.name] = formatTagValue(fv)
+		case influxField:
+			fields[f.name] = fieldValue(fv)
+		case influxTime:
+			ts = fv.Interface().(time.Time)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("all fields are nil")
+	}
+	// NewPoint 按名称排序 tag 与 field；零值时间不写入时间戳
+	return write.NewPoint(measurement.String(), tags, fields, ts), nil
+}
+
+func formatTagValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	}
+	return v.String()
+}
+
+// fieldValue 统一为 Line Protocol 支持的类型，避免自定义类型按 %v 输出
+func fieldValue(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	}
+	return v.Interface().(time.Time).Format(time.RFC3339Nano)
+}
+
+// WriteStructs 按 influx tag 将结构体转换为数据点后同步写入
+// 示例：WriteStructs(ctx, client, []CPU{{Measurement: "cpu", Host: "a", Usage: 0.5}})
+func WriteStructs[T any](ctx context.Context, i *InfluxClient, rows []T) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	points, err := StructsToPoints(rows)
+	if err != nil {
+		return err
+	}
+	return i.WriteBatch(ctx, points)
+}
+
+// QueryInto 执行 Flux 查询，将结果按 influx tag 映射回结构体
+// 未 pivot 的结果（每条记录一个 _field/_value）按 measurement、结构体中的 tag 与时间合并为一行；
+// 已 pivot 的结果按列名直接映射。行的顺序为每组首次出现的顺序
+// 示例：rows, err := QueryInto[CPU](ctx, client, `from(bucket:"b") |> range(start: -1h)`)
+func QueryInto[T any](ctx context.Context, i *InfluxClient, flux string) ([]T, error) {
+	if i.queryAPI == nil {
+		return nil, fmt.Errorf("influx query api not initialized")
+	}
+	res, err := i.queryAPI.Query(ctx, flux)
+	if err != nil {
+		return nil, fmt.Errorf("query influxdb: %w", err)
+	}
+	defer res.Close()
+
+	p, err := newPivoter[T]()
+	if err != nil {
+		return nil, err
+	}
+	for res.Next() {
+		if err := p.add(res.Record()); err != nil {
+			return nil, err
+		}
+	}
+	if res.Err() != nil {
+		return nil, fmt.Errorf("query result error: %w", res.Err())
+	}
+	return p.rows, nil
+}
+
+// pivoter 将 Flux 记录合并为结构体
+type pivoter[T any] struct {
+	mapping *influxMapping
+	byName  map[string]int // field 名称 -> fields 下标
+	groups  map[string]int // 分组键 -> rows 下标
+	rows    []T
+}
+
+func newPivoter[T any]() (*pivoter[T], error) {
+	m, err := influxMappingFor(structType[T]())
+	if err != nil {
+		return nil, err
+	}
+	p := &pivoter[T]{mapping: m, byName: make(map[string]int), groups: make(map[string]int)}
+	for n, f := range m.fields {
+		if f.kind == influxField {
+			p.byName[f.name] = n
+		}
+	}
+	return p, nil
+}
+
+func (p *pivoter[T]) add(record *query.FluxRecord) error {
+	values := record.Values()
+
+	var key strings.Builder
+	key.WriteString(record.Measurement())
+	for _, f := range p.mapping.fields {
+		if f.kind == influxTag {
+			key.WriteByte(0)
+			fmt.Fprint(&key, values[f.name])
+		}
+	}
+	key.WriteByte(0)
+	key.WriteString(record.Time().Format(time.RFC3339Nano))
+
+	n, ok := p.groups[key.String()]
+	if !ok {
+		n = len(p.rows)
+		p.groups[key.String()] = n
+		var zero T
+		p.rows = append(p.rows, zero)
+	}
+	v := reflect.ValueOf(&p.rows[n]).Elem()
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	for _, f := range p.mapping.fields {
+		var value any
+		switch f.kind {
+		case influxMeasurement:
+			value = record.Measurement()
+		case influxTag:
+			value = values[f.name]
+		case influxTime:
+			value = record.Time()
+		case influxField:
+			if _, unpivoted := values["_field"]; unpivoted {
+				continue
+			}
+			value = values[f.name]
+		}
+		if err := setInfluxValue(v.FieldByIndex(f.index), value); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+
+	// 未 pivot 的记录：_field 指定字段名，_value 为字段值
+	if field, ok := values["_field"].(string); ok {
+		if idx, ok := p.byName[field]; ok {
+			f := p.mapping.fields[idx]
+			if err := setInfluxValue(v.FieldByIndex(f.index), values["_value"]); err != nil {
+				return fmt.Errorf("%s: %w", f.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// setInfluxValue 将查询结果中的值赋给结构体字段，nil 保持字段不变
+func setInfluxValue(dst reflect.Value, value any) error {
+	if value == nil {
+		return nil
+	}
+	if dst.Kind() == reflect.Pointer {
+		elem := reflect.New(dst.Type().Elem())
+		if err := setInfluxValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+	}
+
+	src := reflect.ValueOf(value)
+	switch {
+	case dst.Type() == timeType:
+		switch t := value.(type) {
+		case time.Time:
+			dst.Set(reflect.ValueOf(t))
+			return nil
+		case string:
+			parsed, err := time.Parse(time.RFC3339Nano, t)
+			if err != nil {
+				return err
+			}
+			dst.Set(reflect.ValueOf(parsed))
+			return nil
+		}
+	case dst.Kind() == reflect.String:
+		if src.Kind() == reflect.String {
+			dst.SetString(src.String())
+			return nil
+		}
+	case dst.Kind() == reflect.Bool:
+		if src.Kind() == reflect.Bool {
+			dst.SetBool(src.Bool())
+			return nil
+		}
+		if src.Kind() == reflect.String {
+			b, err := strconv.ParseBool(src.String())
+			if err != nil {
+				return err
+			}
+			dst.SetBool(b)
+			return nil
+		}
+	case isInfluxScalar(dst.Type()):
+		// 数值之间按 Go 规则转换；tag 为字符串时解析
+		if src.Kind() == reflect.String {
+			return setNumberFromString(dst, src.String())
+		}
+		if isInfluxScalar(src.Type()) && src.Kind() != reflect.Bool && src.CanConvert(dst.Type()) {
+			dst.Set(src.Convert(dst.Type()))
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot assign %T to %s", value, dst.Type())
+}
+
+func setNumberFromString(dst reflect.Value, s string) error {
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, dst.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dst.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, dst.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dst.SetUint(n)
+	default:
+		f, err := strconv.ParseFloat(s, dst.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dst.SetFloat(f)
+	}
+	return nil
+}
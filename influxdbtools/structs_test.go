@@ -0,0 +1,157 @@
+package influxdbtools
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/query"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+type Base struct {
+	Host string `influx:"host,tag"`
+}
+
+type cpuSample struct {
+	Base
+	Measurement string    `influx:"measurement"`
+	Core        int       `influx:"core,tag"`
+	Usage       float64   `influx:"usage,field"`
+	Count       int32     `influx:"count"`
+	Temp        *float64  `influx:"temp,field"`
+	Ok          bool      `influx:"ok,field"`
+	Time        time.Time `influx:"time"`
+	Note        string    `influx:"-"`
+	Ignored     string
+}
+
+func TestStructsToPoints(t *testing.T) {
+	temp := 41.5
+	ts := time.Unix(0, 1700000000000000000)
+	rows := []*cpuSample{
+		{Base: Base{Host: "web 1"}, Measurement: "cpu", Core: 2, Usage: 0.25, Count: 3, Temp: &temp, Ok: true, Time: ts, Note: "x"},
+		{Base: Base{Host: "web2"}, Measurement: "cpu", Usage: 1},
+	}
+	points, err := StructsToPoints(rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, p := range points {
+		lines = append(lines, strings.TrimSpace(write.PointToLineProtocol(p, time.Nanosecond)))
+	}
+	want := []string{
+		`cpu,core=2,host=web\ 1 count=3i,ok=true,temp=41.5,usage=0.25 1700000000000000000`,
+		`cpu,core=0,host=web2 count=0i,ok=false,usage=1`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected points\n got %q\nwant %q", lines, want)
+	}
+
+	if _, err := StructsToPoints([]cpuSample{{Usage: 1}}); err == nil {
+		t.Error("expected error for empty measurement")
+	}
+}
+
+func TestStructsToPoints_InvalidTags(t *testing.T) {
+	type noMeasurement struct {
+		V float64 `influx:"v,field"`
+	}
+	type noField struct {
+		M string `influx:"measurement"`
+		T string `influx:"t,tag"`
+	}
+	type badKind struct {
+		M string  `influx:"measurement"`
+		V float64 `influx:"v,column"`
+	}
+	type badType struct {
+		M string   `influx:"measurement"`
+		V []string `influx:"v,field"`
+	}
+	if _, err := StructsToPoints([]noMeasurement{{}}); err == nil {
+		t.Error("expected error for missing measurement")
+	}
+	if _, err := StructsToPoints([]noField{{}}); err == nil {
+		t.Error("expected error for missing field")
+	}
+	if _, err := StructsToPoints([]badKind{{}}); err == nil {
+		t.Error("expected error for invalid kind")
+	}
+	if _, err := StructsToPoints([]badType{{}}); err == nil {
+		t.Error("expected error for unsupported type")
+	}
+}
+
+func TestPivoter_Unpivoted(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	record := func(host, field string, value any, at time.Time) *query.FluxRecord {
+		return query.NewFluxRecord(0, map[string]interface{}{
+			"_measurement": "cpu", "host": host, "core": "2",
+			"_field": field, "_value": value, "_time": at,
+		})
+	}
+	p, err := newPivoter[cpuSample]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []*query.FluxRecord{
+		record("a", "usage", 0.5, ts),
+		record("b", "usage", 0.7, ts),
+		record("a", "temp", 40.0, ts),
+		record("a", "count", int64(3), ts),
+		record("a", "ok", true, ts),
+		record("a", "unknown", "x", ts),
+		record("a", "usage", 0.6, ts.Add(time.Second)),
+	} {
+		if err := p.add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(p.rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d: %+v", len(p.rows), p.rows)
+	}
+	a := p.rows[0]
+	if a.Measurement != "cpu" || a.Host != "a" || a.Core != 2 || a.Usage != 0.5 || a.Count != 3 || !a.Ok || !a.Time.Equal(ts) {
+		t.Errorf("unexpected row %+v", a)
+	}
+	if a.Temp == nil || *a.Temp != 40 {
+		t.Errorf("expected temp set, got %v", a.Temp)
+	}
+	if b := p.rows[1]; b.Host != "b" || b.Usage != 0.7 || b.Temp != nil {
+		t.Errorf("unexpected row %+v", b)
+	}
+	if c := p.rows[2]; c.Host != "a" || c.Usage != 0.6 {
+		t.Errorf("unexpected row %+v", c)
+	}
+}
+
+func TestPivoter_Pivoted(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p, err := newPivoter[*cpuSample]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.add(query.NewFluxRecord(0, map[string]interface{}{
+		"_measurement": "cpu", "host": "a", "core": "1", "_time": ts,
+		"usage": 0.5, "count": int64(7), "temp": nil, "ok": false,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.rows) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(p.rows))
+	}
+	if r := p.rows[0]; r.Usage != 0.5 || r.Count != 7 || r.Core != 1 || r.Temp != nil {
+		t.Errorf("unexpected row %+v", r)
+	}
+
+	err = p.add(query.NewFluxRecord(0, map[string]interface{}{
+		"_measurement": "cpu", "host": "a", "_time": ts, "usage": "high",
+	}))
+	if err == nil {
+		t.Error("expected error assigning string to float field")
+	}
+}
@@ -0,0 +1,211 @@
+// Package chsink 将 Kafka topic 中的消息解码后批量写入 ClickHouse
+//
+// 消息按分区攒批，达到 MaxRows 或 FlushInterval 时写入一次；
+// 只有写入成功（以及解码失败的消息写入死信topic成功）后才提交offset，保证至少一次投递。
+package chsink
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/OnlyPiglet/fly/clickhousetools"
+	"github.com/OnlyPiglet/fly/kafkatools"
+)
+
+// HeaderDecodeError 解码失败的消息写入死信topic时记录失败原因的Header
+const HeaderDecodeError = "x-decode-error"
+
+// Inserter 将一批行写入指定表
+type Inserter[T any] func(ctx context.Context, table string, rows []T) error
+
+// ClickHouseInserter 使用 clickhousetools.AddDataContext 写入的 Inserter，rebalance时中止进行中的写入
+func ClickHouseInserter[T any](c *clickhousetools.ClickHouseClient, opt ...clickhousetools.WithBatchOptions) Inserter[T] {
+	return func(ctx context.Context, table string, rows []T) error {
+		return clickhousetools.AddDataContext(ctx, c, table, rows, opt...)
+	}
+}
+
+// Config Sink 配置
+type Config struct {
+	Group         string        // 消费组
+	Topics        []string      // 消费的topic
+	Table         string        // 写入的表，如 "db.events"
+	MaxRows       int           // 单批最大行数，默认10000
+	FlushInterval time.Duration // 单批最长等待时间，默认1秒
+	DLQTopic      string        // 解码失败消息的死信topic，默认 "<原topic>.dlq"
+	InsertRetries int           // 写入失败后的重试次数，默认3，小于0表示不重试
+	RetryBackoff  time.Duration // 首次重试等待时间，之后每次翻倍，默认500毫秒
+	InitialOffset int64         // 消费组没有已提交offset时的起始位置，默认 sarama.OffsetNewest
+}
+
+func (c Config) withDefaults() Config {
+	if c.MaxRows <= 0 {
+		c.MaxRows = 10000
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = time.Second
+	}
+	if c.InsertRetries < 0 {
+		c.InsertRetries = 0
+	} else if c.InsertRetries == 0 {
+		c.InsertRetries = 3
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = 500 * time.Millisecond
+	}
+	return c
+}
+
+// Stats Sink 运行统计
+type Stats struct {
+	Consumed     uint64 // 已消费的消息数
+	Inserted     uint64 // 已写入的行数
+	DeadLettered uint64 // 写入死信topic的消息数
+	Batches      uint64 // 成功写入的批次数
+	InsertErrors uint64 // 写入失败次数（含重试）
+}
+
+// Sink 从 Kafka 消费并写入 ClickHouse
+type Sink[T any] struct {
+	consumer kafkatools.BatchConsumer
+	dlq      kafkatools.Producer
+	insert   Inserter[T]
+	serdes   []kafkatools.Serde[T]
+	config   Config
+
+	consumed     atomic.Uint64
+	inserted     atomic.Uint64
+	deadLettered atomic.Uint64
+	batches      atomic.Uint64
+	insertErrors atomic.Uint64
+}
+
+// New 创建 Sink；serdes 为空时按JSON解码
+// 示例：chsink.New[Event](kafkaClient, kafkaClient, chsink.ClickHouseInserter[Event](ch), chsink.Config{Group: "g", Topics: []string{"events"}, Table: "db.events"})
+func New[T any](consumer kafkatools.BatchConsumer, dlq kafkatools.Producer, insert Inserter[T], config Config, serdes ...kafkatools.Serde[T]) (*Sink[T], error) {
+	if consumer == nil {
+		return nil, fmt.Errorf("consumer cannot be nil")
+	}
+	if dlq == nil {
+		return nil, fmt.Errorf("dlq producer cannot be nil")
+	}
+	if insert == nil {
+		return nil, fmt.Errorf("inserter cannot be nil")
+	}
+	if config.Table == "" {
+		return nil, fmt.Errorf("table cannot be empty")
+	}
+	if len(serdes) == 0 {
+		serdes = []kafkatools.Serde[T]{kafkatools.JSONSerde[T]{}}
+	}
+	return &Sink[T]{
+		consumer: consumer,
+		dlq:      dlq,
+		insert:   insert,
+		serdes:   serdes,
+		config:   config.withDefaults(),
+	}, nil
+}
+
+// Run 开始消费，阻塞直到 ctx 取消或写入失败
+// 写入在重试后仍失败时返回错误，该批消息不会提交，重新运行后会再次消费
+func (s *Sink[T]) Run(ctx context.Context) error {
+	return s.consumer.ConsumeGroupBatch(ctx, s.config.Group, s.config.Topics, s.handle,
+		kafkatools.BatchOptions{MaxMessages: s.config.MaxRows, MaxWait: s.config.FlushInterval},
+		kafkatools.ConsumeOptions{InitialOffset: s.config.InitialOffset})
+}
+
+// Stats 返回运行统计
+func (s *Sink[T]) Stats() Stats {
+	return Stats{
+		Consumed:     s.consumed.Load(),
+		Inserted:     s.inserted.Load(),
+		DeadLettered: s.deadLettered.Load(),
+		Batches:      s.batches.Load(),
+		InsertErrors: s.insertErrors.Load(),
+	}
+}
+
+// handle 解码一批消息，解码失败的写入死信topic，其余写入 ClickHouse
+func (s *Sink[T]) handle(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+	s.consumed.Add(uint64(len(msgs)))
+
+	rows := make([]T, 0, len(msgs))
+	for _, msg := range msgs {
+		row, err := kafkatools.DecodeMessage(msg, s.serdes...)
+		if err != nil {
+			if err := s.deadLetter(msg, err); err != nil {
+				return err
+			}
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if err := s.insertWithRetry(ctx, rows); err != nil {
+		return err
+	}
+	s.inserted.Add(uint64(len(rows)))
+	s.batches.Add(1)
+	return nil
+}
+
+// insertWithRetry 写入一批行，失败后按指数退避重试
+func (s *Sink[T]) insertWithRetry(ctx context.Context, rows []T) error {
+	backoff := s.config.RetryBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = s.insert(ctx, s.config.Table, rows); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			// rebalance或关闭：不再重试，消费组将其视为正常停止，该批由新的分区owner重新消费
+			return ctx.Err()
+		}
+		s.insertErrors.Add(1)
+		if attempt >= s.config.InsertRetries {
+			break
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+	return fmt.Errorf("insert %d rows into %s after %d attempts: %w", len(rows), s.config.Table, s.config.InsertRetries+1, err)
+}
+
+// deadLetter 将无法解码的消息原样写入死信topic，保留Key与Headers并记录原始位置
+func (s *Sink[T]) deadLetter(msg *sarama.ConsumerMessage, cause error) error {
+	topic := s.config.DLQTopic
+	if topic == "" {
+		topic = msg.Topic + ".dlq"
+	}
+
+	headers := make(map[string]string, len(msg.Headers)+4)
+	for _, h := range msg.Headers {
+		if h != nil {
+			headers[string(h.Key)] = string(h.Value)
+		}
+	}
+	headers[HeaderDecodeError] = cause.Error()
+	headers[kafkatools.HeaderOriginalTopic] = msg.Topic
+	headers[kafkatools.HeaderOriginalPartition] = strconv.FormatInt(int64(msg.Partition), 10)
+	headers[kafkatools.HeaderOriginalOffset] = strconv.FormatInt(msg.Offset, 10)
+
+	if err := s.dlq.ProduceMessage(topic, msg.Value, kafkatools.ProduceOptions{Key: string(msg.Key), Headers: headers}); err != nil {
+		return fmt.Errorf("send %s/%d@%d to dlq %s: %w", msg.Topic, msg.Partition, msg.Offset, topic, err)
+	}
+	s.deadLettered.Add(1)
+	return nil
+}
@@ -0,0 +1,189 @@
+package chsink
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/OnlyPiglet/fly/kafkatools"
+	"github.com/OnlyPiglet/fly/kafkatools/kafkatest"
+)
+
+type event struct {
+	ID   int64  `json:"id" ch:"id"`
+	Name string `json:"name" ch:"name"`
+}
+
+// fakeInserter 记录写入的行，前 failures 次写入返回错误
+type fakeInserter struct {
+	mu       sync.Mutex
+	rows     []event
+	calls    int
+	failures int
+	onInsert func(total int)
+}
+
+func (f *fakeInserter) insert(_ context.Context, table string, rows []event) error {
+	f.mu.Lock()
+	f.calls++
+	if f.calls <= f.failures {
+		f.mu.Unlock()
+		return errors.New("clickhouse unavailable")
+	}
+	f.rows = append(f.rows, rows...)
+	total := len(f.rows)
+	f.mu.Unlock()
+	if f.onInsert != nil {
+		f.onInsert(total)
+	}
+	return nil
+}
+
+func TestSink_InsertsAndDeadLetters(t *testing.T) {
+	b := kafkatest.NewBroker()
+	payloads := []string{`{"id":1,"name":"a"}`, `not json`, `{"id":2,"name":"b"}`}
+	for _, p := range payloads {
+		if err := b.ProduceMessage("events", []byte(p), kafkatools.ProduceOptions{Key: "k"}); err != nil {
+			t.Fatalf("produce: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ins := &fakeInserter{onInsert: func(total int) {
+		if total == 2 {
+			cancel()
+		}
+	}}
+	sink, err := New(b, b, ins.insert, Config{
+		Group:         "sink",
+		Topics:        []string{"events"},
+		Table:         "db.events",
+		InitialOffset: sarama.OffsetOldest,
+	})
+	if err != nil {
+		t.Fatalf("new sink: %v", err)
+	}
+	if err := sink.Run(ctx); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if len(ins.rows) != 2 || ins.rows[0].ID != 1 || ins.rows[1].ID != 2 {
+		t.Errorf("unexpected inserted rows %+v", ins.rows)
+	}
+	dlq := b.Messages("events.dlq")
+	if len(dlq) != 1 || string(dlq[0].Value) != "not json" {
+		t.Fatalf("expected undecodable message in dlq, got %v", dlq)
+	}
+	headers := map[string]string{}
+	for _, h := range dlq[0].Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	if headers[kafkatools.HeaderOriginalOffset] != "1" || headers[HeaderDecodeError] == "" {
+		t.Errorf("unexpected dlq headers %v", headers)
+	}
+	if off := b.CommittedOffset("sink", "events", 0); off != 3 {
+		t.Errorf("expected committed offset 3, got %d", off)
+	}
+	if st := sink.Stats(); st.Consumed != 3 || st.Inserted != 2 || st.DeadLettered != 1 {
+		t.Errorf("unexpected stats %+v", st)
+	}
+}
+
+func TestSink_RetriesInsert(t *testing.T) {
+	b := kafkatest.NewBroker()
+	_ = b.ProduceMessage("events", []byte(`{"id":1}`))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ins := &fakeInserter{failures: 2, onInsert: func(int) { cancel() }}
+	sink, _ := New(b, b, ins.insert, Config{
+		Group:         "sink",
+		Topics:        []string{"events"},
+		Table:         "db.events",
+		RetryBackoff:  time.Millisecond,
+		InitialOffset: sarama.OffsetOldest,
+	})
+	if err := sink.Run(ctx); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if ins.calls != 3 || len(ins.rows) != 1 {
+		t.Errorf("expected success on third attempt, calls=%d rows=%d", ins.calls, len(ins.rows))
+	}
+	if st := sink.Stats(); st.InsertErrors != 2 {
+		t.Errorf("expected 2 insert errors, got %d", st.InsertErrors)
+	}
+}
+
+func TestSink_FailedInsertIsNotCommitted(t *testing.T) {
+	b := kafkatest.NewBroker()
+	_ = b.ProduceMessage("events", []byte(`{"id":1}`))
+
+	ins := &fakeInserter{failures: 100}
+	sink, _ := New(b, b, ins.insert, Config{
+		Group:         "sink",
+		Topics:        []string{"events"},
+		Table:         "db.events",
+		InsertRetries: -1,
+		InitialOffset: sarama.OffsetOldest,
+	})
+	if err := sink.Run(context.Background()); err == nil {
+		t.Fatal("expected insert error")
+	}
+	if off := b.CommittedOffset("sink", "events", 0); off != -1 {
+		t.Errorf("expected nothing committed, got %d", off)
+	}
+}
+
+func TestSink_DLQFailureIsNotCommitted(t *testing.T) {
+	b := kafkatest.NewBroker()
+	_ = b.ProduceMessage("events", []byte(`bad`))
+	b.InjectProduceError("events.dlq", errors.New("broker down"))
+
+	ins := &fakeInserter{}
+	sink, _ := New(b, b, ins.insert, Config{
+		Group:         "sink",
+		Topics:        []string{"events"},
+		Table:         "db.events",
+		InitialOffset: sarama.OffsetOldest,
+	})
+	if err := sink.Run(context.Background()); err == nil {
+		t.Fatal("expected dlq error")
+	}
+	if off := b.CommittedOffset("sink", "events", 0); off != -1 {
+		t.Errorf("expected nothing committed, got %d", off)
+	}
+}
+
+func TestSink_RebalanceDuringInsertIsCleanStop(t *testing.T) {
+	b := kafkatest.NewBroker()
+	_ = b.ProduceMessage("events", []byte(`{"id":1}`))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ins := &fakeInserter{failures: 100}
+	sink, _ := New(b, b, func(ctx context.Context, table string, rows []event) error {
+		err := ins.insert(ctx, table, rows)
+		cancel() // 写入失败时发生rebalance
+		return err
+	}, Config{
+		Group:         "sink",
+		Topics:        []string{"events"},
+		Table:         "db.events",
+		RetryBackoff:  time.Hour,
+		InitialOffset: sarama.OffsetOldest,
+	})
+	if err := sink.Run(ctx); err != nil {
+		t.Fatalf("expected clean stop on rebalance, got %v", err)
+	}
+	if off := b.CommittedOffset("sink", "events", 0); off != -1 {
+		t.Errorf("expected batch left uncommitted, got %d", off)
+	}
+	if ins.calls != 1 {
+		t.Errorf("expected no retries after cancel, got %d calls", ins.calls)
+	}
+}
@@ -0,0 +1,247 @@
+package kafkatools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// -------- 消费者功能 --------
+
+// MessageHandler 消息处理函数，返回nil时消息被标记为已消费
+type MessageHandler func(ctx context.Context, msg *sarama.ConsumerMessage) error
+
+// BatchHandler 批量消息处理函数，返回nil时整批消息被标记为已消费
+type BatchHandler func(ctx context.Context, msgs []*sarama.ConsumerMessage) error
+
+// ConsumeOptions 消费组的可选配置
+type ConsumeOptions struct {
+	InitialOffset int64 // 消费组没有已提交offset时的起始位置，默认 sarama.OffsetNewest
+}
+
+// BatchOptions 批量消费的触发条件，满足任意一个即交给 BatchHandler
+type BatchOptions struct {
+	MaxMessages int           // 单批最大消息数，默认1000
+	MaxWait     time.Duration // 单批最长等待时间，默认1秒
+}
+
+func (o BatchOptions) withDefaults() BatchOptions {
+	if o.MaxMessages <= 0 {
+		o.MaxMessages = 1000
+	}
+	if o.MaxWait <= 0 {
+		o.MaxWait = time.Second
+	}
+	return o
+}
+
+// ConsumeGroup 以消费组方式消费 topics，阻塞直到 ctx 取消或 handler 返回错误
+// handler 返回错误时该消息不会被提交，ConsumeGroup 返回该错误
+func (k *KafkaClient) ConsumeGroup(ctx context.Context, group string, topics []string, handler MessageHandler, opts ...ConsumeOptions) error {
+	if handler == nil {
+		return fmt.Errorf("message handler cannot be nil")
+	}
+	return k.consume(ctx, group, topics, func(state *handlerState) sarama.ConsumerGroupHandler {
+		return &groupHandler{handlerState: state, handler: handler}
+	}, opts...)
+}
+
+// ConsumeGroupBatch 以消费组方式批量消费 topics，每个分区独立攒批
+// handler 返回nil后整批消息才会被提交，返回错误时整批都不提交并终止消费
+func (k *KafkaClient) ConsumeGroupBatch(ctx context.Context, group string, topics []string, handler BatchHandler, batch BatchOptions, opts ...ConsumeOptions) error {
+	if handler == nil {
+		return fmt.Errorf("batch handler cannot be nil")
+	}
+	batch = batch.withDefaults()
+	return k.consume(ctx, group, topics, func(state *handlerState) sarama.ConsumerGroupHandler {
+		return &batchGroupHandler{handlerState: state, handler: handler, opt: batch}
+	}, opts...)
+}
+
+// consume 创建消费组并循环消费，直到 ctx 取消或 handler 失败
+func (k *KafkaClient) consume(ctx context.Context, group string, topics []string, newHandler func(*handlerState) sarama.ConsumerGroupHandler, opts ...ConsumeOptions) error {
+	if group == "" {
+		return fmt.Errorf("group name cannot be empty")
+	}
+	if len(topics) == 0 {
+		return fmt.Errorf("topics cannot be empty")
+	}
+	if k.saramaConfig == nil {
+		return fmt.Errorf("kafka client not initialized")
+	}
+
+	var opt ConsumeOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	config := *k.saramaConfig
+	if opt.InitialOffset != 0 {
+		config.Consumer.Offsets.Initial = opt.InitialOffset
+	}
+
+	consumerGroup, err := sarama.NewConsumerGroup(k.config.Brokers, group, &config)
+	if err != nil {
+		return fmt.Errorf("failed to create consumer group %s: %w", group, err)
+	}
+	defer consumerGroup.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	state := &handlerState{cancel: cancel}
+	h := newHandler(state)
+
+	// 消费组内部错误（如提交失败）不终止消费，直接丢弃
+	go func() {
+		for range consumerGroup.Errors() {
+		}
+	}()
+
+	for {
+		// Consume 在每次rebalance后返回，需要循环调用
+		if err := consumerGroup.Consume(ctx, topics, h); err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				break
+			}
+			if state.Err() == nil && ctx.Err() == nil {
+				return fmt.Errorf("consume group %s: %w", group, err)
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return state.Err()
+}
+
+// handlerState 记录第一个处理错误，出错时停止整个消费组
+type handlerState struct {
+	cancel context.CancelFunc
+
+	mu  sync.Mutex
+	err error
+}
+
+// fail 记录第一个处理错误并停止消费
+func (s *handlerState) fail(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+	s.cancel()
+}
+
+// Err 返回第一个处理错误
+func (s *handlerState) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// groupHandler 将 MessageHandler 适配为 sarama.ConsumerGroupHandler
+type groupHandler struct {
+	*handlerState
+	handler MessageHandler
+}
+
+func (h *groupHandler) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *groupHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *groupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case <-sess.Context().Done():
+			return nil
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if err := h.handler(sess.Context(), msg); err != nil {
+				if sess.Context().Err() != nil {
+					// rebalance或关闭导致的失败不提交也不终止消费，由新的分区owner重新消费
+					return nil
+				}
+				h.fail(fmt.Errorf("handle message %s/%d@%d: %w", msg.Topic, msg.Partition, msg.Offset, err))
+				return err
+			}
+			sess.MarkMessage(msg, "")
+		}
+	}
+}
+
+// batchGroupHandler 将 BatchHandler 适配为 sarama.ConsumerGroupHandler
+type batchGroupHandler struct {
+	*handlerState
+	handler BatchHandler
+	opt     BatchOptions
+}
+
+func (h *batchGroupHandler) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *batchGroupHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *batchGroupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ticker := time.NewTicker(h.opt.MaxWait)
+	defer ticker.Stop()
+
+	batch := make([]*sarama.ConsumerMessage, 0, h.opt.MaxMessages)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := h.handler(sess.Context(), batch); err != nil {
+			if sess.Context().Err() != nil {
+				// rebalance或关闭导致的失败整批不提交，重新分配后再次消费
+				return nil
+			}
+			first := batch[0]
+			h.fail(fmt.Errorf("handle batch %s/%d@%d-%d: %w", first.Topic, first.Partition, first.Offset, batch[len(batch)-1].Offset, err))
+			return err
+		}
+		sess.MarkMessage(batch[len(batch)-1], "")
+		batch = make([]*sarama.ConsumerMessage, 0, h.opt.MaxMessages)
+		return nil
+	}
+
+	for {
+		select {
+		case <-sess.Context().Done():
+			// 未处理的消息没有提交，会在重新分配后再次消费
+			return nil
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return flush()
+			}
+			batch = append(batch, msg)
+			if len(batch) >= h.opt.MaxMessages {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// headersToMap 将消息Headers转换为map，同名Header以最后一个为准
+func headersToMap(headers []*sarama.RecordHeader) map[string]string {
+	result := make(map[string]string, len(headers))
+	for _, h := range headers {
+		if h == nil {
+			continue
+		}
+		result[string(h.Key)] = string(h.Value)
+	}
+	return result
+}
@@ -0,0 +1,260 @@
+package kafkatools
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// -------- 消费组管理功能 --------
+
+// PartitionLag 消费组在单个分区上的消费进度
+type PartitionLag struct {
+	Topic           string // Topic名称
+	Partition       int32  // 分区号
+	CommittedOffset int64  // 已提交的offset，-1表示尚未提交
+	HighWatermark   int64  // 分区高水位（下一条待写入消息的offset）
+	Lag             int64  // 积压消息数
+}
+
+// OffsetResetKind 重置offset的目标类型
+type OffsetResetKind int
+
+const (
+	OffsetResetEarliest  OffsetResetKind = iota // 重置到最早的offset
+	OffsetResetLatest                           // 重置到最新的offset
+	OffsetResetOffset                           // 重置到指定offset
+	OffsetResetTimestamp                        // 重置到指定时间之后的第一条消息
+)
+
+// OffsetResetTarget ResetOffsets 的目标位置，使用 ResetToXxx 系列函数构造
+type OffsetResetTarget struct {
+	Kind      OffsetResetKind
+	Offset    int64     // Kind 为 OffsetResetOffset 时生效
+	Timestamp time.Time // Kind 为 OffsetResetTimestamp 时生效
+}
+
+// ResetToEarliest 重置到分区最早的offset
+func ResetToEarliest() OffsetResetTarget {
+	return OffsetResetTarget{Kind: OffsetResetEarliest}
+}
+
+// ResetToLatest 重置到分区最新的offset
+func ResetToLatest() OffsetResetTarget {
+	return OffsetResetTarget{Kind: OffsetResetLatest}
+}
+
+// ResetToOffset 重置到指定offset，超出分区范围时会被截断到最早/最新offset
+func ResetToOffset(offset int64) OffsetResetTarget {
+	return OffsetResetTarget{Kind: OffsetResetOffset, Offset: offset}
+}
+
+// ResetToTimestamp 重置到时间戳不早于 t 的第一条消息，没有这样的消息时重置到最新offset
+func ResetToTimestamp(t time.Time) OffsetResetTarget {
+	return OffsetResetTarget{Kind: OffsetResetTimestamp, Timestamp: t}
+}
+
+// ListConsumerGroups 列出所有消费组，返回 group -> protocolType
+func (k *KafkaClient) ListConsumerGroups() (map[string]string, error) {
+	if k.admin == nil {
+		return nil, fmt.Errorf("cluster admin not available")
+	}
+	groups, err := k.admin.ListConsumerGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list consumer groups: %w", err)
+	}
+	return groups, nil
+}
+
+// DescribeConsumerGroup 查询消费组详情（状态、成员等）
+func (k *KafkaClient) DescribeConsumerGroup(group string) (*sarama.GroupDescription, error) {
+	if group == "" {
+		return nil, fmt.Errorf("group name cannot be empty")
+	}
+	if k.admin == nil {
+		return nil, fmt.Errorf("cluster admin not available")
+	}
+	descriptions, err := k.admin.DescribeConsumerGroups([]string{group})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe consumer group %s: %w", group, err)
+	}
+	if len(descriptions) == 0 {
+		return nil, fmt.Errorf("consumer group %s not found", group)
+	}
+	desc := descriptions[0]
+	if desc.Err != sarama.ErrNoError {
+		return nil, fmt.Errorf("failed to describe consumer group %s: %w", group, desc.Err)
+	}
+	return desc, nil
+}
+
+// GroupLag 查询消费组在每个已提交分区上的积压情况，结果按 topic、partition 排序
+func (k *KafkaClient) GroupLag(group string) ([]PartitionLag, error) {
+	if group == "" {
+		return nil, fmt.Errorf("group name cannot be empty")
+	}
+	if k.admin == nil || k.client == nil {
+		return nil, fmt.Errorf("cluster admin not available")
+	}
+
+	// topicPartitions 为 nil 时返回该消费组提交过的所有分区
+	resp, err := k.admin.ListConsumerGroupOffsets(group, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offsets of group %s: %w", group, err)
+	}
+	if resp.Err != sarama.ErrNoError {
+		return nil, fmt.Errorf("failed to list offsets of group %s: %w", group, resp.Err)
+	}
+
+	lags := make([]PartitionLag, 0)
+	for topic, partitions := range resp.Blocks {
+		for partition, block := range partitions {
+			if block.Err != sarama.ErrNoError {
+				return nil, fmt.Errorf("failed to fetch offset of %s/%d: %w", topic, partition, block.Err)
+			}
+
+			hwm, err := k.client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get high watermark of %s/%d: %w", topic, partition, err)
+			}
+
+			lag := PartitionLag{
+				Topic:           topic,
+				Partition:       partition,
+				CommittedOffset: block.Offset,
+				HighWatermark:   hwm,
+			}
+			if block.Offset >= 0 {
+				lag.Lag = hwm - block.Offset
+			} else {
+				// 未提交过offset，积压按分区中现存的全部消息计算
+				oldest, err := k.client.GetOffset(topic, partition, sarama.OffsetOldest)
+				if err != nil {
+					return nil, fmt.Errorf("failed to get oldest offset of %s/%d: %w", topic, partition, err)
+				}
+				lag.Lag = hwm - oldest
+			}
+			if lag.Lag < 0 {
+				lag.Lag = 0
+			}
+			lags = append(lags, lag)
+		}
+	}
+
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].Topic != lags[j].Topic {
+			return lags[i].Topic < lags[j].Topic
+		}
+		return lags[i].Partition < lags[j].Partition
+	})
+	return lags, nil
+}
+
+// ResetOffsets 将消费组在 topic 所有分区上的offset重置到 to 指定的位置，返回每个分区重置后的offset
+// 消费组必须没有活跃成员（状态为 Empty 或 Dead），否则Kafka会拒绝提交
+func (k *KafkaClient) ResetOffsets(group, topic string, to OffsetResetTarget) (map[int32]int64, error) {
+	if group == "" {
+		return nil, fmt.Errorf("group name cannot be empty")
+	}
+	if topic == "" {
+		return nil, fmt.Errorf("topic name cannot be empty")
+	}
+	if k.admin == nil || k.client == nil {
+		return nil, fmt.Errorf("cluster admin not available")
+	}
+
+	desc, err := k.DescribeConsumerGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	if desc.State != "Empty" && desc.State != "Dead" {
+		return nil, fmt.Errorf("consumer group %s is %s, stop all consumers before resetting offsets", group, desc.State)
+	}
+
+	partitions, err := k.client.Partitions(topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get partitions of topic %s: %w", topic, err)
+	}
+
+	offsets := make(map[int32]int64, len(partitions))
+	for _, partition := range partitions {
+		offset, err := k.resolveResetOffset(topic, partition, to)
+		if err != nil {
+			return nil, err
+		}
+		offsets[partition] = offset
+	}
+
+	coordinator, err := k.admin.Coordinator(group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find coordinator of group %s: %w", group, err)
+	}
+
+	request := &sarama.OffsetCommitRequest{
+		Version:                 2,
+		ConsumerGroup:           group,
+		ConsumerGroupGeneration: sarama.GroupGenerationUndefined,
+		RetentionTime:           -1,
+	}
+	for partition, offset := range offsets {
+		request.AddBlock(topic, partition, offset, 0, "")
+	}
+
+	resp, err := coordinator.CommitOffset(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit offsets of group %s: %w", group, err)
+	}
+	for partition, kerr := range resp.Errors[topic] {
+		if kerr != sarama.ErrNoError {
+			return nil, fmt.Errorf("failed to commit offset of %s/%d: %w", topic, partition, kerr)
+		}
+	}
+
+	return offsets, nil
+}
+
+// resolveResetOffset 计算单个分区重置后的目标offset
+func (k *KafkaClient) resolveResetOffset(topic string, partition int32, to OffsetResetTarget) (int64, error) {
+	oldest, err := k.client.GetOffset(topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get oldest offset of %s/%d: %w", topic, partition, err)
+	}
+	newest, err := k.client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get newest offset of %s/%d: %w", topic, partition, err)
+	}
+
+	switch to.Kind {
+	case OffsetResetEarliest:
+		return oldest, nil
+	case OffsetResetLatest:
+		return newest, nil
+	case OffsetResetOffset:
+		return clampOffset(to.Offset, oldest, newest), nil
+	case OffsetResetTimestamp:
+		offset, err := k.client.GetOffset(topic, partition, to.Timestamp.UnixMilli())
+		if err != nil {
+			return 0, fmt.Errorf("failed to get offset of %s/%d at %s: %w", topic, partition, to.Timestamp, err)
+		}
+		// 找不到不早于该时间的消息时返回-1
+		if offset < 0 {
+			return newest, nil
+		}
+		return clampOffset(offset, oldest, newest), nil
+	default:
+		return 0, fmt.Errorf("unknown offset reset kind %d", to.Kind)
+	}
+}
+
+// clampOffset 将offset限制在 [oldest, newest] 范围内
+func clampOffset(offset, oldest, newest int64) int64 {
+	if offset < oldest {
+		return oldest
+	}
+	if offset > newest {
+		return newest
+	}
+	return offset
+}
@@ -0,0 +1,73 @@
+package kafkatools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClampOffset(t *testing.T) {
+	cases := []struct {
+		offset, oldest, newest, want int64
+	}{
+		{offset: 5, oldest: 0, newest: 10, want: 5},
+		{offset: -3, oldest: 2, newest: 10, want: 2},
+		{offset: 20, oldest: 0, newest: 10, want: 10},
+	}
+	for _, c := range cases {
+		if got := clampOffset(c.offset, c.oldest, c.newest); got != c.want {
+			t.Errorf("clampOffset(%d, %d, %d) = %d, want %d", c.offset, c.oldest, c.newest, got, c.want)
+		}
+	}
+}
+
+func TestResetTargets(t *testing.T) {
+	if ResetToEarliest().Kind != OffsetResetEarliest {
+		t.Error("ResetToEarliest kind mismatch")
+	}
+	if ResetToLatest().Kind != OffsetResetLatest {
+		t.Error("ResetToLatest kind mismatch")
+	}
+	if to := ResetToOffset(42); to.Kind != OffsetResetOffset || to.Offset != 42 {
+		t.Errorf("ResetToOffset mismatch: %+v", to)
+	}
+	now := time.Now()
+	if to := ResetToTimestamp(now); to.Kind != OffsetResetTimestamp || !to.Timestamp.Equal(now) {
+		t.Errorf("ResetToTimestamp mismatch: %+v", to)
+	}
+}
+
+func TestKafkaClient_GroupLag(t *testing.T) {
+	config := &KafkaConfig{
+		Brokers: []string{
+			"127.0.0.1:19091",
+			"127.0.0.1:19092",
+			"127.0.0.1:19093",
+		},
+		ClientID: "test-group-client",
+	}
+
+	client, err := NewKafkaClient(config)
+	if err != nil {
+		t.Logf("Failed to create kafka client (expected if no Kafka running): %v", err)
+		return
+	}
+	defer client.Close()
+
+	groups, err := client.ListConsumerGroups()
+	if err != nil {
+		t.Logf("Failed to list consumer groups: %v", err)
+		return
+	}
+
+	for group := range groups {
+		lags, err := client.GroupLag(group)
+		if err != nil {
+			t.Logf("Failed to get lag of group %s: %v", group, err)
+			continue
+		}
+		for _, lag := range lags {
+			t.Logf("group=%s topic=%s partition=%d committed=%d hwm=%d lag=%d",
+				group, lag.Topic, lag.Partition, lag.CommittedOffset, lag.HighWatermark, lag.Lag)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package kafkatools
+
+import (
+	"context"
+
+	"github.com/IBM/sarama"
+)
+
+// Producer 消息生产能力，KafkaClient 与 kafkatest.Broker 均实现该接口
+type Producer interface {
+	ProduceMessage(topic string, message []byte, opts ...ProduceOptions) error
+	ProduceMessages(topic string, messages [][]byte, opts ...ProduceOptions) error
+}
+
+// Consumer 消费组消费能力，KafkaClient 与 kafkatest.Broker 均实现该接口
+type Consumer interface {
+	ConsumeGroup(ctx context.Context, group string, topics []string, handler MessageHandler, opts ...ConsumeOptions) error
+}
+
+// BatchConsumer 消费组批量消费能力，KafkaClient 与 kafkatest.Broker 均实现该接口
+type BatchConsumer interface {
+	ConsumeGroupBatch(ctx context.Context, group string, topics []string, handler BatchHandler, batch BatchOptions, opts ...ConsumeOptions) error
+}
+
+// TopicAdmin Topic管理能力，KafkaClient 与 kafkatest.Broker 均实现该接口
+type TopicAdmin interface {
+	CreateTopic(topicConfig TopicConfig) error
+	CreateTopics(topicConfigs []TopicConfig) error
+	ListTopics() (map[string]sarama.TopicDetail, error)
+	DeleteTopic(topicName string) error
+	DeleteTopics(topicNames []string) error
+	TopicExists(topicName string) (bool, error)
+}
+
+var (
+	_ Producer      = (*KafkaClient)(nil)
+	_ Consumer      = (*KafkaClient)(nil)
+	_ BatchConsumer = (*KafkaClient)(nil)
+	_ TopicAdmin    = (*KafkaClient)(nil)
+)
@@ -0,0 +1,477 @@
+// Package kafkatest 提供内存版的Kafka Broker，用于在没有Kafka集群的情况下测试依赖 kafkatools 的代码
+package kafkatest
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/OnlyPiglet/fly/kafkatools"
+)
+
+var (
+	_ kafkatools.Producer      = (*Broker)(nil)
+	_ kafkatools.Consumer      = (*Broker)(nil)
+	_ kafkatools.BatchConsumer = (*Broker)(nil)
+	_ kafkatools.TopicAdmin    = (*Broker)(nil)
+)
+
+// Option Broker 的可选配置
+type Option func(*Broker)
+
+// WithDefaultPartitions 自动创建topic时使用的分区数，默认1
+func WithDefaultPartitions(n int32) Option {
+	return func(b *Broker) {
+		if n > 0 {
+			b.defaultPartitions = n
+		}
+	}
+}
+
+// WithoutAutoCreate 禁止发送时自动创建topic，向不存在的topic发送会返回 sarama.ErrUnknownTopicOrPartition
+func WithoutAutoCreate() Option {
+	return func(b *Broker) {
+		b.autoCreate = false
+	}
+}
+
+// topic 单个topic的数据，partitions[i] 为第i个分区的消息，下标即offset
+type topic struct {
+	detail     sarama.TopicDetail
+	partitions [][]*sarama.ConsumerMessage
+	nextRR     int32 // 无Key消息的轮询分区
+}
+
+// Broker 内存版Kafka，按 topic/partition 记录消息，支持消费组消费与错误注入
+type Broker struct {
+	mu                sync.Mutex
+	defaultPartitions int32
+	autoCreate        bool
+	topics            map[string]*topic
+	committed         map[string]map[string]map[int32]int64 // group -> topic -> partition -> 下一条待消费offset
+	produceErrs       map[string]error                      // topic -> 注入的错误，"" 表示所有topic
+	adminErr          error
+	changed           chan struct{} // 有新消息时关闭并重建，用于唤醒消费者
+}
+
+// NewBroker 创建内存Broker
+func NewBroker(opts ...Option) *Broker {
+	b := &Broker{
+		defaultPartitions: 1,
+		autoCreate:        true,
+		topics:            make(map[string]*topic),
+		committed:         make(map[string]map[string]map[int32]int64),
+		produceErrs:       make(map[string]error),
+		changed:           make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// -------- 错误注入 --------
+
+// InjectProduceError 之后发往 topic 的消息都返回 err，topic 为空表示所有topic，err 为nil时清除
+func (b *Broker) InjectProduceError(topic string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		delete(b.produceErrs, topic)
+		return
+	}
+	b.produceErrs[topic] = err
+}
+
+// InjectAdminError 之后所有Topic管理操作都返回 err，err 为nil时清除
+func (b *Broker) InjectAdminError(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.adminErr = err
+}
+
+// -------- 生产 --------
+
+// ProduceMessage 发送单条消息
+func (b *Broker) ProduceMessage(topic string, message []byte, opts ...kafkatools.ProduceOptions) error {
+	return b.ProduceMessages(topic, [][]byte{message}, opts...)
+}
+
+// ProduceMessages 批量发送消息，任意一条失败时整批都不写入
+func (b *Broker) ProduceMessages(topicName string, messages [][]byte, opts ...kafkatools.ProduceOptions) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	var opt kafkatools.ProduceOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.produceErrs[topicName]; err != nil {
+		return err
+	}
+	if err := b.produceErrs[""]; err != nil {
+		return err
+	}
+
+	t, ok := b.topics[topicName]
+	if !ok {
+		if !b.autoCreate {
+			return sarama.ErrUnknownTopicOrPartition
+		}
+		t = b.createTopicLocked(topicName, b.defaultPartitions, 1, nil)
+	}
+
+	if opt.Partition != nil && (*opt.Partition < 0 || *opt.Partition >= int32(len(t.partitions))) {
+		return sarama.ErrUnknownTopicOrPartition
+	}
+
+	timestamp := time.Now()
+	if opt.Timestamp != nil {
+		timestamp = *opt.Timestamp
+	}
+	var headers []*sarama.RecordHeader
+	for k, v := range opt.Headers {
+		headers = append(headers, &sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	var key []byte
+	if opt.Key != "" {
+		key = []byte(opt.Key)
+	}
+
+	for _, message := range messages {
+		partition := b.choosePartition(t, key, opt.Partition)
+		t.partitions[partition] = append(t.partitions[partition], &sarama.ConsumerMessage{
+			Headers:   headers,
+			Timestamp: timestamp,
+			Key:       key,
+			Value:     append([]byte(nil), message...),
+			Topic:     topicName,
+			Partition: partition,
+			Offset:    int64(len(t.partitions[partition])),
+		})
+	}
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+	return nil
+}
+
+// choosePartition 指定分区优先，其次按Key哈希，否则轮询
+func (b *Broker) choosePartition(t *topic, key []byte, partition *int32) int32 {
+	n := int32(len(t.partitions))
+	if partition != nil {
+		return *partition
+	}
+	if key != nil {
+		h := fnv.New32a()
+		_, _ = h.Write(key)
+		return int32(h.Sum32() % uint32(n))
+	}
+	p := t.nextRR % n
+	t.nextRR++
+	return p
+}
+
+// -------- 查询 --------
+
+// Messages 返回 topic 所有分区的消息，按分区、offset排序
+func (b *Broker) Messages(topicName string) []*sarama.ConsumerMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[topicName]
+	if !ok {
+		return nil
+	}
+	var result []*sarama.ConsumerMessage
+	for _, msgs := range t.partitions {
+		result = append(result, msgs...)
+	}
+	return result
+}
+
+// PartitionMessages 返回 topic 指定分区的消息
+func (b *Broker) PartitionMessages(topicName string, partition int32) []*sarama.ConsumerMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.topics[topicName]
+	if !ok || partition < 0 || partition >= int32(len(t.partitions)) {
+		return nil
+	}
+	return append([]*sarama.ConsumerMessage(nil), t.partitions[partition]...)
+}
+
+// CommittedOffset 返回消费组在分区上已提交的offset（下一条待消费消息），未提交时返回-1
+func (b *Broker) CommittedOffset(group, topicName string, partition int32) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if offset, ok := b.committed[group][topicName][partition]; ok {
+		return offset
+	}
+	return -1
+}
+
+// -------- 消费 --------
+
+// ConsumeGroup 以消费组方式消费，语义同 KafkaClient.ConsumeGroup
+// 同一消费组的进度保存在 Broker 中，handler 返回nil后提交offset；
+// 与Kafka一致，没有已提交offset时默认从最新位置开始，消费已存在的消息需指定 InitialOffset 为 sarama.OffsetOldest
+func (b *Broker) ConsumeGroup(ctx context.Context, group string, topics []string, handler kafkatools.MessageHandler, opts ...kafkatools.ConsumeOptions) error {
+	if group == "" {
+		return fmt.Errorf("group name cannot be empty")
+	}
+	if len(topics) == 0 {
+		return fmt.Errorf("topics cannot be empty")
+	}
+	if handler == nil {
+		return fmt.Errorf("message handler cannot be nil")
+	}
+	var opt kafkatools.ConsumeOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	for first := true; ; first = false {
+		msgs, changed := b.nextMessages(group, topics, opt.InitialOffset, first, 1)
+		if msgs == nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-changed:
+				continue
+			}
+		}
+		msg := msgs[0]
+		if err := handler(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				// 与真实消费组一致：取消导致的失败不提交，也不返回错误
+				return nil
+			}
+			return fmt.Errorf("handle message %s/%d@%d: %w", msg.Topic, msg.Partition, msg.Offset, err)
+		}
+		b.commit(group, msg)
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// ConsumeGroupBatch 以消费组方式批量消费，语义同 KafkaClient.ConsumeGroupBatch
+// 每批只包含同一分区的消息；与真实消费组不同，已有消息会立即组成一批交给 handler，不等待 MaxWait
+func (b *Broker) ConsumeGroupBatch(ctx context.Context, group string, topics []string, handler kafkatools.BatchHandler, batch kafkatools.BatchOptions, opts ...kafkatools.ConsumeOptions) error {
+	if group == "" {
+		return fmt.Errorf("group name cannot be empty")
+	}
+	if len(topics) == 0 {
+		return fmt.Errorf("topics cannot be empty")
+	}
+	if handler == nil {
+		return fmt.Errorf("batch handler cannot be nil")
+	}
+	var opt kafkatools.ConsumeOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	maxMessages := batch.MaxMessages
+	if maxMessages <= 0 {
+		maxMessages = 1000
+	}
+
+	for first := true; ; first = false {
+		msgs, changed := b.nextMessages(group, topics, opt.InitialOffset, first, maxMessages)
+		if msgs == nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-changed:
+				continue
+			}
+		}
+		if err := handler(ctx, msgs); err != nil {
+			if ctx.Err() != nil {
+				// 与真实消费组一致：取消导致的失败整批不提交，也不返回错误
+				return nil
+			}
+			return fmt.Errorf("handle batch %s/%d@%d-%d: %w", msgs[0].Topic, msgs[0].Partition, msgs[0].Offset, msgs[len(msgs)-1].Offset, err)
+		}
+		b.commit(group, msgs[len(msgs)-1])
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// nextMessages 返回消费组在同一分区上最多 max 条待消费消息；没有消息时返回用于等待新消息的channel
+// first 为true时，没有已提交offset的分区按 initialOffset 确定起始位置；之后新出现的分区从头消费
+func (b *Broker) nextMessages(group string, topics []string, initialOffset int64, first bool, max int) ([]*sarama.ConsumerMessage, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sorted := append([]string(nil), topics...)
+	sort.Strings(sorted)
+
+	// 首次拉取时为所有没有已提交offset的分区确定起始位置
+	if first && initialOffset != sarama.OffsetOldest {
+		for _, name := range sorted {
+			t, ok := b.topics[name]
+			if !ok {
+				continue
+			}
+			for p, msgs := range t.partitions {
+				if _, ok := b.committed[group][name][int32(p)]; !ok {
+					// 与 KafkaClient 默认值一致：没有已提交offset时从最新位置开始
+					b.setCommittedLocked(group, name, int32(p), int64(len(msgs)))
+				}
+			}
+		}
+	}
+
+	for _, name := range sorted {
+		t, ok := b.topics[name]
+		if !ok {
+			continue
+		}
+		for p, msgs := range t.partitions {
+			offset := b.committed[group][name][int32(p)]
+			if offset < int64(len(msgs)) {
+				end := min(offset+int64(max), int64(len(msgs)))
+				return append([]*sarama.ConsumerMessage(nil), msgs[offset:end]...), nil
+			}
+		}
+	}
+	return nil, b.changed
+}
+
+func (b *Broker) commit(group string, msg *sarama.ConsumerMessage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.setCommittedLocked(group, msg.Topic, msg.Partition, msg.Offset+1)
+}
+
+func (b *Broker) setCommittedLocked(group, topicName string, partition int32, offset int64) {
+	if b.committed[group] == nil {
+		b.committed[group] = make(map[string]map[int32]int64)
+	}
+	if b.committed[group][topicName] == nil {
+		b.committed[group][topicName] = make(map[int32]int64)
+	}
+	b.committed[group][topicName][partition] = offset
+}
+
+// -------- Topic 管理 --------
+
+func (b *Broker) createTopicLocked(name string, partitions int32, replication int16, entries map[string]string) *topic {
+	t := &topic{
+		detail: sarama.TopicDetail{
+			NumPartitions:     partitions,
+			ReplicationFactor: replication,
+			ConfigEntries:     make(map[string]*string, len(entries)),
+		},
+		partitions: make([][]*sarama.ConsumerMessage, partitions),
+	}
+	for k, v := range entries {
+		value := v
+		t.detail.ConfigEntries[k] = &value
+	}
+	b.topics[name] = t
+	return t
+}
+
+// CreateTopic 创建Topic，已存在时返回 sarama.ErrTopicAlreadyExists
+func (b *Broker) CreateTopic(topicConfig kafkatools.TopicConfig) error {
+	return b.CreateTopics([]kafkatools.TopicConfig{topicConfig})
+}
+
+// CreateTopics 批量创建Topic
+func (b *Broker) CreateTopics(topicConfigs []kafkatools.TopicConfig) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.adminErr != nil {
+		return b.adminErr
+	}
+	for _, c := range topicConfigs {
+		if c.Name == "" {
+			return fmt.Errorf("topic name cannot be empty")
+		}
+		if _, ok := b.topics[c.Name]; ok {
+			return fmt.Errorf("failed to create topic %s: %w", c.Name, sarama.ErrTopicAlreadyExists)
+		}
+	}
+	for _, c := range topicConfigs {
+		partitions := c.NumPartitions
+		if partitions <= 0 {
+			partitions = 1
+		}
+		replication := c.ReplicationFactor
+		if replication <= 0 {
+			replication = 1
+		}
+		b.createTopicLocked(c.Name, partitions, replication, c.ConfigEntries)
+	}
+	return nil
+}
+
+// ListTopics 列出所有Topic
+func (b *Broker) ListTopics() (map[string]sarama.TopicDetail, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.adminErr != nil {
+		return nil, b.adminErr
+	}
+	result := make(map[string]sarama.TopicDetail, len(b.topics))
+	for name, t := range b.topics {
+		result[name] = t.detail
+	}
+	return result, nil
+}
+
+// DeleteTopic 删除Topic及其消息
+func (b *Broker) DeleteTopic(topicName string) error {
+	return b.DeleteTopics([]string{topicName})
+}
+
+// DeleteTopics 批量删除Topic
+func (b *Broker) DeleteTopics(topicNames []string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.adminErr != nil {
+		return b.adminErr
+	}
+	for _, name := range topicNames {
+		if name == "" {
+			return fmt.Errorf("topic name cannot be empty")
+		}
+		if _, ok := b.topics[name]; !ok {
+			return fmt.Errorf("failed to delete topic %s: %w", name, sarama.ErrUnknownTopicOrPartition)
+		}
+	}
+	for _, name := range topicNames {
+		delete(b.topics, name)
+		for _, topics := range b.committed {
+			delete(topics, name)
+		}
+	}
+	return nil
+}
+
+// TopicExists 检查Topic是否存在
+func (b *Broker) TopicExists(topicName string) (bool, error) {
+	if topicName == "" {
+		return false, fmt.Errorf("topic name cannot be empty")
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.adminErr != nil {
+		return false, b.adminErr
+	}
+	_, ok := b.topics[topicName]
+	return ok, nil
+}
@@ -0,0 +1,236 @@
+package kafkatest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"github.com/OnlyPiglet/fly/kafkatools"
+)
+
+type order struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
+}
+
+func TestBroker_ProduceAndConsume(t *testing.T) {
+	b := NewBroker(WithDefaultPartitions(3))
+
+	for i := 0; i < 6; i++ {
+		if err := b.ProduceMessage("events", []byte{byte(i)}, kafkatools.ProduceOptions{Key: "user-1"}); err != nil {
+			t.Fatalf("produce: %v", err)
+		}
+	}
+	msgs := b.Messages("events")
+	if len(msgs) != 6 {
+		t.Fatalf("expected 6 messages, got %d", len(msgs))
+	}
+	// 相同Key的消息落在同一分区且offset连续
+	for i, m := range msgs {
+		if m.Partition != msgs[0].Partition || m.Offset != int64(i) {
+			t.Errorf("message %d at %d@%d, want partition %d offset %d", i, m.Partition, m.Offset, msgs[0].Partition, i)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []byte
+	err := b.ConsumeGroup(ctx, "g1", []string{"events"}, func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		got = append(got, msg.Value...)
+		if len(got) == 6 {
+			cancel()
+		}
+		return nil
+	}, kafkatools.ConsumeOptions{InitialOffset: sarama.OffsetOldest})
+	if err != nil {
+		t.Fatalf("consume: %v", err)
+	}
+	if string(got) != string([]byte{0, 1, 2, 3, 4, 5}) {
+		t.Errorf("unexpected consumed values %v", got)
+	}
+	if off := b.CommittedOffset("g1", "events", msgs[0].Partition); off != 6 {
+		t.Errorf("expected committed offset 6, got %d", off)
+	}
+}
+
+func TestBroker_ConsumeWaitsForNewMessages(t *testing.T) {
+	b := NewBroker()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- b.ConsumeGroup(ctx, "g1", []string{"late"}, func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			if string(msg.Value) != "hello" {
+				t.Errorf("unexpected value %q", msg.Value)
+			}
+			cancel()
+			return nil
+		})
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if err := b.ProduceMessage("late", []byte("hello")); err != nil {
+		t.Fatalf("produce: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("consume: %v", err)
+	}
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Errorf("consumer did not receive the message before timeout")
+	}
+}
+
+func TestBroker_HandlerErrorStopsWithoutCommit(t *testing.T) {
+	b := NewBroker()
+	_ = b.ProduceMessage("events", []byte("a"))
+
+	errBoom := errors.New("boom")
+	err := b.ConsumeGroup(context.Background(), "g1", []string{"events"}, func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		return errBoom
+	}, kafkatools.ConsumeOptions{InitialOffset: sarama.OffsetOldest})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("expected handler error, got %v", err)
+	}
+	if off := b.CommittedOffset("g1", "events", 0); off != -1 {
+		t.Errorf("failed message should not be committed, got offset %d", off)
+	}
+}
+
+func TestBroker_InjectErrors(t *testing.T) {
+	b := NewBroker()
+	errDown := errors.New("broker down")
+
+	b.InjectProduceError("orders", errDown)
+	if err := b.ProduceMessage("orders", []byte("x")); !errors.Is(err, errDown) {
+		t.Errorf("expected injected error, got %v", err)
+	}
+	if err := b.ProduceMessage("other", []byte("x")); err != nil {
+		t.Errorf("other topics should not fail: %v", err)
+	}
+	b.InjectProduceError("orders", nil)
+	if err := b.ProduceMessage("orders", []byte("x")); err != nil {
+		t.Errorf("expected error cleared, got %v", err)
+	}
+
+	b.InjectAdminError(errDown)
+	if _, err := b.TopicExists("orders"); !errors.Is(err, errDown) {
+		t.Errorf("expected injected admin error, got %v", err)
+	}
+}
+
+func TestBroker_TopicAdmin(t *testing.T) {
+	b := NewBroker(WithoutAutoCreate())
+	var admin kafkatools.TopicAdmin = b
+
+	if err := b.ProduceMessage("missing", []byte("x")); !errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+		t.Errorf("expected unknown topic error, got %v", err)
+	}
+	if err := admin.CreateTopic(kafkatools.TopicConfig{Name: "t1", NumPartitions: 4}); err != nil {
+		t.Fatalf("create topic: %v", err)
+	}
+	if err := admin.CreateTopic(kafkatools.TopicConfig{Name: "t1"}); !errors.Is(err, sarama.ErrTopicAlreadyExists) {
+		t.Errorf("expected topic exists error, got %v", err)
+	}
+	topics, _ := admin.ListTopics()
+	if topics["t1"].NumPartitions != 4 {
+		t.Errorf("unexpected topic detail %+v", topics["t1"])
+	}
+	if err := admin.DeleteTopic("t1"); err != nil {
+		t.Fatalf("delete topic: %v", err)
+	}
+	if ok, _ := admin.TopicExists("t1"); ok {
+		t.Error("topic should be deleted")
+	}
+}
+
+func TestBroker_TypedRoundTrip(t *testing.T) {
+	b := NewBroker()
+	serde := kafkatools.JSONSerde[order]{Version: "v1"}
+	orders := []order{{ID: 1, Status: "paid"}, {ID: 2, Status: "shipped"}}
+	if err := kafkatools.ProduceTyped[order](b, "orders", orders, serde); err != nil {
+		t.Fatalf("produce typed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var got []order
+	err := kafkatools.ConsumeTyped(ctx, b, "g1", []string{"orders"}, []kafkatools.Serde[order]{serde},
+		func(ctx context.Context, o order, msg *sarama.ConsumerMessage) error {
+			got = append(got, o)
+			if len(got) == len(orders) {
+				cancel()
+			}
+			return nil
+		}, kafkatools.ConsumeOptions{InitialOffset: sarama.OffsetOldest})
+	if err != nil {
+		t.Fatalf("consume typed: %v", err)
+	}
+	if len(got) != 2 || got[0] != orders[0] || got[1] != orders[1] {
+		t.Errorf("unexpected orders %+v", got)
+	}
+}
+
+func TestBroker_ConsumeGroupBatch(t *testing.T) {
+	b := NewBroker()
+	for i := 0; i < 5; i++ {
+		_ = b.ProduceMessage("events", []byte{byte(i)})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var sizes []int
+	err := b.ConsumeGroupBatch(ctx, "g1", []string{"events"}, func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+		sizes = append(sizes, len(msgs))
+		if msgs[len(msgs)-1].Offset == 4 {
+			cancel()
+		}
+		return nil
+	}, kafkatools.BatchOptions{MaxMessages: 2}, kafkatools.ConsumeOptions{InitialOffset: sarama.OffsetOldest})
+	if err != nil {
+		t.Fatalf("consume: %v", err)
+	}
+	if len(sizes) != 3 || sizes[0] != 2 || sizes[2] != 1 {
+		t.Errorf("unexpected batch sizes %v", sizes)
+	}
+	if off := b.CommittedOffset("g1", "events", 0); off != 5 {
+		t.Errorf("expected committed offset 5, got %d", off)
+	}
+}
+
+func TestBroker_ConsumeGroupCancelledHandlerError(t *testing.T) {
+	b := NewBroker()
+	_ = b.ProduceMessage("events", []byte("a"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := b.ConsumeGroup(ctx, "g1", []string{"events"}, func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		cancel()
+		return ctx.Err()
+	}, kafkatools.ConsumeOptions{InitialOffset: sarama.OffsetOldest})
+	if err != nil {
+		t.Fatalf("expected clean stop on cancel, got %v", err)
+	}
+	if off := b.CommittedOffset("g1", "events", 0); off != -1 {
+		t.Errorf("expected nothing committed, got %d", off)
+	}
+}
+
+func TestBroker_ConsumeGroupBatchCancelledHandlerError(t *testing.T) {
+	b := NewBroker()
+	_ = b.ProduceMessage("events", []byte("a"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := b.ConsumeGroupBatch(ctx, "g1", []string{"events"}, func(ctx context.Context, msgs []*sarama.ConsumerMessage) error {
+		cancel()
+		return ctx.Err()
+	}, kafkatools.BatchOptions{}, kafkatools.ConsumeOptions{InitialOffset: sarama.OffsetOldest})
+	if err != nil {
+		t.Fatalf("expected clean stop on cancel, got %v", err)
+	}
+	if off := b.CommittedOffset("g1", "events", 0); off != -1 {
+		t.Errorf("expected nothing committed, got %d", off)
+	}
+}
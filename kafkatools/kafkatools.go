@@ -1,6 +1,7 @@
 package kafkatools
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -15,19 +16,60 @@ type KafkaConfig struct {
 	ClientID string   `json:"client_id,omitempty"`
 	// SASL配置
 	SASLEnabled   bool   `json:"sasl_enabled,omitempty"`
-	SASLMechanism string `json:"sasl_mechanism,omitempty"` // PLAIN, SCRAM-SHA-256, SCRAM-SHA-512
-	// TLS配置
-	TLSEnabled bool `json:"tls_enabled,omitempty"`
+	SASLMechanism string `json:"sasl_mechanism,omitempty"` // PLAIN, SCRAM-SHA-256, SCRAM-SHA-512, OAUTHBEARER
+	// TLS配置，证书可以通过文件或PEM内容提供（二选一）
+	TLSEnabled            bool   `json:"tls_enabled,omitempty"`
+	TLSCAFile             string `json:"tls_ca_file,omitempty"`              // CA证书文件
+	TLSCAPEM              string `json:"tls_ca_pem,omitempty"`               // CA证书PEM内容
+	TLSCertFile           string `json:"tls_cert_file,omitempty"`            // 客户端证书文件（mTLS）
+	TLSCertPEM            string `json:"tls_cert_pem,omitempty"`             // 客户端证书PEM内容（mTLS）
+	TLSKeyFile            string `json:"tls_key_file,omitempty"`             // 客户端私钥文件（mTLS）
+	TLSKeyPEM             string `json:"tls_key_pem,omitempty"`              // 客户端私钥PEM内容（mTLS）
+	TLSServerName         string `json:"tls_server_name,omitempty"`          // 校验服务端证书时使用的主机名
+	TLSInsecureSkipVerify bool   `json:"tls_insecure_skip_verify,omitempty"` // 跳过服务端证书校验
 	// 网络配置
 	ForceDirectConnection bool   `json:"force_direct_connection,omitempty"` // 强制使用指定的broker地址，忽略advertised.listeners
 	KafkaVersion          string `json:"kafka_version,omitempty"`           // Kafka版本，如 "2.8.0"
+	// Topic配置
+	AutoCreate            AutoCreatePolicy `json:"auto_create,omitempty"`              // 发送时topic不存在的自动创建策略
+	TopicCacheTTL         time.Duration    `json:"topic_cache_ttl,omitempty"`          // topic存在性缓存时间，默认5分钟
+	TopicNegativeCacheTTL time.Duration    `json:"topic_negative_cache_ttl,omitempty"` // topic不存在的缓存时间，默认10秒
+}
+
+// Logger 日志接口，*log.Logger 满足该接口
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+// stdoutLogger 默认日志，输出到标准输出
+type stdoutLogger struct{}
+
+func (stdoutLogger) Printf(format string, v ...any) {
+	fmt.Printf(format+"\n", v...)
+}
+
+// Option KafkaClient 的可选配置
+type Option func(*KafkaClient)
+
+// WithLogger 设置警告日志的输出，默认输出到标准输出
+func WithLogger(l Logger) Option {
+	return func(k *KafkaClient) {
+		if l != nil {
+			k.logger = l
+		}
+	}
 }
 
 type KafkaClient struct {
-	config   KafkaConfig
-	producer sarama.SyncProducer
-	// consumer sarama.Consumer // 暂时不需要消费者功能
-	admin    sarama.ClusterAdmin // 用于管理topic
+	config       KafkaConfig
+	saramaConfig *sarama.Config // 创建消费组时复用的基础配置
+	producer     sarama.SyncProducer
+	admin        sarama.ClusterAdmin // 用于管理topic
+	client       sarama.Client       // 用于查询分区offset、提交消费组offset
+	topicCache   *topicCache         // topic存在性缓存，避免每次发送都拉取元数据
+	logger       Logger
+	// OAUTHBEARER 认证的token提供者
+	tokenProvider sarama.AccessTokenProvider
 }
 
 // initialize 初始化Kafka配置
@@ -63,6 +105,9 @@ func (k *KafkaClient) initialize() error {
 	config.Metadata.Retry.Backoff = 250 * time.Millisecond
 	config.Metadata.RefreshFrequency = 0 // 禁用自动刷新元数据
 	
+	// 关闭自动创建时也不允许broker在拉取元数据时自动创建topic
+	config.Metadata.AllowAutoTopicCreation = !k.config.AutoCreate.Disabled
+
 	// 如果启用强制直连，则不允许broker地址重定向
 	if k.config.ForceDirectConnection {
 		config.Metadata.AllowAutoTopicCreation = false
@@ -73,7 +118,6 @@ func (k *KafkaClient) initialize() error {
 	
 	// 默认启用强制直连模式来避免 advertised.listeners 问题
 	config.Metadata.Full = true  // 需要完整的元数据来创建 ClusterAdmin
-	config.Metadata.AllowAutoTopicCreation = true
 	
 	// Producer配置
 	config.Producer.RequiredAcks = sarama.WaitForAll
@@ -83,32 +127,19 @@ func (k *KafkaClient) initialize() error {
 	config.Producer.Retry.Max = 3
 	config.Producer.Retry.Backoff = 100 * time.Millisecond
 	
-	// Consumer配置 (暂时注释)
-	// config.Consumer.Return.Errors = true
-	// config.Consumer.Offsets.Initial = sarama.OffsetNewest
-	// config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRoundRobin
+	// Consumer配置
+	config.Consumer.Return.Errors = true
+	config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRoundRobin()}
 	
 	// SASL配置
-	if k.config.SASLEnabled {
-		config.Net.SASL.Enable = true
-		config.Net.SASL.User = k.config.Username
-		config.Net.SASL.Password = k.config.Password
-		
-		switch k.config.SASLMechanism {
-		case "PLAIN":
-			config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
-		case "SCRAM-SHA-256":
-			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
-		case "SCRAM-SHA-512":
-			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
-		default:
-			config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
-		}
+	if err := k.applySASL(config); err != nil {
+		return fmt.Errorf("invalid sasl config: %w", err)
 	}
 	
 	// TLS配置
-	if k.config.TLSEnabled {
-		config.Net.TLS.Enable = true
+	if err := k.applyTLS(config); err != nil {
+		return fmt.Errorf("invalid tls config: %w", err)
 	}
 	
 	// 创建Producer
@@ -117,32 +148,40 @@ func (k *KafkaClient) initialize() error {
 		return fmt.Errorf("failed to create producer: %w", err)
 	}
 	k.producer = producer
-	
-	// 创建Consumer (暂时注释)
-	// consumer, err := sarama.NewConsumer(k.config.Brokers, config)
-	// if err != nil {
-	// 	producer.Close()
-	// 	return fmt.Errorf("failed to create consumer: %w", err)
-	// }
-	// k.consumer = consumer
+	k.saramaConfig = config
 	
 	// 创建ClusterAdmin用于管理topic（可选）
 	admin, err := sarama.NewClusterAdmin(k.config.Brokers, config)
 	if err != nil {
 		// ClusterAdmin创建失败不影响Producer功能
-		fmt.Printf("Warning: failed to create cluster admin: %v\n", err)
-		fmt.Println("Topic management features will be disabled, but message production will work")
+		k.logger.Printf("Warning: failed to create cluster admin: %v", err)
+		k.logger.Printf("Topic management features will be disabled, but message production will work")
 		k.admin = nil
 	} else {
 		k.admin = admin
 	}
 	
+	// 创建Client用于消费组offset管理（可选）
+	client, err := sarama.NewClient(k.config.Brokers, config)
+	if err != nil {
+		k.logger.Printf("Warning: failed to create kafka client: %v", err)
+		k.logger.Printf("Consumer group offset features will be disabled, but message production will work")
+		k.client = nil
+	} else {
+		k.client = client
+	}
+	
 	return nil
 }
 
-func NewKafkaClient(kc *KafkaConfig) (*KafkaClient, error) {
+func NewKafkaClient(kc *KafkaConfig, opts ...Option) (*KafkaClient, error) {
 	client := &KafkaClient{
-		config: *kc,
+		config:     *kc,
+		topicCache: newTopicCache(kc.TopicCacheTTL, kc.TopicNegativeCacheTTL),
+		logger:     stdoutLogger{},
+	}
+	for _, opt := range opts {
+		opt(client)
 	}
 	
 	// 默认配置
@@ -167,18 +206,18 @@ func (k *KafkaClient) Close() error {
 		}
 	}
 	
-	// if k.consumer != nil {
-	// 	if err := k.consumer.Close(); err != nil {
-	// 		errs = append(errs, fmt.Errorf("close consumer: %w", err))
-	// 	}
-	// }
-	
 	if k.admin != nil {
 		if err := k.admin.Close(); err != nil {
 			errs = append(errs, fmt.Errorf("close admin: %w", err))
 		}
 	}
 	
+	if k.client != nil {
+		if err := k.client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close client: %w", err))
+		}
+	}
+	
 	if len(errs) > 0 {
 		return fmt.Errorf("close kafka client: %v", errs)
 	}
@@ -200,12 +239,29 @@ type ProduceOptions struct {
 // 如果topic不存在会自动创建，存在则不管
 func (k *KafkaClient) ProduceMessage(topic string, message []byte, opts ...ProduceOptions) error {
 	// 检查并自动创建topic（如果admin可用）
-	if k.admin != nil {
-		if err := k.ensureTopicExists(topic); err != nil {
-			// 如果topic检查失败，记录警告但继续尝试发送
-			// 某些情况下Kafka会自动创建topic
-			fmt.Printf("Warning: could not ensure topic exists: %v\n", err)
-		}
+	if err := k.prepareTopic(topic); err != nil {
+		return err
+	}
+	
+	var opt ProduceOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	
+	_, _, err := k.producer.SendMessage(buildProducerMessage(topic, message, opt))
+	return err
+}
+
+// ProduceMessages 批量发送已序列化的消息，所有消息使用相同的选项
+// 如果topic不存在会自动创建，存在则不管
+func (k *KafkaClient) ProduceMessages(topic string, messages [][]byte, opts ...ProduceOptions) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	
+	// 检查并自动创建topic（如果admin可用）
+	if err := k.prepareTopic(topic); err != nil {
+		return err
 	}
 	
 	var opt ProduceOptions
@@ -213,6 +269,33 @@ func (k *KafkaClient) ProduceMessage(topic string, message []byte, opts ...Produ
 		opt = opts[0]
 	}
 	
+	producerMessages := make([]*sarama.ProducerMessage, 0, len(messages))
+	for _, data := range messages {
+		producerMessages = append(producerMessages, buildProducerMessage(topic, data, opt))
+	}
+	
+	return k.producer.SendMessages(producerMessages)
+}
+
+// prepareTopic 发送前确认topic存在，不存在时按 AutoCreate 策略创建
+// 关闭自动创建且确认topic不存在时直接返回错误；元数据查询失败等其他错误只记录警告并继续发送
+func (k *KafkaClient) prepareTopic(topic string) error {
+	if k.admin == nil {
+		return nil
+	}
+	err := k.ensureTopicExists(topic)
+	if err == nil {
+		return nil
+	}
+	if k.config.AutoCreate.Disabled && errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+		return err
+	}
+	k.logger.Printf("Warning: could not ensure topic exists: %v", err)
+	return nil
+}
+
+// buildProducerMessage 按选项构造待发送的消息
+func buildProducerMessage(topic string, message []byte, opt ProduceOptions) *sarama.ProducerMessage {
 	msg := &sarama.ProducerMessage{
 		Topic: topic,
 		Value: sarama.ByteEncoder(message),
@@ -245,105 +328,30 @@ func (k *KafkaClient) ProduceMessage(topic string, message []byte, opts ...Produ
 		msg.Timestamp = *opt.Timestamp
 	}
 	
-	_, _, err := k.producer.SendMessage(msg)
-	return err
+	return msg
 }
 
 // ProduceBatch 批量发送消息（使用泛型）
 // 如果topic不存在会自动创建，存在则不管
-func ProduceBatch[T any](k *KafkaClient, topic string, messages []T, serializer func(T) ([]byte, error), opts ...ProduceOptions) error {
+func ProduceBatch[T any](p Producer, topic string, messages []T, serializer func(T) ([]byte, error), opts ...ProduceOptions) error {
 	if len(messages) == 0 {
 		return nil
 	}
 	
-	// 检查并自动创建topic（如果admin可用）
-	if k.admin != nil {
-		if err := k.ensureTopicExists(topic); err != nil {
-			// 如果topic检查失败，记录警告但继续尝试发送
-			// 某些情况下Kafka会自动创建topic
-			fmt.Printf("Warning: could not ensure topic exists: %v\n", err)
-		}
-	}
-	
-	var opt ProduceOptions
-	if len(opts) > 0 {
-		opt = opts[0]
-	}
-	
-	producerMessages := make([]*sarama.ProducerMessage, 0, len(messages))
-	
+	data := make([][]byte, 0, len(messages))
 	for _, msg := range messages {
-		data, err := serializer(msg)
+		b, err := serializer(msg)
 		if err != nil {
 			return fmt.Errorf("serialize message: %w", err)
 		}
-		
-		producerMsg := &sarama.ProducerMessage{
-			Topic: topic,
-			Value: sarama.ByteEncoder(data),
-		}
-		
-		// 应用选项
-		if opt.Key != "" {
-			producerMsg.Key = sarama.StringEncoder(opt.Key)
-		}
-		if opt.Partition != nil {
-			producerMsg.Partition = *opt.Partition
-		}
-		if len(opt.Headers) > 0 {
-			headers := make([]sarama.RecordHeader, 0, len(opt.Headers))
-			for k, v := range opt.Headers {
-				headers = append(headers, sarama.RecordHeader{
-					Key:   []byte(k),
-					Value: []byte(v),
-				})
-			}
-			producerMsg.Headers = headers
-		}
-		if opt.Timestamp != nil {
-			producerMsg.Timestamp = *opt.Timestamp
-		}
-		
-		producerMessages = append(producerMessages, producerMsg)
+		data = append(data, b)
 	}
 	
-	return k.producer.SendMessages(producerMessages)
+	return p.ProduceMessages(topic, data, opts...)
 }
 
 // -------- Topic 管理功能 --------
 
-// ensureTopicExists 确保topic存在，如果不存在则自动创建
-func (k *KafkaClient) ensureTopicExists(topicName string) error {
-	// 检查topic是否存在
-	exists, err := k.TopicExists(topicName)
-	if err != nil {
-		return fmt.Errorf("check topic existence: %w", err)
-	}
-	
-	// 如果topic已存在，直接返回
-	if exists {
-		return nil
-	}
-	
-	// 创建默认的topic配置
-	topicConfig := TopicConfig{
-		Name:          topicName,
-		NumPartitions: 1, // 默认1个分区
-		// ReplicationFactor 会自动设置为broker数量
-		ConfigEntries: map[string]string{
-			"cleanup.policy": "delete",
-			"retention.ms":   "604800000", // 7天
-		},
-	}
-	
-	// 创建topic
-	if err := k.CreateTopic(topicConfig); err != nil {
-		return fmt.Errorf("create topic: %w", err)
-	}
-	
-	return nil
-}
-
 // convertConfigEntries 将 map[string]string 转换为 map[string]*string
 func convertConfigEntries(entries map[string]string) map[string]*string {
 	if entries == nil {
@@ -408,6 +416,7 @@ func (k *KafkaClient) CreateTopic(topicConfig TopicConfig) error {
 	if err != nil {
 		return fmt.Errorf("failed to create topic %s: %w", topicConfig.Name, err)
 	}
+	k.topicCache.set(topicConfig.Name, true)
 	
 	return nil
 }
@@ -460,6 +469,7 @@ func (k *KafkaClient) CreateTopics(topicConfigs []TopicConfig) error {
 		if err != nil {
 			return fmt.Errorf("failed to create topic %s: %w", name, err)
 		}
+		k.topicCache.set(name, true)
 	}
 	
 	return nil
@@ -471,6 +481,7 @@ func (k *KafkaClient) ListTopics() (map[string]sarama.TopicDetail, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to list topics: %w", err)
 	}
+	k.topicCache.setAll(topics)
 	return topics, nil
 }
 
@@ -481,6 +492,7 @@ func (k *KafkaClient) DeleteTopic(topicName string) error {
 	}
 	
 	err := k.admin.DeleteTopic(topicName)
+	k.topicCache.invalidate(topicName)
 	if err != nil {
 		return fmt.Errorf("failed to delete topic %s: %w", topicName, err)
 	}
@@ -500,6 +512,7 @@ func (k *KafkaClient) DeleteTopics(topicNames []string) error {
 		}
 		
 		err := k.admin.DeleteTopic(name)
+		k.topicCache.invalidate(name)
 		if err != nil {
 			return fmt.Errorf("failed to delete topic %s: %w", name, err)
 		}
@@ -518,89 +531,8 @@ func (k *KafkaClient) TopicExists(topicName string) (bool, error) {
 	if err != nil {
 		return false, fmt.Errorf("failed to list topics: %w", err)
 	}
+	k.topicCache.setAll(topics)
 	
 	_, exists := topics[topicName]
 	return exists, nil
 }
-
-// -------- 消费者功能 (暂时注释) --------
-
-// 注释：消费者功能暂时不需要，如需使用请取消下面的注释
-
-// ConsumeOptions 消费消息的可选配置
-// type ConsumeOptions struct {
-// 	Partition     int32               // 指定分区
-// 	Offset        int64               // 起始偏移量
-// 	MaxMessages   int                 // 最大消息数量，0表示无限制
-// 	Timeout       time.Duration       // 消费超时时间
-// 	MessageFilter func([]byte) bool   // 消息过滤器
-// }
-
-// MessageHandler 消息处理函数
-// type MessageHandler func(message *sarama.ConsumerMessage) error
-
-// ConsumeMessages 消费指定主题和分区的消息
-// func (k *KafkaClient) ConsumeMessages(ctx context.Context, topic string, handler MessageHandler, opts ...ConsumeOptions) error {
-// 	var opt ConsumeOptions
-// 	if len(opts) > 0 {
-// 		opt = opts[0]
-// 	}
-// 	
-// 	// 默认配置
-// 	if opt.Offset == 0 {
-// 		opt.Offset = sarama.OffsetNewest
-// 	}
-// 	if opt.Timeout == 0 {
-// 		opt.Timeout = 30 * time.Second
-// 	}
-// 	
-// 	partitionConsumer, err := k.consumer.ConsumePartition(topic, opt.Partition, opt.Offset)
-// 	if err != nil {
-// 		return fmt.Errorf("create partition consumer: %w", err)
-// 	}
-// 	defer partitionConsumer.Close()
-// 	
-// 	var messageCount int
-// 	timeoutTimer := time.NewTimer(opt.Timeout)
-// 	defer timeoutTimer.Stop()
-// 	
-// 	for {
-// 		select {
-// 		case <-ctx.Done():
-// 			return ctx.Err()
-// 		case <-timeoutTimer.C:
-// 			return nil // 超时正常返回
-// 		case err := <-partitionConsumer.Errors():
-// 			if err != nil {
-// 				return fmt.Errorf("consumer error: %w", err)
-// 			}
-// 		case message := <-partitionConsumer.Messages():
-// 			if message == nil {
-// 				continue
-// 			}
-// 			
-// 			// 应用消息过滤器
-// 			if opt.MessageFilter != nil && !opt.MessageFilter(message.Value) {
-// 				continue
-// 			}
-// 			
-// 			// 处理消息
-// 			if err := handler(message); err != nil {
-// 				return fmt.Errorf("handle message: %w", err)
-// 			}
-// 			
-// 			messageCount++
-// 			
-// 			// 检查是否达到最大消息数量
-// 			if opt.MaxMessages > 0 && messageCount >= opt.MaxMessages {
-// 				return nil
-// 			}
-// 			
-// 			// 重置超时计时器
-// 			if !timeoutTimer.Stop() {
-// 				<-timeoutTimer.C
-// 			}
-// 			timeoutTimer.Reset(opt.Timeout)
-// 		}
-// 	}
-// }
\ No newline at end of file
@@ -0,0 +1,189 @@
+package kafkatools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// -------- 重试Topic与死信队列 --------
+
+// 重试链路写入的消息Headers
+const (
+	HeaderRetryAttempt      = "x-retry-attempt"      // 已失败的次数
+	HeaderRetryReason       = "x-retry-reason"       // 最近一次失败原因
+	HeaderRetryNotBefore    = "x-retry-not-before"   // 最早可重新处理的时间（Unix毫秒）
+	HeaderOriginalTopic     = "x-original-topic"     // 消息最初所在的topic
+	HeaderOriginalPartition = "x-original-partition" // 消息最初所在的分区
+	HeaderOriginalOffset    = "x-original-offset"    // 消息最初的offset
+)
+
+// RetryTier 一级重试：失败消息写入 Topic，延迟 Delay 后重新处理
+type RetryTier struct {
+	Topic string
+	Delay time.Duration
+}
+
+// RetryPolicy 重试与死信策略
+type RetryPolicy struct {
+	Tiers    []RetryTier // 按顺序尝试的重试topic
+	DLQTopic string      // 所有重试失败后写入的死信topic
+
+	// IsRetryable 判断错误是否可重试，不可重试的错误直接进入死信topic；nil表示所有错误都可重试
+	IsRetryable func(err error) bool
+}
+
+// NewRetryPolicy 按 topic 命名约定构造重试策略
+// 例如 NewRetryPolicy("orders", time.Minute, 10*time.Minute) 生成
+// orders.retry.1m -> orders.retry.10m -> orders.dlq
+func NewRetryPolicy(topic string, delays ...time.Duration) RetryPolicy {
+	tiers := make([]RetryTier, 0, len(delays))
+	for _, d := range delays {
+		tiers = append(tiers, RetryTier{
+			Topic: fmt.Sprintf("%s.retry.%s", topic, formatDelay(d)),
+			Delay: d,
+		})
+	}
+	return RetryPolicy{
+		Tiers:    tiers,
+		DLQTopic: topic + ".dlq",
+	}
+}
+
+// retryTopics 返回策略涉及的所有重试topic（不含死信topic）
+func (p RetryPolicy) retryTopics() []string {
+	topics := make([]string, 0, len(p.Tiers))
+	for _, t := range p.Tiers {
+		topics = append(topics, t.Topic)
+	}
+	return topics
+}
+
+// next 根据已失败次数与错误返回下一个目标topic及延迟
+func (p RetryPolicy) next(attempt int, err error) (string, time.Duration) {
+	if p.IsRetryable != nil && !p.IsRetryable(err) {
+		return p.DLQTopic, 0
+	}
+	if attempt < len(p.Tiers) {
+		return p.Tiers[attempt].Topic, p.Tiers[attempt].Delay
+	}
+	return p.DLQTopic, 0
+}
+
+// ConsumeWithRetry 以消费组方式消费 topic 及其所有重试topic
+// handler 失败的消息按 policy 依次转发到重试topic，重试topic中的消息在到期前不会被处理，
+// 全部重试失败后进入死信topic；失败原因与次数写入消息Headers
+func (k *KafkaClient) ConsumeWithRetry(ctx context.Context, group, topic string, handler MessageHandler, policy RetryPolicy, opts ...ConsumeOptions) error {
+	if topic == "" {
+		return fmt.Errorf("topic name cannot be empty")
+	}
+	if policy.DLQTopic == "" {
+		return fmt.Errorf("dlq topic cannot be empty")
+	}
+	if handler == nil {
+		return fmt.Errorf("message handler cannot be nil")
+	}
+
+	// 提前创建重试与死信topic，避免订阅不存在的topic
+	if k.admin != nil {
+		for _, t := range append(policy.retryTopics(), policy.DLQTopic) {
+			if err := k.ensureTopicExists(t); err != nil {
+				k.logger.Printf("Warning: could not ensure topic exists: %v", err)
+			}
+		}
+	}
+
+	router := &retryRouter{
+		producer: k,
+		handler:  handler,
+		policy:   policy,
+	}
+	topics := append([]string{topic}, policy.retryTopics()...)
+	return k.ConsumeGroup(ctx, group, topics, router.handle, opts...)
+}
+
+// retryRouter 包装业务handler，负责延迟等待与失败转发
+type retryRouter struct {
+	producer Producer
+	handler  MessageHandler
+	policy   RetryPolicy
+	now      func() time.Time // 测试时替换
+}
+
+func (r *retryRouter) handle(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	headers := headersToMap(msg.Headers)
+
+	// 重试topic中的消息需等到期后再处理；同一重试topic延迟相同，消息按到期时间有序
+	if v, ok := headers[HeaderRetryNotBefore]; ok {
+		if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+			if wait := time.UnixMilli(ms).Sub(r.clock()); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					// rebalance或关闭：不处理也不转发，由 ConsumeClaim 视为正常停止，消息由新的分区owner重新消费
+					timer.Stop()
+					return ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+	}
+
+	err := r.handler(ctx, msg)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		// 消费被取消时不转发，消息会在下次消费时重新处理
+		return ctx.Err()
+	}
+
+	attempt, _ := strconv.Atoi(headers[HeaderRetryAttempt])
+	target, delay := r.policy.next(attempt, err)
+
+	headers[HeaderRetryAttempt] = strconv.Itoa(attempt + 1)
+	headers[HeaderRetryReason] = err.Error()
+	if delay > 0 {
+		headers[HeaderRetryNotBefore] = strconv.FormatInt(r.clock().Add(delay).UnixMilli(), 10)
+	} else {
+		delete(headers, HeaderRetryNotBefore)
+	}
+	if _, ok := headers[HeaderOriginalTopic]; !ok {
+		headers[HeaderOriginalTopic] = msg.Topic
+		headers[HeaderOriginalPartition] = strconv.FormatInt(int64(msg.Partition), 10)
+		headers[HeaderOriginalOffset] = strconv.FormatInt(msg.Offset, 10)
+	}
+
+	opt := ProduceOptions{
+		Key:     string(msg.Key),
+		Headers: headers,
+	}
+	if perr := r.producer.ProduceMessage(target, msg.Value, opt); perr != nil {
+		return fmt.Errorf("forward message to %s: %w (handler error: %v)", target, perr, err)
+	}
+	return nil
+}
+
+func (r *retryRouter) clock() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+// formatDelay 将延迟格式化为topic后缀，如 30s、1m、10m、1h
+func formatDelay(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d >= time.Minute && d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d >= time.Second && d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	default:
+		return fmt.Sprintf("%dms", d/time.Millisecond)
+	}
+}
@@ -0,0 +1,196 @@
+package kafkatools
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// recordingProducer 记录转发的消息
+type recordingProducer struct {
+	topics  []string
+	headers []map[string]string
+}
+
+func (p *recordingProducer) ProduceMessage(topic string, message []byte, opts ...ProduceOptions) error {
+	p.topics = append(p.topics, topic)
+	if len(opts) > 0 {
+		p.headers = append(p.headers, opts[0].Headers)
+	} else {
+		p.headers = append(p.headers, nil)
+	}
+	return nil
+}
+
+func (p *recordingProducer) ProduceMessages(topic string, messages [][]byte, opts ...ProduceOptions) error {
+	for _, m := range messages {
+		if err := p.ProduceMessage(topic, m, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	p := NewRetryPolicy("orders", time.Minute, 10*time.Minute, 90*time.Second)
+	want := []string{"orders.retry.1m", "orders.retry.10m", "orders.retry.90s"}
+	for i, tier := range p.Tiers {
+		if tier.Topic != want[i] {
+			t.Errorf("tier %d topic = %s, want %s", i, tier.Topic, want[i])
+		}
+	}
+	if p.DLQTopic != "orders.dlq" {
+		t.Errorf("unexpected dlq topic: %s", p.DLQTopic)
+	}
+}
+
+func TestRetryRouter_Chain(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	producer := &recordingProducer{}
+	router := &retryRouter{
+		producer: producer,
+		handler: func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			return errors.New("db timeout")
+		},
+		policy: NewRetryPolicy("orders", time.Minute, 10*time.Minute),
+		now:    func() time.Time { return now },
+	}
+
+	msg := &sarama.ConsumerMessage{Topic: "orders", Partition: 2, Offset: 7, Value: []byte("v")}
+	var firstNotBefore string
+	for i := 0; i < 3; i++ {
+		if err := router.handle(context.Background(), msg); err != nil {
+			t.Fatalf("handle attempt %d: %v", i, err)
+		}
+		if i == 0 {
+			firstNotBefore = producer.headers[0][HeaderRetryNotBefore]
+		}
+		// 下一次从转发出去的topic消费，到期时间设为当前时间
+		headers := producer.headers[i]
+		headers[HeaderRetryNotBefore] = strconv.FormatInt(now.UnixMilli(), 10)
+		msg = &sarama.ConsumerMessage{Topic: producer.topics[i], Value: []byte("v")}
+		for k, v := range headers {
+			msg.Headers = append(msg.Headers, &sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+		}
+	}
+
+	wantTopics := []string{"orders.retry.1m", "orders.retry.10m", "orders.dlq"}
+	for i, topic := range wantTopics {
+		if producer.topics[i] != topic {
+			t.Errorf("forward %d topic = %s, want %s", i, producer.topics[i], topic)
+		}
+	}
+
+	last := producer.headers[2]
+	if last[HeaderRetryAttempt] != "3" {
+		t.Errorf("unexpected attempt header: %s", last[HeaderRetryAttempt])
+	}
+	if last[HeaderRetryReason] != "db timeout" {
+		t.Errorf("unexpected reason header: %s", last[HeaderRetryReason])
+	}
+	if last[HeaderOriginalTopic] != "orders" || last[HeaderOriginalPartition] != "2" || last[HeaderOriginalOffset] != "7" {
+		t.Errorf("original position headers not preserved: %v", last)
+	}
+	if want := strconv.FormatInt(now.Add(time.Minute).UnixMilli(), 10); firstNotBefore != want {
+		t.Errorf("first retry not-before = %s, want %s", firstNotBefore, want)
+	}
+}
+
+func TestRetryRouter_NonRetryable(t *testing.T) {
+	errBadPayload := errors.New("bad payload")
+	producer := &recordingProducer{}
+	policy := NewRetryPolicy("orders", time.Minute)
+	policy.IsRetryable = func(err error) bool { return !errors.Is(err, errBadPayload) }
+
+	router := &retryRouter{
+		producer: producer,
+		handler: func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			return errBadPayload
+		},
+		policy: policy,
+	}
+	if err := router.handle(context.Background(), &sarama.ConsumerMessage{Topic: "orders"}); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if len(producer.topics) != 1 || producer.topics[0] != "orders.dlq" {
+		t.Errorf("expected message in dlq, got %v", producer.topics)
+	}
+}
+
+func TestRetryRouter_WaitCancelled(t *testing.T) {
+	router := &retryRouter{
+		producer: &recordingProducer{},
+		handler: func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+			t.Error("handler should not run before the retry is due")
+			return nil
+		},
+		policy: NewRetryPolicy("orders", time.Minute),
+	}
+	msg := &sarama.ConsumerMessage{
+		Topic: "orders.retry.1m",
+		Headers: []*sarama.RecordHeader{{
+			Key:   []byte(HeaderRetryNotBefore),
+			Value: []byte(strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10)),
+		}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := router.handle(ctx, msg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the session error so the message is not marked, got %v", err)
+	}
+	if p := router.producer.(*recordingProducer); len(p.topics) != 0 {
+		t.Errorf("expected no forwarding on session cancel, got %v", p.topics)
+	}
+}
+
+// fakeSession 只实现 Context 与 MarkMessage
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	marked []int64
+}
+
+func (s *fakeSession) Context() context.Context { return s.ctx }
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	msgs chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.msgs }
+
+func TestGroupHandler_SessionCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sess := &fakeSession{ctx: ctx}
+	claim := &fakeClaim{msgs: make(chan *sarama.ConsumerMessage, 1)}
+	claim.msgs <- &sarama.ConsumerMessage{Topic: "orders", Offset: 7}
+
+	state := &handlerState{cancel: func() {}}
+	router := &retryRouter{producer: &recordingProducer{}, policy: NewRetryPolicy("orders", time.Minute)}
+	router.handler = func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		cancel() // rebalance发生在处理过程中
+		return errors.New("interrupted")
+	}
+	h := &groupHandler{handlerState: state, handler: router.handle}
+
+	if err := h.ConsumeClaim(sess, claim); err != nil {
+		t.Fatalf("expected clean stop on rebalance, got %v", err)
+	}
+	if state.Err() != nil {
+		t.Errorf("rebalance must not fail the consumer: %v", state.Err())
+	}
+	if len(sess.marked) != 0 {
+		t.Errorf("expected message left uncommitted, marked %v", sess.marked)
+	}
+	if p := router.producer.(*recordingProducer); len(p.topics) != 0 {
+		t.Errorf("expected no forwarding, got %v", p.topics)
+	}
+}
@@ -0,0 +1,71 @@
+package kafkatools
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"testing"
+)
+
+// TestSCRAMClient_RFC5802 使用 RFC 5802 中的示例验证完整认证流程
+func TestSCRAMClient_RFC5802(t *testing.T) {
+	c := &scramClient{
+		hashFn: sha1.New,
+		nonce:  func() (string, error) { return "fyko+d2lbbFgONRv9qkxdawL", nil },
+	}
+	if err := c.Begin("user", "pencil", ""); err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+
+	first, err := c.Step("")
+	if err != nil {
+		t.Fatalf("client first: %v", err)
+	}
+	if first != "n,,n=user,r=fyko+d2lbbFgONRv9qkxdawL" {
+		t.Errorf("unexpected client first message %q", first)
+	}
+
+	final, err := c.Step("r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096")
+	if err != nil {
+		t.Fatalf("client final: %v", err)
+	}
+	want := "c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts="
+	if final != want {
+		t.Errorf("unexpected client final message\n got %q\nwant %q", final, want)
+	}
+
+	if _, err := c.Step("v=rmF9pqV8S7suAoZWja4dJRkFsKQ="); err != nil {
+		t.Errorf("verify server final: %v", err)
+	}
+	if !c.Done() {
+		t.Error("expected scram conversation done")
+	}
+}
+
+func TestSCRAMClient_RejectsBadServer(t *testing.T) {
+	c := &scramClient{
+		hashFn: sha256.New,
+		nonce:  func() (string, error) { return "abc", nil },
+	}
+	_ = c.Begin("user", "pencil", "")
+	_, _ = c.Step("")
+	if _, err := c.Step("r=xyz,s=W22ZaeJ0SQhKSrRkfpHMJw==,i=4096"); err == nil {
+		t.Error("expected error for nonce not prefixed by client nonce")
+	}
+
+	c = &scramClient{
+		hashFn: sha1.New,
+		nonce:  func() (string, error) { return "fyko+d2lbbFgONRv9qkxdawL", nil },
+	}
+	_ = c.Begin("user", "pencil", "")
+	_, _ = c.Step("")
+	_, _ = c.Step("r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096")
+	if _, err := c.Step("v=AAAA"); err == nil {
+		t.Error("expected error for wrong server signature")
+	}
+}
+
+func TestEscapeSCRAMName(t *testing.T) {
+	if got := escapeSCRAMName("a=b,c"); got != "a=3Db=2Cc" {
+		t.Errorf("unexpected escaped name %q", got)
+	}
+}
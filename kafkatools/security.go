@@ -0,0 +1,137 @@
+package kafkatools
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/IBM/sarama"
+)
+
+// -------- TLS 与 SASL 配置 --------
+
+// 支持的SASL机制
+const (
+	SASLMechanismPlain       = "PLAIN"
+	SASLMechanismSCRAMSHA256 = "SCRAM-SHA-256"
+	SASLMechanismSCRAMSHA512 = "SCRAM-SHA-512"
+	SASLMechanismOAuthBearer = "OAUTHBEARER"
+)
+
+// WithTokenProvider 设置 OAUTHBEARER 认证的token提供者，SASLMechanism 为 OAUTHBEARER 时必须设置
+func WithTokenProvider(p sarama.AccessTokenProvider) Option {
+	return func(k *KafkaClient) {
+		k.tokenProvider = p
+	}
+}
+
+// applySASL 按配置设置SASL认证，未知的机制名返回错误
+func (k *KafkaClient) applySASL(config *sarama.Config) error {
+	if !k.config.SASLEnabled {
+		return nil
+	}
+
+	config.Net.SASL.Enable = true
+	config.Net.SASL.User = k.config.Username
+	config.Net.SASL.Password = k.config.Password
+
+	mechanism := strings.ToUpper(strings.TrimSpace(k.config.SASLMechanism))
+	switch mechanism {
+	case "", SASLMechanismPlain:
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case SASLMechanismSCRAMSHA256:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		config.Net.SASL.SCRAMClientGeneratorFunc = scramSHA256Generator
+	case SASLMechanismSCRAMSHA512:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		config.Net.SASL.SCRAMClientGeneratorFunc = scramSHA512Generator
+	case SASLMechanismOAuthBearer:
+		if k.tokenProvider == nil {
+			return fmt.Errorf("sasl mechanism %s requires a token provider, use WithTokenProvider", mechanism)
+		}
+		config.Net.SASL.Mechanism = sarama.SASLTypeOAuth
+		config.Net.SASL.TokenProvider = k.tokenProvider
+	default:
+		return fmt.Errorf("unsupported sasl mechanism %q, expected one of %s, %s, %s, %s",
+			k.config.SASLMechanism, SASLMechanismPlain, SASLMechanismSCRAMSHA256, SASLMechanismSCRAMSHA512, SASLMechanismOAuthBearer)
+	}
+
+	if mechanism != SASLMechanismOAuthBearer && k.config.Username == "" {
+		return fmt.Errorf("sasl mechanism %s requires a username", config.Net.SASL.Mechanism)
+	}
+	return nil
+}
+
+// applyTLS 按配置设置TLS，证书可以来自文件或PEM内容
+func (k *KafkaClient) applyTLS(config *sarama.Config) error {
+	if !k.config.TLSEnabled {
+		return nil
+	}
+
+	tlsConfig, err := buildTLSConfig(k.config)
+	if err != nil {
+		return err
+	}
+	config.Net.TLS.Enable = true
+	config.Net.TLS.Config = tlsConfig
+	return nil
+}
+
+// buildTLSConfig 根据 KafkaConfig 中的TLS选项构建 tls.Config
+func buildTLSConfig(kc KafkaConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         kc.TLSServerName,
+		InsecureSkipVerify: kc.TLSInsecureSkipVerify, // 仅用于测试环境
+	}
+
+	caPEM, err := readPEM("ca", kc.TLSCAFile, kc.TLSCAPEM)
+	if err != nil {
+		return nil, err
+	}
+	if len(caPEM) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("tls ca: no valid certificates found")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certPEM, err := readPEM("cert", kc.TLSCertFile, kc.TLSCertPEM)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := readPEM("key", kc.TLSKeyFile, kc.TLSKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if len(certPEM) > 0 || len(keyPEM) > 0 {
+		if len(certPEM) == 0 || len(keyPEM) == 0 {
+			return nil, fmt.Errorf("tls client certificate and key must be provided together")
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("load tls client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// readPEM 读取PEM内容，文件与内容不能同时设置
+func readPEM(name, file, content string) ([]byte, error) {
+	if file != "" && content != "" {
+		return nil, fmt.Errorf("tls %s: file and pem cannot both be set", name)
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read tls %s file: %w", name, err)
+		}
+		return data, nil
+	}
+	return []byte(content), nil
+}
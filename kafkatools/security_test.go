@@ -0,0 +1,130 @@
+package kafkatools
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// selfSignedPEM 生成测试用的自签名证书与私钥
+func selfSignedPEM(t *testing.T) (certPEM, keyPEM string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafkatools-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	certPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certPEM, keyPEM
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	certPEM, keyPEM := selfSignedPEM(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte(certPEM), 0o600); err != nil {
+		t.Fatalf("write ca file: %v", err)
+	}
+
+	cfg, err := buildTLSConfig(KafkaConfig{
+		TLSCAFile:     caFile,
+		TLSCertPEM:    certPEM,
+		TLSKeyPEM:     keyPEM,
+		TLSServerName: "kafka.internal",
+	})
+	if err != nil {
+		t.Fatalf("build tls config: %v", err)
+	}
+	if cfg.RootCAs == nil || len(cfg.Certificates) != 1 || cfg.ServerName != "kafka.internal" {
+		t.Errorf("unexpected tls config %+v", cfg)
+	}
+
+	if _, err := buildTLSConfig(KafkaConfig{TLSCertPEM: certPEM}); err == nil {
+		t.Error("expected error for certificate without key")
+	}
+	if _, err := buildTLSConfig(KafkaConfig{TLSCAFile: caFile, TLSCAPEM: certPEM}); err == nil {
+		t.Error("expected error when both ca file and pem are set")
+	}
+	if _, err := buildTLSConfig(KafkaConfig{TLSCAPEM: "not a pem"}); err == nil {
+		t.Error("expected error for invalid ca pem")
+	}
+}
+
+type staticTokenProvider struct{}
+
+func (staticTokenProvider) Token() (*sarama.AccessToken, error) {
+	return &sarama.AccessToken{Token: "token"}, nil
+}
+
+func TestApplySASL(t *testing.T) {
+	cases := []struct {
+		name      string
+		config    KafkaConfig
+		opts      []Option
+		mechanism sarama.SASLMechanism
+		scram     bool
+		wantErr   bool
+	}{
+		{name: "default plain", config: KafkaConfig{SASLEnabled: true, Username: "u", Password: "p"}, mechanism: sarama.SASLTypePlaintext},
+		{name: "scram 256", config: KafkaConfig{SASLEnabled: true, Username: "u", Password: "p", SASLMechanism: "SCRAM-SHA-256"}, mechanism: sarama.SASLTypeSCRAMSHA256, scram: true},
+		{name: "scram 512 lower case", config: KafkaConfig{SASLEnabled: true, Username: "u", Password: "p", SASLMechanism: "scram-sha-512"}, mechanism: sarama.SASLTypeSCRAMSHA512, scram: true},
+		{name: "oauth", config: KafkaConfig{SASLEnabled: true, SASLMechanism: "OAUTHBEARER"}, opts: []Option{WithTokenProvider(staticTokenProvider{})}, mechanism: sarama.SASLTypeOAuth},
+		{name: "oauth without provider", config: KafkaConfig{SASLEnabled: true, SASLMechanism: "OAUTHBEARER"}, wantErr: true},
+		{name: "unknown mechanism", config: KafkaConfig{SASLEnabled: true, Username: "u", SASLMechanism: "GSSAPI-X"}, wantErr: true},
+		{name: "missing username", config: KafkaConfig{SASLEnabled: true, SASLMechanism: "PLAIN"}, wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			k := &KafkaClient{config: c.config}
+			for _, opt := range c.opts {
+				opt(k)
+			}
+			config := sarama.NewConfig()
+			err := k.applySASL(config)
+			if c.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("apply sasl: %v", err)
+			}
+			if config.Net.SASL.Mechanism != c.mechanism {
+				t.Errorf("mechanism = %s, want %s", config.Net.SASL.Mechanism, c.mechanism)
+			}
+			if c.scram && config.Net.SASL.SCRAMClientGeneratorFunc == nil {
+				t.Error("scram client generator not set")
+			}
+			if err := config.Validate(); err != nil {
+				t.Errorf("sarama rejected config: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package kafkatools
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"fmt"
+
+	"github.com/IBM/sarama"
+
+	"github.com/OnlyPiglet/fly/bytestools/bkv"
+)
+
+// -------- 类型化序列化 --------
+
+// 序列化相关的消息Headers
+const (
+	HeaderContentType   = "content-type"     // 消息体格式
+	HeaderSchemaVersion = "x-schema-version" // 消息体schema版本
+)
+
+// 内置的消息体格式
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeBinary   = "application/octet-stream"
+	ContentTypeBKV      = "application/x-bkv"
+)
+
+// Serde 消息体的序列化与反序列化，ContentType 与 SchemaVersion 会写入消息Headers
+type Serde[T any] interface {
+	Serialize(v T) ([]byte, error)
+	Deserialize(data []byte) (T, error)
+	ContentType() string
+	SchemaVersion() string
+}
+
+// JSONSerde JSON格式
+type JSONSerde[T any] struct {
+	Version string // schema版本，可为空
+}
+
+func (s JSONSerde[T]) Serialize(v T) ([]byte, error) { return json.Marshal(v) }
+
+func (s JSONSerde[T]) Deserialize(data []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+func (s JSONSerde[T]) ContentType() string { return ContentTypeJSON }
+
+func (s JSONSerde[T]) SchemaVersion() string { return s.Version }
+
+// ProtoMessage protobuf消息需要实现的方法（gogo/vtproto 生成代码均提供）
+type ProtoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+// ProtoSerde protobuf wire格式，T 为消息结构体，*T 需实现 ProtoMessage
+// 示例：ProtoSerde[pb.Order, *pb.Order]{Version: "v2"}
+type ProtoSerde[T any, PT interface {
+	*T
+	ProtoMessage
+}] struct {
+	Version string
+}
+
+func (s ProtoSerde[T, PT]) Serialize(v PT) ([]byte, error) {
+	if v == nil {
+		return nil, fmt.Errorf("cannot serialize nil message")
+	}
+	return v.Marshal()
+}
+
+func (s ProtoSerde[T, PT]) Deserialize(data []byte) (PT, error) {
+	v := PT(new(T))
+	if err := v.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (s ProtoSerde[T, PT]) ContentType() string { return ContentTypeProtobuf }
+
+func (s ProtoSerde[T, PT]) SchemaVersion() string { return s.Version }
+
+// BinarySerde 自定义二进制格式，*T 需实现 encoding.BinaryMarshaler 与 encoding.BinaryUnmarshaler
+type BinarySerde[T any, PT interface {
+	*T
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}] struct {
+	Version string
+}
+
+func (s BinarySerde[T, PT]) Serialize(v PT) ([]byte, error) {
+	if v == nil {
+		return nil, fmt.Errorf("cannot serialize nil message")
+	}
+	return v.MarshalBinary()
+}
+
+func (s BinarySerde[T, PT]) Deserialize(data []byte) (PT, error) {
+	v := PT(new(T))
+	if err := v.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (s BinarySerde[T, PT]) ContentType() string { return ContentTypeBinary }
+
+func (s BinarySerde[T, PT]) SchemaVersion() string { return s.Version }
+
+// BKVSerde bytestools/bkv 格式
+type BKVSerde struct {
+	Version string
+}
+
+func (s BKVSerde) Serialize(v *bkv.BKV) ([]byte, error) {
+	if v == nil {
+		return nil, fmt.Errorf("cannot serialize nil bkv")
+	}
+	return v.Pack()
+}
+
+func (s BKVSerde) Deserialize(data []byte) (*bkv.BKV, error) {
+	v, rest, err := bkv.Unpack(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected %d trailing bytes", len(rest))
+	}
+	return v, nil
+}
+
+func (s BKVSerde) ContentType() string { return ContentTypeBKV }
+
+func (s BKVSerde) SchemaVersion() string { return s.Version }
+
+// serdeHeaders 在 headers 基础上追加 serde 的格式与版本
+func serdeHeaders[T any](headers map[string]string, serde Serde[T]) map[string]string {
+	result := make(map[string]string, len(headers)+2)
+	for k, v := range headers {
+		result[k] = v
+	}
+	result[HeaderContentType] = serde.ContentType()
+	if v := serde.SchemaVersion(); v != "" {
+		result[HeaderSchemaVersion] = v
+	}
+	return result
+}
+
+// ProduceTyped 使用 serde 序列化并批量发送消息，消息Headers中写入格式与schema版本
+func ProduceTyped[T any](p Producer, topic string, messages []T, serde Serde[T], opts ...ProduceOptions) error {
+	if serde == nil {
+		return fmt.Errorf("serde cannot be nil")
+	}
+	var opt ProduceOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	opt.Headers = serdeHeaders(opt.Headers, serde)
+	return ProduceBatch(p, topic, messages, serde.Serialize, opt)
+}
+
+// DecodeMessage 根据消息Headers中的格式与版本选择 serde 反序列化消息体
+// 优先匹配格式与版本均一致的 serde，其次只匹配格式；消息没有格式Header时使用第一个 serde
+func DecodeMessage[T any](msg *sarama.ConsumerMessage, serdes ...Serde[T]) (T, error) {
+	var zero T
+	serde, err := selectSerde(headersToMap(msg.Headers), serdes)
+	if err != nil {
+		return zero, err
+	}
+	v, err := serde.Deserialize(msg.Value)
+	if err != nil {
+		return zero, fmt.Errorf("deserialize %s message: %w", serde.ContentType(), err)
+	}
+	return v, nil
+}
+
+func selectSerde[T any](headers map[string]string, serdes []Serde[T]) (Serde[T], error) {
+	if len(serdes) == 0 {
+		return nil, fmt.Errorf("no serde provided")
+	}
+	contentType, ok := headers[HeaderContentType]
+	if !ok {
+		return serdes[0], nil
+	}
+	version := headers[HeaderSchemaVersion]
+
+	var candidate Serde[T]
+	for _, s := range serdes {
+		if s.ContentType() != contentType {
+			continue
+		}
+		if s.SchemaVersion() == version {
+			return s, nil
+		}
+		if candidate == nil {
+			candidate = s
+		}
+	}
+	if candidate == nil {
+		return nil, fmt.Errorf("no serde for content type %q", contentType)
+	}
+	return candidate, nil
+}
+
+// TypedHandler 类型化消息处理函数，msg 为原始消息，可用于读取Headers、offset等
+type TypedHandler[T any] func(ctx context.Context, value T, msg *sarama.ConsumerMessage) error
+
+// ConsumeTyped 以消费组方式消费并按消息Headers选择 serde 反序列化，语义同 ConsumeGroup
+// 反序列化失败与 handler 失败一样会终止消费并返回错误
+func ConsumeTyped[T any](ctx context.Context, c Consumer, group string, topics []string, serdes []Serde[T], handler TypedHandler[T], opts ...ConsumeOptions) error {
+	if len(serdes) == 0 {
+		return fmt.Errorf("no serde provided")
+	}
+	if handler == nil {
+		return fmt.Errorf("message handler cannot be nil")
+	}
+	return c.ConsumeGroup(ctx, group, topics, func(ctx context.Context, msg *sarama.ConsumerMessage) error {
+		v, err := DecodeMessage(msg, serdes...)
+		if err != nil {
+			return err
+		}
+		return handler(ctx, v, msg)
+	}, opts...)
+}
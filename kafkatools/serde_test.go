@@ -0,0 +1,146 @@
+package kafkatools
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+
+	"github.com/OnlyPiglet/fly/bytestools/bkv"
+)
+
+// testPoint 自定义二进制格式的测试消息
+type testPoint struct {
+	X, Y uint32
+}
+
+func (p *testPoint) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint32(buf, p.X)
+	binary.BigEndian.PutUint32(buf[4:], p.Y)
+	return buf, nil
+}
+
+func (p *testPoint) UnmarshalBinary(data []byte) error {
+	if len(data) != 8 {
+		return errors.New("invalid point length")
+	}
+	p.X = binary.BigEndian.Uint32(data)
+	p.Y = binary.BigEndian.Uint32(data[4:])
+	return nil
+}
+
+// testProto 模拟生成的protobuf消息
+type testProto struct {
+	payload []byte
+}
+
+func (p *testProto) Marshal() ([]byte, error) { return append([]byte{0x0a}, p.payload...), nil }
+
+func (p *testProto) Unmarshal(data []byte) error {
+	if len(data) == 0 || data[0] != 0x0a {
+		return errors.New("invalid wire data")
+	}
+	p.payload = append([]byte(nil), data[1:]...)
+	return nil
+}
+
+func messageWithHeaders(value []byte, headers map[string]string) *sarama.ConsumerMessage {
+	msg := &sarama.ConsumerMessage{Value: value}
+	for k, v := range headers {
+		msg.Headers = append(msg.Headers, &sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return msg
+}
+
+func TestJSONSerde_RoundTrip(t *testing.T) {
+	serde := JSONSerde[TestUser]{Version: "v1"}
+	user := TestUser{ID: 1, Username: "alice", Email: "alice@example.com", Age: 30}
+
+	data, err := serde.Serialize(user)
+	if err != nil {
+		t.Fatalf("serialize: %v", err)
+	}
+	headers := serdeHeaders(map[string]string{"source": "test"}, Serde[TestUser](serde))
+	if headers[HeaderContentType] != ContentTypeJSON || headers[HeaderSchemaVersion] != "v1" || headers["source"] != "test" {
+		t.Errorf("unexpected headers: %v", headers)
+	}
+
+	got, err := DecodeMessage[TestUser](messageWithHeaders(data, headers), serde)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got != user {
+		t.Errorf("got %+v, want %+v", got, user)
+	}
+}
+
+func TestBinaryAndProtoSerde_RoundTrip(t *testing.T) {
+	bs := BinarySerde[testPoint, *testPoint]{}
+	data, err := bs.Serialize(&testPoint{X: 3, Y: 4})
+	if err != nil {
+		t.Fatalf("serialize point: %v", err)
+	}
+	p, err := bs.Deserialize(data)
+	if err != nil || p.X != 3 || p.Y != 4 {
+		t.Errorf("unexpected point %+v, err %v", p, err)
+	}
+
+	ps := ProtoSerde[testProto, *testProto]{}
+	data, err = ps.Serialize(&testProto{payload: []byte("abc")})
+	if err != nil {
+		t.Fatalf("serialize proto: %v", err)
+	}
+	m, err := ps.Deserialize(data)
+	if err != nil || string(m.payload) != "abc" {
+		t.Errorf("unexpected proto %+v, err %v", m, err)
+	}
+}
+
+func TestBKVSerde_RoundTrip(t *testing.T) {
+	v := bkv.NewBKV()
+	v.AddByStringKey("name", []byte("fly"))
+	v.AddByUInt64Key(1, bkv.EncodeNumber(42))
+
+	serde := BKVSerde{}
+	data, err := serde.Serialize(v)
+	if err != nil {
+		t.Fatalf("serialize: %v", err)
+	}
+	got, err := serde.Deserialize(data)
+	if err != nil {
+		t.Fatalf("deserialize: %v", err)
+	}
+	if got.GetStringValueByStringKey("name", "") != "fly" || got.GetNumberValueByNumberKey(1, 0) != 42 {
+		t.Errorf("unexpected bkv content")
+	}
+}
+
+func TestDecodeMessage_SelectSerde(t *testing.T) {
+	v1 := JSONSerde[map[string]int]{Version: "v1"}
+	v2 := JSONSerde[map[string]int]{Version: "v2"}
+	serdes := []Serde[map[string]int]{v1, v2}
+
+	s, err := selectSerde(map[string]string{HeaderContentType: ContentTypeJSON, HeaderSchemaVersion: "v2"}, serdes)
+	if err != nil || s.SchemaVersion() != "v2" {
+		t.Errorf("expected v2 serde, got %v, err %v", s, err)
+	}
+	s, err = selectSerde(map[string]string{HeaderContentType: ContentTypeJSON, HeaderSchemaVersion: "v9"}, serdes)
+	if err != nil || s.SchemaVersion() != "v1" {
+		t.Errorf("expected fallback to first json serde, got %v, err %v", s, err)
+	}
+	s, err = selectSerde(map[string]string{}, serdes)
+	if err != nil || s.SchemaVersion() != "v1" {
+		t.Errorf("expected default serde, got %v, err %v", s, err)
+	}
+	if _, err := selectSerde(map[string]string{HeaderContentType: ContentTypeBKV}, serdes); err == nil {
+		t.Error("expected error for unknown content type")
+	}
+
+	msg := messageWithHeaders([]byte(`{"a":1}`), map[string]string{HeaderContentType: ContentTypeJSON})
+	got, err := DecodeMessage(msg, serdes...)
+	if err != nil || got["a"] != 1 {
+		t.Errorf("unexpected decode result %v, err %v", got, err)
+	}
+}
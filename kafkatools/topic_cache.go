@@ -0,0 +1,189 @@
+package kafkatools
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// -------- Topic 元数据缓存与自动创建 --------
+
+const (
+	defaultTopicCacheTTL         = 5 * time.Minute
+	defaultTopicNegativeCacheTTL = 10 * time.Second
+	defaultTopicRetention        = 7 * 24 * time.Hour
+)
+
+// TopicDefaults 自动创建topic时使用的参数，零值字段使用上一级默认值
+type TopicDefaults struct {
+	NumPartitions     int32             `json:"num_partitions,omitempty"`     // 分区数量，默认1
+	ReplicationFactor int16             `json:"replication_factor,omitempty"` // 副本因子，默认与broker数量一致
+	Retention         time.Duration     `json:"retention,omitempty"`          // 消息保留时间，默认7天
+	ConfigEntries     map[string]string `json:"config_entries,omitempty"`     // 其他Topic配置项
+}
+
+// AutoCreatePolicy 发送消息时topic不存在的处理策略
+type AutoCreatePolicy struct {
+	Disabled bool                     `json:"disabled,omitempty"` // 关闭自动创建，topic不存在时直接返回错误
+	Default  TopicDefaults            `json:"default,omitempty"`  // 所有topic的默认参数
+	Topics   map[string]TopicDefaults `json:"topics,omitempty"`   // 按topic名覆盖默认参数
+}
+
+// topicConfig 合并默认参数与按topic覆盖的参数，生成创建配置
+func (p AutoCreatePolicy) topicConfig(name string) TopicConfig {
+	d := p.Default
+	if o, ok := p.Topics[name]; ok {
+		if o.NumPartitions > 0 {
+			d.NumPartitions = o.NumPartitions
+		}
+		if o.ReplicationFactor > 0 {
+			d.ReplicationFactor = o.ReplicationFactor
+		}
+		if o.Retention > 0 {
+			d.Retention = o.Retention
+		}
+		if len(o.ConfigEntries) > 0 {
+			merged := make(map[string]string, len(d.ConfigEntries)+len(o.ConfigEntries))
+			for k, v := range d.ConfigEntries {
+				merged[k] = v
+			}
+			for k, v := range o.ConfigEntries {
+				merged[k] = v
+			}
+			d.ConfigEntries = merged
+		}
+	}
+
+	entries := map[string]string{
+		"cleanup.policy": "delete",
+	}
+	for k, v := range d.ConfigEntries {
+		entries[k] = v
+	}
+	retention := d.Retention
+	if retention <= 0 {
+		retention = defaultTopicRetention
+	}
+	if _, ok := entries["retention.ms"]; !ok {
+		entries["retention.ms"] = strconv.FormatInt(retention.Milliseconds(), 10)
+	}
+
+	partitions := d.NumPartitions
+	if partitions <= 0 {
+		partitions = 1
+	}
+	return TopicConfig{
+		Name:              name,
+		NumPartitions:     partitions,
+		ReplicationFactor: d.ReplicationFactor, // 0 时 CreateTopic 自动按broker数量设置
+		ConfigEntries:     entries,
+	}
+}
+
+// topicCache 并发安全的topic存在性缓存，不存在的topic使用较短的TTL缓存
+type topicCache struct {
+	mu          sync.RWMutex
+	entries     map[string]topicCacheEntry
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time // 测试时替换
+}
+
+type topicCacheEntry struct {
+	exists    bool
+	expiresAt time.Time
+}
+
+func newTopicCache(ttl, negativeTTL time.Duration) *topicCache {
+	if ttl <= 0 {
+		ttl = defaultTopicCacheTTL
+	}
+	if negativeTTL <= 0 {
+		negativeTTL = defaultTopicNegativeCacheTTL
+	}
+	return &topicCache{
+		entries:     make(map[string]topicCacheEntry),
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+	}
+}
+
+// get 返回缓存的存在性，ok 为false表示未缓存或已过期
+func (c *topicCache) get(name string) (exists bool, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, found := c.entries[name]
+	if !found || !c.now().Before(e.expiresAt) {
+		return false, false
+	}
+	return e.exists, true
+}
+
+func (c *topicCache) set(name string, exists bool) {
+	ttl := c.ttl
+	if !exists {
+		ttl = c.negativeTTL
+	}
+	c.mu.Lock()
+	c.entries[name] = topicCacheEntry{exists: exists, expiresAt: c.now().Add(ttl)}
+	c.mu.Unlock()
+}
+
+// setAll 用一次 ListTopics 的结果刷新所有已存在的topic
+func (c *topicCache) setAll(topics map[string]sarama.TopicDetail) {
+	expiresAt := c.now().Add(c.ttl)
+	c.mu.Lock()
+	for name := range topics {
+		c.entries[name] = topicCacheEntry{exists: true, expiresAt: expiresAt}
+	}
+	c.mu.Unlock()
+}
+
+func (c *topicCache) invalidate(name string) {
+	c.mu.Lock()
+	delete(c.entries, name)
+	c.mu.Unlock()
+}
+
+// ensureTopicExists 确保topic存在，不存在时按 AutoCreatePolicy 自动创建
+// 结果会被缓存，缓存命中时不访问broker
+func (k *KafkaClient) ensureTopicExists(topicName string) error {
+	if exists, ok := k.topicCache.get(topicName); ok {
+		if exists {
+			return nil
+		}
+		return fmt.Errorf("topic %s: %w", topicName, sarama.ErrUnknownTopicOrPartition)
+	}
+
+	topics, err := k.admin.ListTopics()
+	if err != nil {
+		return fmt.Errorf("check topic existence: %w", err)
+	}
+	k.topicCache.setAll(topics)
+	if _, exists := topics[topicName]; exists {
+		return nil
+	}
+
+	policy := k.config.AutoCreate
+	if policy.Disabled {
+		k.topicCache.set(topicName, false)
+		return fmt.Errorf("topic %s does not exist and auto creation is disabled: %w", topicName, sarama.ErrUnknownTopicOrPartition)
+	}
+
+	if err := k.CreateTopic(policy.topicConfig(topicName)); err != nil {
+		if errors.Is(err, sarama.ErrTopicAlreadyExists) {
+			// 其他客户端并发创建了同名topic
+			k.topicCache.set(topicName, true)
+			return nil
+		}
+		k.topicCache.set(topicName, false)
+		return fmt.Errorf("create topic: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package kafkatools
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// countingAdmin 只实现 ensureTopicExists 用到的方法，统计元数据请求次数
+type countingAdmin struct {
+	sarama.ClusterAdmin
+	topics    map[string]sarama.TopicDetail
+	listCalls int
+	listErr   error
+	created   map[string]*sarama.TopicDetail
+}
+
+func (a *countingAdmin) ListTopics() (map[string]sarama.TopicDetail, error) {
+	a.listCalls++
+	if a.listErr != nil {
+		return nil, a.listErr
+	}
+	return a.topics, nil
+}
+
+func (a *countingAdmin) DescribeCluster() ([]*sarama.Broker, int32, error) {
+	return []*sarama.Broker{sarama.NewBroker("b1:9092")}, 0, nil
+}
+
+func (a *countingAdmin) CreateTopic(topic string, detail *sarama.TopicDetail, validateOnly bool) error {
+	a.created[topic] = detail
+	a.topics[topic] = *detail
+	return nil
+}
+
+func newCachedClient(config KafkaConfig, admin sarama.ClusterAdmin) *KafkaClient {
+	return &KafkaClient{
+		config:     config,
+		admin:      admin,
+		topicCache: newTopicCache(config.TopicCacheTTL, config.TopicNegativeCacheTTL),
+		logger:     stdoutLogger{},
+	}
+}
+
+func TestTopicCache_TTL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newTopicCache(time.Minute, 5*time.Second)
+	c.now = func() time.Time { return now }
+
+	c.set("a", true)
+	c.set("b", false)
+	if exists, ok := c.get("a"); !ok || !exists {
+		t.Errorf("expected cached existing topic")
+	}
+	if exists, ok := c.get("b"); !ok || exists {
+		t.Errorf("expected cached missing topic")
+	}
+
+	now = now.Add(10 * time.Second)
+	if _, ok := c.get("b"); ok {
+		t.Errorf("negative entry should expire after its ttl")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Errorf("positive entry should still be cached")
+	}
+
+	c.invalidate("a")
+	if _, ok := c.get("a"); ok {
+		t.Errorf("invalidated entry should not be cached")
+	}
+}
+
+func TestEnsureTopicExists_UsesCache(t *testing.T) {
+	admin := &countingAdmin{
+		topics:  map[string]sarama.TopicDetail{"orders": {NumPartitions: 3}},
+		created: make(map[string]*sarama.TopicDetail),
+	}
+	k := newCachedClient(KafkaConfig{}, admin)
+
+	for i := 0; i < 10; i++ {
+		if err := k.ensureTopicExists("orders"); err != nil {
+			t.Fatalf("ensure topic: %v", err)
+		}
+	}
+	if admin.listCalls != 1 {
+		t.Errorf("expected 1 metadata request, got %d", admin.listCalls)
+	}
+
+	// 自动创建后同样命中缓存
+	for i := 0; i < 10; i++ {
+		if err := k.ensureTopicExists("payments"); err != nil {
+			t.Fatalf("ensure topic: %v", err)
+		}
+	}
+	if admin.listCalls != 2 || admin.created["payments"] == nil {
+		t.Errorf("expected payments created with one extra metadata request, got %d calls", admin.listCalls)
+	}
+}
+
+func TestEnsureTopicExists_Disabled(t *testing.T) {
+	admin := &countingAdmin{
+		topics:  map[string]sarama.TopicDetail{},
+		created: make(map[string]*sarama.TopicDetail),
+	}
+	k := newCachedClient(KafkaConfig{AutoCreate: AutoCreatePolicy{Disabled: true}}, admin)
+
+	for i := 0; i < 5; i++ {
+		if err := k.ensureTopicExists("missing"); err == nil {
+			t.Fatal("expected error for missing topic")
+		}
+	}
+	if admin.listCalls != 1 {
+		t.Errorf("missing topic should be negatively cached, got %d metadata requests", admin.listCalls)
+	}
+	if len(admin.created) != 0 {
+		t.Errorf("topic should not be created when auto creation is disabled")
+	}
+}
+
+// countingProducer 统计实际发送的消息数
+type countingProducer struct {
+	sarama.SyncProducer
+	sent int
+}
+
+func (p *countingProducer) SendMessage(*sarama.ProducerMessage) (int32, int64, error) {
+	p.sent++
+	return 0, 0, nil
+}
+
+func (p *countingProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	p.sent += len(msgs)
+	return nil
+}
+
+func TestProduceMessage_MissingTopicDisabled(t *testing.T) {
+	admin := &countingAdmin{
+		topics:  map[string]sarama.TopicDetail{"orders": {NumPartitions: 1}},
+		created: make(map[string]*sarama.TopicDetail),
+	}
+	producer := &countingProducer{}
+	k := newCachedClient(KafkaConfig{AutoCreate: AutoCreatePolicy{Disabled: true}}, admin)
+	k.producer = producer
+
+	if err := k.ProduceMessage("missing", []byte("x")); err == nil {
+		t.Error("expected error producing to a missing topic")
+	}
+	if err := k.ProduceMessages("missing", [][]byte{[]byte("x")}); err == nil {
+		t.Error("expected error batch producing to a missing topic")
+	}
+	if producer.sent != 0 || len(admin.created) != 0 {
+		t.Errorf("expected nothing sent or created, got %d sent", producer.sent)
+	}
+
+	if err := k.ProduceMessage("orders", []byte("x")); err != nil || producer.sent != 1 {
+		t.Errorf("expected existing topic to be produced to, got %v", err)
+	}
+	// 元数据查询失败不能确认topic不存在，继续发送
+	admin.listErr = errors.New("metadata timeout")
+	if err := k.ProduceMessage("payments", []byte("x")); err != nil || producer.sent != 2 {
+		t.Errorf("expected produce to continue on metadata errors, got %v", err)
+	}
+}
+
+func TestAutoCreatePolicy_TopicConfig(t *testing.T) {
+	p := AutoCreatePolicy{
+		Default: TopicDefaults{NumPartitions: 6, Retention: 24 * time.Hour},
+		Topics: map[string]TopicDefaults{
+			"audit": {Retention: 30 * 24 * time.Hour, ConfigEntries: map[string]string{"compression.type": "zstd"}},
+		},
+	}
+
+	c := p.topicConfig("events")
+	if c.NumPartitions != 6 || c.ConfigEntries["retention.ms"] != "86400000" || c.ConfigEntries["cleanup.policy"] != "delete" {
+		t.Errorf("unexpected default topic config %+v", c)
+	}
+
+	c = p.topicConfig("audit")
+	if c.NumPartitions != 6 || c.ConfigEntries["retention.ms"] != "2592000000" || c.ConfigEntries["compression.type"] != "zstd" {
+		t.Errorf("unexpected overridden topic config %+v", c)
+	}
+
+	c = AutoCreatePolicy{}.topicConfig("plain")
+	if c.NumPartitions != 1 || c.ConfigEntries["retention.ms"] != "604800000" {
+		t.Errorf("zero policy should keep 1 partition and 7 days retention, got %+v", c)
+	}
+}
@@ -0,0 +1,357 @@
+package redistools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// maxBloomBits redis bitmaps are limited to 512MB
+const maxBloomBits = 1 << 32
+
+// bloomRolloverScript open the next layer once, even if several writers fill the top layer at the same time
+var bloomRolloverScript = redis.NewScript(`
+local layers = tonumber(redis.call('HGET', KEYS[1], 'layers') or '1')
+if layers == tonumber(ARGV[1]) then
+	redis.call('HSET', KEYS[1], 'layers', layers + 1, 'count', 0)
+end
+return 0
+`)
+
+// BloomOption set the bloom filter options.
+type BloomOption func(*bloomOptions)
+
+type bloomOptions struct {
+	scalable   bool
+	growth     int
+	tightening float64
+}
+
+func defaultBloomOptions() *bloomOptions {
+	return &bloomOptions{
+		growth:     2,
+		tightening: 0.5,
+	}
+}
+
+// WithScalable add a new, larger layer whenever the current one holds its capacity,
+// so the false positive rate stays bounded as the number of items grows
+func WithScalable() BloomOption {
+	return func(o *bloomOptions) {
+		o.scalable = true
+	}
+}
+
+// WithBloomGrowth set the capacity ratio between consecutive layers, default 2
+func WithBloomGrowth(growth int) BloomOption {
+	return func(o *bloomOptions) {
+		o.growth = growth
+	}
+}
+
+// WithBloomTightening set the false positive rate ratio between consecutive layers, default 0.5
+func WithBloomTightening(ratio float64) BloomOption {
+	return func(o *bloomOptions) {
+		o.tightening = ratio
+	}
+}
+
+// bloomLayer one bitmap sized for capacity items
+type bloomLayer struct {
+	key      string
+	capacity uint64
+	bits     uint64 // m
+	hashes   int    // k
+}
+
+// BloomFilter bloom filter on redis bitmaps. Keys of a scalable filter share a hash tag,
+// so the filter works with single, sentinel and cluster clients.
+type BloomFilter struct {
+	client   redis.Cmdable
+	key      string
+	capacity uint64
+	fpRate   float64
+	opts     *bloomOptions
+}
+
+// NewBloomFilter create a bloom filter for capacity items with the given false positive rate
+func NewBloomFilter(client redis.Cmdable, key string, capacity uint64, fpRate float64, opts ...BloomOption) (*BloomFilter, error) {
+	o := defaultBloomOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	if key == "" {
+		return nil, errors.New("bloom filter: key cannot be empty")
+	}
+	if capacity == 0 {
+		return nil, fmt.Errorf("bloom filter %s: capacity must be positive", key)
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		return nil, fmt.Errorf("bloom filter %s: false positive rate must be in (0, 1), got %v", key, fpRate)
+	}
+	if o.scalable && (o.growth < 1 || o.tightening <= 0 || o.tightening >= 1) {
+		return nil, fmt.Errorf("bloom filter %s: invalid growth %d or tightening %v", key, o.growth, o.tightening)
+	}
+	if o.scalable {
+		if err := checkSlotKey(key); err != nil {
+			return nil, fmt.Errorf("bloom filter %s: %w", key, err)
+		}
+	}
+
+	f := &BloomFilter{client: client, key: key, capacity: capacity, fpRate: fpRate, opts: o}
+	if _, err := f.layer(0); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// layer return the parameters of layer n, a plain filter only has layer 0 stored at key
+func (f *BloomFilter) layer(n int) (bloomLayer, error) {
+	if !f.opts.scalable {
+		return newBloomLayer(f.key, f.capacity, f.fpRate)
+	}
+	capacity := float64(f.capacity) * math.Pow(float64(f.opts.growth), float64(n))
+	fpRate := f.fpRate * math.Pow(f.opts.tightening, float64(n))
+	if capacity >= maxBloomBits {
+		return bloomLayer{}, fmt.Errorf("bloom filter %s: layer %d is too large", f.key, n)
+	}
+	return newBloomLayer(sameSlotKey(f.key, strconv.Itoa(n)), uint64(capacity), fpRate)
+}
+
+func newBloomLayer(key string, capacity uint64, fpRate float64) (bloomLayer, error) {
+	bits := math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	if bits > maxBloomBits {
+		return bloomLayer{}, fmt.Errorf("bloom filter %s: %v bits exceed the redis bitmap limit", key, bits)
+	}
+	hashes := max(1, int(math.Round(bits/float64(capacity)*math.Ln2)))
+	return bloomLayer{key: key, capacity: capacity, bits: uint64(bits), hashes: hashes}, nil
+}
+
+// offsets return the k bit offsets of item, using double hashing on two FNV hashes
+func (l bloomLayer) offsets(item string) []int64 {
+	h1, h2 := fnv.New64a(), fnv.New64()
+	_, _ = h1.Write([]byte(item))
+	_, _ = h2.Write([]byte(item))
+	a, b := h1.Sum64(), h2.Sum64()|1
+	offsets := make([]int64, l.hashes)
+	for i := range offsets {
+		offsets[i] = int64((a + uint64(i)*b) % l.bits)
+	}
+	return offsets
+}
+
+func (f *BloomFilter) metaKey() string {
+	return sameSlotKey(f.key, "meta")
+}
+
+// layers return the number of layers, 1 for a plain filter
+func (f *BloomFilter) layers(ctx context.Context) (int, error) {
+	if !f.opts.scalable {
+		return 1, nil
+	}
+	n, err := f.client.HGet(ctx, f.metaKey(), "layers").Int()
+	if errors.Is(err, redis.Nil) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("bloom filter %s: %w", f.key, err)
+	}
+	return max(n, 1), nil
+}
+
+// Add add an item, returns false if it was probably present already
+func (f *BloomFilter) Add(ctx context.Context, item string) (bool, error) {
+	added, err := f.AddMany(ctx, item)
+	if err != nil {
+		return false, err
+	}
+	return added[0], nil
+}
+
+// AddMany add items in one pipeline, added[i] is false if items[i] was probably present already
+func (f *BloomFilter) AddMany(ctx context.Context, items ...string) ([]bool, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	if !f.opts.scalable {
+		return f.setBits(ctx, items, 0)
+	}
+
+	// a scalable filter only adds items missing from every layer, to the top layer
+	layers, err := f.layers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	present, err := f.exists(ctx, items, layers)
+	if err != nil {
+		return nil, err
+	}
+	added := make([]bool, len(items))
+	var missing []string
+	index := make(map[string]int)
+	for i, item := range items {
+		if present[i] {
+			continue
+		}
+		if _, dup := index[item]; dup {
+			continue
+		}
+		index[item] = i
+		missing = append(missing, item)
+	}
+	if len(missing) == 0 {
+		return added, nil
+	}
+
+	top := layers - 1
+	newly, err := f.setBits(ctx, missing, top)
+	if err != nil {
+		return nil, err
+	}
+	count := int64(0)
+	for n, item := range missing {
+		if newly[n] {
+			added[index[item]] = true
+			count++
+		}
+	}
+	if count == 0 {
+		return added, nil
+	}
+
+	layer, err := f.layer(top)
+	if err != nil {
+		return nil, err
+	}
+	total, err := f.client.HIncrBy(ctx, f.metaKey(), "count", count).Result()
+	if err != nil {
+		return nil, fmt.Errorf("bloom filter %s: %w", f.key, err)
+	}
+	if uint64(total) >= layer.capacity {
+		if _, err := f.layer(layers); err != nil {
+			return nil, err
+		}
+		if err := bloomRolloverScript.Run(ctx, f.client, []string{f.metaKey()}, layers).Err(); err != nil {
+			return nil, fmt.Errorf("bloom filter %s: %w", f.key, err)
+		}
+	}
+	return added, nil
+}
+
+// setBits set the bits of items in layer n, newly[i] is true if any bit of items[i] was unset
+func (f *BloomFilter) setBits(ctx context.Context, items []string, n int) ([]bool, error) {
+	layer, err := f.layer(n)
+	if err != nil {
+		return nil, err
+	}
+	pipe := f.client.Pipeline()
+	cmds := make([][]*redis.IntCmd, len(items))
+	for i, item := range items {
+		for _, offset := range layer.offsets(item) {
+			cmds[i] = append(cmds[i], pipe.SetBit(ctx, layer.key, offset, 1))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("bloom filter %s: %w", f.key, err)
+	}
+
+	newly := make([]bool, len(items))
+	for i := range items {
+		for _, cmd := range cmds[i] {
+			if cmd.Val() == 0 {
+				newly[i] = true
+			}
+		}
+	}
+	return newly, nil
+}
+
+// Exists report whether an item is probably present
+func (f *BloomFilter) Exists(ctx context.Context, item string) (bool, error) {
+	exists, err := f.ExistsMany(ctx, item)
+	if err != nil {
+		return false, err
+	}
+	return exists[0], nil
+}
+
+// ExistsMany check items in one pipeline, exists[i] is false if items[i] is definitely absent
+func (f *BloomFilter) ExistsMany(ctx context.Context, items ...string) ([]bool, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	layers, err := f.layers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return f.exists(ctx, items, layers)
+}
+
+func (f *BloomFilter) exists(ctx context.Context, items []string, layers int) ([]bool, error) {
+	pipe := f.client.Pipeline()
+	// cmds[layer][item] are the GETBIT commands of one item in one layer
+	cmds := make([][][]*redis.IntCmd, layers)
+	for n := range cmds {
+		layer, err := f.layer(n)
+		if err != nil {
+			return nil, err
+		}
+		cmds[n] = make([][]*redis.IntCmd, len(items))
+		for i, item := range items {
+			for _, offset := range layer.offsets(item) {
+				cmds[n][i] = append(cmds[n][i], pipe.GetBit(ctx, layer.key, offset))
+			}
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("bloom filter %s: %w", f.key, err)
+	}
+
+	exists := make([]bool, len(items))
+	for i := range items {
+		for n := range cmds {
+			if allBitsSet(cmds[n][i]) {
+				exists[i] = true
+				break
+			}
+		}
+	}
+	return exists, nil
+}
+
+func allBitsSet(cmds []*redis.IntCmd) bool {
+	for _, cmd := range cmds {
+		if cmd.Val() == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Delete remove the filter and all its layers
+func (f *BloomFilter) Delete(ctx context.Context) error {
+	keys := []string{f.key}
+	if f.opts.scalable {
+		layers, err := f.layers(ctx)
+		if err != nil {
+			return err
+		}
+		keys = []string{f.metaKey()}
+		for n := range layers {
+			layer, err := f.layer(n)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, layer.key)
+		}
+	}
+	if err := f.client.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("bloom filter %s: %w", f.key, err)
+	}
+	return nil
+}
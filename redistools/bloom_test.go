@@ -0,0 +1,120 @@
+package redistools
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestBloomLayer(t *testing.T) {
+	layer, err := newBloomLayer("k", 1000000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// m = -n ln p / (ln 2)^2, k = m/n ln 2
+	if layer.bits != 9585059 || layer.hashes != 7 {
+		t.Errorf("unexpected layer size m=%d k=%d", layer.bits, layer.hashes)
+	}
+	offsets := layer.offsets("user:42")
+	if len(offsets) != 7 {
+		t.Fatalf("expected 7 offsets, got %d", len(offsets))
+	}
+	for n, offset := range layer.offsets("user:42") {
+		if offset != offsets[n] || offset < 0 || uint64(offset) >= layer.bits {
+			t.Errorf("offset %d not stable or out of range: %d", n, offset)
+		}
+	}
+
+	if _, err := newBloomLayer("k", 1<<40, 0.01); err == nil {
+		t.Error("expected error above the bitmap limit")
+	}
+	if _, err := NewBloomFilter(nil, "{}ids", 1000, 0.01, WithScalable()); err == nil {
+		t.Error("expected error for a scalable key that cannot share a hash tag")
+	}
+}
+
+func TestBloomFilter_Layers(t *testing.T) {
+	f, err := NewBloomFilter(nil, "ids", 1000, 0.01, WithScalable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l0, _ := f.layer(0)
+	l2, _ := f.layer(2)
+	if l0.key != "{ids}:0" || l2.key != "{ids}:2" || f.metaKey() != "{ids}:meta" {
+		t.Errorf("unexpected keys %s %s %s", l0.key, l2.key, f.metaKey())
+	}
+	if l2.capacity != 4000 || l2.hashes <= l0.hashes {
+		t.Errorf("expected larger and tighter layer, got %+v after %+v", l2, l0)
+	}
+	if _, err := f.layer(40); err == nil {
+		t.Error("expected error for an oversized layer")
+	}
+
+	for _, bad := range []func() (*BloomFilter, error){
+		func() (*BloomFilter, error) { return NewBloomFilter(nil, "", 1, 0.1) },
+		func() (*BloomFilter, error) { return NewBloomFilter(nil, "k", 0, 0.1) },
+		func() (*BloomFilter, error) { return NewBloomFilter(nil, "k", 1, 1) },
+		func() (*BloomFilter, error) {
+			return NewBloomFilter(nil, "k", 1, 0.1, WithScalable(), WithBloomTightening(1))
+		},
+	} {
+		if _, err := bad(); err == nil {
+			t.Error("expected validation error")
+		}
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	rdb := testRedisClient(t)
+	ctx := context.Background()
+
+	for _, scalable := range []bool{false, true} {
+		t.Run(fmt.Sprintf("scalable=%v", scalable), func(t *testing.T) {
+			var opts []BloomOption
+			if scalable {
+				opts = append(opts, WithScalable())
+			}
+			f, err := NewBloomFilter(rdb, testKey(t, "bloom"), 100, 0.01, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Delete(ctx)
+
+			items := make([]string, 300)
+			for i := range items {
+				items[i] = fmt.Sprintf("item-%d", i)
+			}
+			added, err := f.AddMany(ctx, items[:150]...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !added[0] {
+				t.Error("expected first item added")
+			}
+			if again, _ := f.Add(ctx, items[0]); again {
+				t.Error("expected existing item not added again")
+			}
+
+			exists, err := f.ExistsMany(ctx, items...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			falsePositives := 0
+			for i, ok := range exists {
+				if i < 150 && !ok {
+					t.Fatalf("item %d added but reported missing", i)
+				}
+				if i >= 150 && ok {
+					falsePositives++
+				}
+			}
+			// 150 items exceed the plain filter's capacity, so only bound the scalable one tightly
+			if limit := map[bool]int{false: 30, true: 6}[scalable]; falsePositives > limit {
+				t.Errorf("too many false positives: %d", falsePositives)
+			}
+			if layers, _ := f.layers(ctx); scalable && layers != 2 {
+				t.Errorf("expected a second layer, got %d", layers)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package redistools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrElectionRunning Run was called while another Run of the same election is active
+var ErrElectionRunning = errors.New("redistools: election already running")
+
+const (
+	// electionCampaignSrc take the lease if it is free, or extend it if we already hold it
+	electionCampaignSrc = `
+local cur = redis.call('GET', KEYS[1])
+if cur == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+if not cur then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	return 1
+end
+return 0
+`
+	// electionResignSrc release the lease if we hold it
+	electionResignSrc = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+)
+
+var (
+	electionCampaignScript = redis.NewScript(electionCampaignSrc)
+	electionResignScript   = redis.NewScript(electionResignSrc)
+	electionLeaderScript   = redis.NewScript(`return redis.call('GET', KEYS[1])`)
+)
+
+// ElectionOption set the election options.
+type ElectionOption func(*electionOptions)
+
+type electionOptions struct {
+	id            string
+	leaseTTL      time.Duration
+	renewInterval time.Duration
+	retryInterval time.Duration
+	onElected     func(ctx context.Context)
+	onRevoked     func()
+}
+
+func defaultElectionOptions() *electionOptions {
+	host, _ := os.Hostname()
+	return &electionOptions{
+		id:       fmt.Sprintf("%s-%d-%s", host, os.Getpid(), randomToken()[:8]),
+		leaseTTL: 15 * time.Second,
+	}
+}
+
+// WithElectionID set the candidate id, default "<hostname>-<pid>-<random>"
+func WithElectionID(id string) ElectionOption {
+	return func(o *electionOptions) {
+		o.id = id
+	}
+}
+
+// WithLeaseTTL set how long the leadership lasts without renewal, default 15s
+func WithLeaseTTL(d time.Duration) ElectionOption {
+	return func(o *electionOptions) {
+		o.leaseTTL = d
+	}
+}
+
+// WithRenewInterval set how often the leader renews the lease, default LeaseTTL/3
+func WithRenewInterval(d time.Duration) ElectionOption {
+	return func(o *electionOptions) {
+		o.renewInterval = d
+	}
+}
+
+// WithCampaignInterval set how often a follower tries to take the lease, default LeaseTTL/3
+func WithCampaignInterval(d time.Duration) ElectionOption {
+	return func(o *electionOptions) {
+		o.retryInterval = d
+	}
+}
+
+// WithOnElected called in a new goroutine when this candidate becomes leader,
+// ctx is cancelled when leadership is lost or Run returns. The callback should return soon after ctx is done.
+func WithOnElected(fn func(ctx context.Context)) ElectionOption {
+	return func(o *electionOptions) {
+		o.onElected = fn
+	}
+}
+
+// WithOnRevoked called after leadership is lost and the OnElected callback has returned
+func WithOnRevoked(fn func()) ElectionOption {
+	return func(o *electionOptions) {
+		o.onRevoked = fn
+	}
+}
+
+// Election leader election on a redis lease key, works with single, sentinel and cluster clients
+type Election struct {
+	client  redis.Scripter
+	key     string
+	opts    *electionOptions
+	running atomic.Bool
+	leader  atomic.Bool
+}
+
+// NewElection create an election, all candidates of the same job use the same key
+func NewElection(client redis.Scripter, key string, opts ...ElectionOption) (*Election, error) {
+	o := defaultElectionOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	if key == "" || o.id == "" {
+		return nil, fmt.Errorf("election: key and id cannot be empty")
+	}
+	if o.leaseTTL < time.Millisecond {
+		return nil, fmt.Errorf("election %s: lease ttl must be at least 1ms, got %s", key, o.leaseTTL)
+	}
+	if o.renewInterval <= 0 {
+		o.renewInterval = o.leaseTTL / 3
+	}
+	if o.retryInterval <= 0 {
+		o.retryInterval = o.leaseTTL / 3
+	}
+	if o.renewInterval >= o.leaseTTL {
+		return nil, fmt.Errorf("election %s: renew interval %s must be shorter than lease ttl %s", key, o.renewInterval, o.leaseTTL)
+	}
+	return &Election{client: client, key: key, opts: o}, nil
+}
+
+// ID return the candidate id
+func (e *Election) ID() string {
+	return e.opts.id
+}
+
+// IsLeader report whether this candidate currently holds the leadership
+func (e *Election) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Leader return the id of the current leader, or "" if there is none
+func (e *Election) Leader(ctx context.Context) (string, error) {
+	// a script keeps redis.Scripter sufficient for the client
+	id, err := electionLeaderScript.Run(ctx, e.client, []string{e.key}).Text()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("election %s: %w", e.key, err)
+	}
+	return id, nil
+}
+
+// Run campaign until ctx is done. While leader the lease is renewed every renew interval;
+// leadership is considered lost when the lease is taken by another candidate or cannot be
+// renewed before it may expire. When ctx is done the leadership is resigned so that another
+// candidate can take over immediately, and Run returns nil.
+func (e *Election) Run(ctx context.Context) error {
+	if !e.running.CompareAndSwap(false, true) {
+		return ErrElectionRunning
+	}
+	defer e.running.Store(false)
+
+	var (
+		deadline time.Time // the lease is known to be valid until deadline
+		cancel   context.CancelFunc
+		wg       sync.WaitGroup
+	)
+	elect := func() {
+		leaderCtx, leaderCancel := context.WithCancel(ctx)
+		cancel = leaderCancel
+		e.leader.Store(true)
+		if e.opts.onElected != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				e.opts.onElected(leaderCtx)
+			}()
+		}
+	}
+	revoke := func() {
+		e.leader.Store(false)
+		cancel()
+		wg.Wait()
+		if e.opts.onRevoked != nil {
+			e.opts.onRevoked()
+		}
+	}
+
+	for {
+		start := time.Now()
+		ok, err := e.campaign(ctx)
+		switch {
+		case err == nil && ok:
+			deadline = start.Add(e.opts.leaseTTL)
+			if !e.leader.Load() {
+				elect()
+			}
+		case e.leader.Load() && (err == nil || time.Until(deadline) < e.opts.renewInterval):
+			// taken by another candidate, or the lease may expire before the next renewal
+			revoke()
+		}
+
+		interval := e.opts.retryInterval
+		if e.leader.Load() {
+			interval = e.opts.renewInterval
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if e.leader.Load() {
+				revoke()
+				e.resign()
+			}
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+func (e *Election) campaign(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.opts.renewInterval)
+	defer cancel()
+	res, err := electionCampaignScript.Run(ctx, e.client, []string{e.key}, e.opts.id, e.opts.leaseTTL.Milliseconds()).Int64()
+	if err != nil {
+		return false, err
+	}
+	return res == 1, nil
+}
+
+// resign release the lease with a fresh context, the caller's ctx is already done
+func (e *Election) resign() {
+	ctx, cancel := context.WithTimeout(context.Background(), e.opts.renewInterval)
+	defer cancel()
+	_ = electionResignScript.Run(ctx, e.client, []string{e.key}, e.opts.id).Err()
+}
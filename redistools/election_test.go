@@ -0,0 +1,188 @@
+package redistools
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeLeaseStore implement the election scripts in memory
+type fakeLeaseStore struct {
+	redis.Scripter
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+	down    atomic.Bool
+}
+
+func newFakeLeaseStore() *fakeLeaseStore {
+	return &fakeLeaseStore{values: map[string]string{}, expires: map[string]time.Time{}}
+}
+
+func (f *fakeLeaseStore) get(key string) (string, bool) {
+	if exp, ok := f.expires[key]; ok && time.Now().After(exp) {
+		delete(f.values, key)
+		delete(f.expires, key)
+	}
+	v, ok := f.values[key]
+	return v, ok
+}
+
+func (f *fakeLeaseStore) EvalSha(ctx context.Context, sha string, keys []string, args ...any) *redis.Cmd {
+	if f.down.Load() {
+		return redis.NewCmdResult(nil, errors.New("connection refused"))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := keys[0]
+	cur, ok := f.get(key)
+
+	switch sha {
+	case electionCampaignScript.Hash():
+		if ok && cur != args[0] {
+			return redis.NewCmdResult(int64(0), nil)
+		}
+		f.values[key] = args[0].(string)
+		f.expires[key] = time.Now().Add(time.Duration(args[1].(int64)) * time.Millisecond)
+		return redis.NewCmdResult(int64(1), nil)
+	case electionResignScript.Hash():
+		if ok && cur == args[0] {
+			delete(f.values, key)
+			return redis.NewCmdResult(int64(1), nil)
+		}
+		return redis.NewCmdResult(int64(0), nil)
+	case electionLeaderScript.Hash():
+		if !ok {
+			return redis.NewCmdResult(nil, redis.Nil)
+		}
+		return redis.NewCmdResult(cur, nil)
+	}
+	return redis.NewCmdResult(nil, errors.New("unknown script"))
+}
+
+// leaderRecorder record the callbacks of one candidate
+type leaderRecorder struct {
+	elected atomic.Int32
+	revoked atomic.Int32
+	active  atomic.Bool
+}
+
+func (r *leaderRecorder) options() []ElectionOption {
+	return []ElectionOption{
+		WithOnElected(func(ctx context.Context) {
+			r.elected.Add(1)
+			r.active.Store(true)
+			<-ctx.Done()
+			r.active.Store(false)
+		}),
+		WithOnRevoked(func() { r.revoked.Add(1) }),
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestElection_Failover(t *testing.T) {
+	store := newFakeLeaseStore()
+	ctx := context.Background()
+
+	var recs [2]leaderRecorder
+	var elections [2]*Election
+	var cancels [2]context.CancelFunc
+	var done [2]chan error
+	for n := range elections {
+		opts := append(recs[n].options(), WithElectionID([]string{"a", "b"}[n]), WithLeaseTTL(150*time.Millisecond))
+		e, err := NewElection(store, "job", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		elections[n] = e
+		var runCtx context.Context
+		runCtx, cancels[n] = context.WithCancel(ctx)
+		done[n] = make(chan error, 1)
+		go func() { done[n] <- e.Run(runCtx) }()
+		// let the first candidate win
+		waitFor(t, "first leader", func() bool { return elections[0].IsLeader() })
+	}
+
+	if elections[1].IsLeader() || !recs[0].active.Load() {
+		t.Fatal("expected only the first candidate to lead")
+	}
+	if err := elections[0].Run(ctx); !errors.Is(err, ErrElectionRunning) {
+		t.Errorf("expected ErrElectionRunning, got %v", err)
+	}
+	// the leader keeps the lease past its ttl
+	time.Sleep(400 * time.Millisecond)
+	if id, _ := elections[1].Leader(ctx); id != "a" || elections[1].IsLeader() {
+		t.Fatalf("expected leader a, got %q", id)
+	}
+
+	// graceful resignation lets the follower take over without waiting for the ttl
+	cancels[0]()
+	if err := <-done[0]; err != nil {
+		t.Fatal(err)
+	}
+	if recs[0].active.Load() || recs[0].revoked.Load() != 1 {
+		t.Error("expected leader context cancelled and OnRevoked called on resign")
+	}
+	waitFor(t, "second leader", func() bool { return elections[1].IsLeader() })
+
+	cancels[1]()
+	<-done[1]
+	if id, _ := elections[1].Leader(ctx); id != "" {
+		t.Errorf("expected no leader after shutdown, got %q", id)
+	}
+}
+
+func TestElection_LostLease(t *testing.T) {
+	store := newFakeLeaseStore()
+	var rec leaderRecorder
+	e, err := NewElection(store, "job", append(rec.options(), WithLeaseTTL(150*time.Millisecond))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- e.Run(ctx) }()
+	defer func() { cancel(); <-done }()
+
+	waitFor(t, "leader", e.IsLeader)
+
+	// redis unavailable: leadership is given up before the lease can expire
+	store.down.Store(true)
+	waitFor(t, "revocation", func() bool { return !e.IsLeader() && rec.revoked.Load() == 1 && !rec.active.Load() })
+
+	// taken by another candidate while unreachable
+	store.mu.Lock()
+	store.values["job"] = "other"
+	store.expires["job"] = time.Now().Add(100 * time.Millisecond)
+	store.mu.Unlock()
+	store.down.Store(false)
+	waitFor(t, "re-election after the other lease expires", func() bool { return e.IsLeader() && rec.elected.Load() == 2 })
+}
+
+func TestNewElection_Validation(t *testing.T) {
+	if _, err := NewElection(nil, ""); err == nil {
+		t.Error("expected error for empty key")
+	}
+	if _, err := NewElection(nil, "job", WithLeaseTTL(time.Second), WithRenewInterval(2*time.Second)); err == nil {
+		t.Error("expected error for renew interval above ttl")
+	}
+	e, err := NewElection(nil, "job")
+	if err != nil || e.ID() == "" {
+		t.Errorf("expected default id, got %q, %v", e.ID(), err)
+	}
+}
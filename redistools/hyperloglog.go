@@ -0,0 +1,118 @@
+package redistools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// maxUniqueBuckets limit the number of keys read by one Count
+const maxUniqueBuckets = 10000
+
+// UniqueCounter count unique members per time bucket with HyperLogLog, the
+// standard error is 0.81%. Bucket keys are "{<name>}:<bucket unix seconds>";
+// they share a hash tag so that counts across buckets also work on cluster.
+type UniqueCounter struct {
+	client    redis.Cmdable
+	name      string
+	bucket    time.Duration
+	retention time.Duration
+}
+
+// NewUniqueCounter create a counter with the given bucket size, e.g. time.Hour or 24*time.Hour.
+// Bucket keys expire retention after the bucket ends, 0 means never.
+// Buckets are aligned to the unix epoch, i.e. daily buckets start at 00:00 UTC.
+func NewUniqueCounter(client redis.Cmdable, name string, bucket, retention time.Duration) (*UniqueCounter, error) {
+	if name == "" {
+		return nil, fmt.Errorf("unique counter: name cannot be empty")
+	}
+	if bucket < time.Second || bucket%time.Second != 0 {
+		return nil, fmt.Errorf("unique counter %s: bucket must be a whole number of seconds, got %s", name, bucket)
+	}
+	if retention < 0 {
+		return nil, fmt.Errorf("unique counter %s: retention cannot be negative", name)
+	}
+	if err := checkSlotKey(name); err != nil {
+		return nil, fmt.Errorf("unique counter %s: %w", name, err)
+	}
+	return &UniqueCounter{client: client, name: name, bucket: bucket, retention: retention}, nil
+}
+
+// BucketKey return the key of the bucket containing t
+func (u *UniqueCounter) BucketKey(t time.Time) string {
+	return sameSlotKey(u.name, strconv.FormatInt(u.bucketStart(t).Unix(), 10))
+}
+
+func (u *UniqueCounter) bucketStart(t time.Time) time.Time {
+	return time.Unix(t.Unix()-t.Unix()%int64(u.bucket/time.Second), 0).UTC()
+}
+
+// Add record members seen at t
+func (u *UniqueCounter) Add(ctx context.Context, t time.Time, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	args := make([]any, len(members))
+	for i, m := range members {
+		args[i] = m
+	}
+	key := u.BucketKey(t)
+	pipe := u.client.Pipeline()
+	pipe.PFAdd(ctx, key, args...)
+	if u.retention > 0 {
+		pipe.ExpireAt(ctx, key, u.bucketStart(t).Add(u.bucket+u.retention))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("unique counter %s: %w", u.name, err)
+	}
+	return nil
+}
+
+// Count return the estimated number of unique members in the buckets overlapping [from, to)
+func (u *UniqueCounter) Count(ctx context.Context, from, to time.Time) (int64, error) {
+	keys, err := u.keys(from, to)
+	if err != nil {
+		return 0, err
+	}
+	n, err := u.client.PFCount(ctx, keys...).Result()
+	if err != nil {
+		return 0, fmt.Errorf("unique counter %s: %w", u.name, err)
+	}
+	return n, nil
+}
+
+// CountAt return the estimated number of unique members in the bucket containing t
+func (u *UniqueCounter) CountAt(ctx context.Context, t time.Time) (int64, error) {
+	return u.Count(ctx, t, t.Add(time.Nanosecond))
+}
+
+// Merge merge the buckets overlapping [from, to) into dest, e.g. to keep a weekly rollup.
+// dest must be in the same hash slot as the buckets on cluster, see BucketKey.
+func (u *UniqueCounter) Merge(ctx context.Context, dest string, from, to time.Time) error {
+	keys, err := u.keys(from, to)
+	if err != nil {
+		return err
+	}
+	if err := u.client.PFMerge(ctx, dest, keys...).Err(); err != nil {
+		return fmt.Errorf("unique counter %s: %w", u.name, err)
+	}
+	return nil
+}
+
+func (u *UniqueCounter) keys(from, to time.Time) ([]string, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("unique counter %s: empty range %s - %s", u.name, from, to)
+	}
+	start := u.bucketStart(from)
+	if n := to.Sub(start) / u.bucket; n >= maxUniqueBuckets {
+		return nil, fmt.Errorf("unique counter %s: range covers more than %d buckets", u.name, maxUniqueBuckets)
+	}
+	var keys []string
+	for t := start; t.Before(to); t = t.Add(u.bucket) {
+		keys = append(keys, u.BucketKey(t))
+	}
+	return keys, nil
+}
@@ -0,0 +1,67 @@
+package redistools
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestUniqueCounter_Keys(t *testing.T) {
+	u, err := NewUniqueCounter(nil, "dau", 24*time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2024, 3, 1, 15, 4, 5, 0, time.UTC)
+	if key := u.BucketKey(day); key != "{dau}:1709251200" {
+		t.Errorf("unexpected bucket key %s", key)
+	}
+	keys, err := u.keys(day, day.Add(48*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 || keys[2] != "{dau}:1709424000" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	if _, err := u.keys(day, day); err == nil {
+		t.Error("expected error for an empty range")
+	}
+	if _, err := u.keys(day, day.Add(100000*24*time.Hour)); err == nil {
+		t.Error("expected error for too many buckets")
+	}
+	if _, err := NewUniqueCounter(nil, "x", 1500*time.Millisecond, 0); err == nil {
+		t.Error("expected error for a fractional bucket")
+	}
+	if _, err := NewUniqueCounter(nil, "dau}", time.Hour, 0); err == nil {
+		t.Error("expected error for a name that cannot share a hash tag")
+	}
+}
+
+func TestUniqueCounter(t *testing.T) {
+	rdb := testRedisClient(t)
+	ctx := context.Background()
+	u, err := NewUniqueCounter(rdb, testKey(t, "uv"), time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for i := range 100 {
+		if err := u.Add(ctx, now, fmt.Sprintf("user-%d", i%50)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := u.Add(ctx, now.Add(-time.Hour), "user-1", "user-99"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := u.CountAt(ctx, now); err != nil || n != 50 {
+		t.Errorf("expected 50 unique users, got %d, %v", n, err)
+	}
+	if n, err := u.Count(ctx, now.Add(-time.Hour), now.Add(time.Second)); err != nil || n != 51 {
+		t.Errorf("expected 51 unique users over two buckets, got %d, %v", n, err)
+	}
+	if ttl := rdb.TTL(ctx, u.BucketKey(now)).Val(); ttl <= time.Hour || ttl > 2*time.Hour {
+		t.Errorf("unexpected ttl %s", ttl)
+	}
+}
@@ -0,0 +1,386 @@
+package redistools
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrLockNotAcquired the lock is held by another owner
+	ErrLockNotAcquired = errors.New("redistools: lock not acquired")
+	// ErrLockNotHeld the lock has expired or is owned by someone else
+	ErrLockNotHeld = errors.New("redistools: lock not held")
+)
+
+// The lock is a hash {owner, count, fence} stored at the lock key. The fencing
+// counter lives in a separate key in the same hash slot so that it survives the
+// lock expiring and keeps increasing across owners.
+var (
+	lockAcquireScript = redis.NewScript(`
+local owner = redis.call('HGET', KEYS[1], 'owner')
+if not owner then
+	local fence = redis.call('INCR', KEYS[2])
+	redis.call('HSET', KEYS[1], 'owner', ARGV[1], 'count', 1, 'fence', fence)
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return {1, fence}
+end
+if owner == ARGV[1] and ARGV[3] == '1' then
+	local count = redis.call('HINCRBY', KEYS[1], 'count', 1)
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return {count, tonumber(redis.call('HGET', KEYS[1], 'fence'))}
+end
+return {0, redis.call('PTTL', KEYS[1])}
+`)
+
+	lockReleaseScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'owner') ~= ARGV[1] then
+	return -1
+end
+local count = redis.call('HINCRBY', KEYS[1], 'count', -1)
+if count <= 0 then
+	redis.call('DEL', KEYS[1])
+	return 0
+end
+return count
+`)
+
+	lockExtendScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'owner') ~= ARGV[1] then
+	return 0
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+)
+
+// LockerOption set the locker options.
+type LockerOption func(*lockerOptions)
+
+type lockerOptions struct {
+	retryInterval time.Duration
+}
+
+func defaultLockerOptions() *lockerOptions {
+	return &lockerOptions{
+		retryInterval: 100 * time.Millisecond,
+	}
+}
+
+// WithLockRetryInterval set how long Lock waits between attempts, default 100ms
+func WithLockRetryInterval(d time.Duration) LockerOption {
+	return func(o *lockerOptions) {
+		if d > 0 {
+			o.retryInterval = d
+		}
+	}
+}
+
+// LockOption set the options of a single Lock or TryLock call.
+type LockOption func(*lockOptions)
+
+type lockOptions struct {
+	owner    string
+	watchdog bool
+}
+
+// WithReentrant acquire the lock as owner. The same owner may acquire the lock again
+// while holding it; the lock is released after the matching number of Unlock calls.
+func WithReentrant(owner string) LockOption {
+	return func(o *lockOptions) {
+		o.owner = owner
+	}
+}
+
+// WithoutWatchdog disable lease renewal, the lock expires after ttl unless refreshed manually.
+// Lock.Context is cancelled with ErrLockNotHeld once the lease may have expired.
+func WithoutWatchdog() LockOption {
+	return func(o *lockOptions) {
+		o.watchdog = false
+	}
+}
+
+// Locker distributed lock on redis, works with single, sentinel and cluster clients
+type Locker struct {
+	client redis.Scripter
+	opts   *lockerOptions
+}
+
+// NewLocker create a locker, client can be *redis.Client, *redis.ClusterClient or redis.UniversalClient
+func NewLocker(client redis.Scripter, opts ...LockerOption) *Locker {
+	o := defaultLockerOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Locker{client: client, opts: o}
+}
+
+// Lock acquire the lock, waiting until it is available or ctx is done.
+// Unless WithoutWatchdog is given, the lease is extended every ttl/3 until Unlock.
+func (l *Locker) Lock(ctx context.Context, key string, ttl time.Duration, opts ...LockOption) (*Lock, error) {
+	for {
+		lock, wait, err := l.acquire(ctx, key, ttl, opts)
+		if err == nil {
+			return lock, nil
+		}
+		if !errors.Is(err, ErrLockNotAcquired) {
+			return nil, err
+		}
+
+		// wait for the retry interval with jitter, or less if the lock expires sooner
+		delay := l.opts.retryInterval/2 + rand.N(l.opts.retryInterval/2+1)
+		if wait > 0 && wait < delay {
+			delay = wait
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("lock %s: %w", key, context.Cause(ctx))
+		case <-timer.C:
+		}
+	}
+}
+
+// TryLock acquire the lock once, returns ErrLockNotAcquired if it is held by another owner
+func (l *Locker) TryLock(ctx context.Context, key string, ttl time.Duration, opts ...LockOption) (*Lock, error) {
+	lock, _, err := l.acquire(ctx, key, ttl, opts)
+	return lock, err
+}
+
+// acquire returns the remaining ttl of the lock when it is held by another owner
+func (l *Locker) acquire(ctx context.Context, key string, ttl time.Duration, opts []LockOption) (*Lock, time.Duration, error) {
+	if ttl < time.Millisecond {
+		return nil, 0, fmt.Errorf("lock %s: ttl must be at least 1ms, got %s", key, ttl)
+	}
+	if err := checkSlotKey(key); err != nil {
+		return nil, 0, fmt.Errorf("lock %s: %w", key, err)
+	}
+	o := &lockOptions{watchdog: true}
+	for _, opt := range opts {
+		opt(o)
+	}
+	token, reentrant := o.owner, "1"
+	if token == "" {
+		token, reentrant = randomToken(), "0"
+	}
+
+	fenceKey := sameSlotKey(key, "fence")
+	res, err := lockAcquireScript.Run(ctx, l.client, []string{key, fenceKey}, token, ttl.Milliseconds(), reentrant).Int64Slice()
+	if err != nil {
+		return nil, 0, fmt.Errorf("lock %s: %w", key, err)
+	}
+	if len(res) != 2 {
+		return nil, 0, fmt.Errorf("lock %s: unexpected reply %v", key, res)
+	}
+	if res[0] == 0 {
+		return nil, time.Duration(res[1]) * time.Millisecond, ErrLockNotAcquired
+	}
+
+	lctx, cancel := context.WithCancelCause(context.Background())
+	lock := &Lock{
+		client:   l.client,
+		key:      key,
+		token:    token,
+		fence:    res[1],
+		ttl:      ttl,
+		ctx:      lctx,
+		cancel:   cancel,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		deadline: time.Now().Add(ttl),
+	}
+	if o.watchdog {
+		go lock.watchdog()
+	} else {
+		lock.mu.Lock()
+		lock.expiry = time.AfterFunc(ttl, lock.expire)
+		lock.mu.Unlock()
+		close(lock.done)
+	}
+	return lock, 0, nil
+}
+
+// Lock a held lock
+type Lock struct {
+	client redis.Scripter
+	key    string
+	token  string
+	fence  int64
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	mu       sync.Mutex
+	ttl      time.Duration
+	deadline time.Time // the lease is known to be valid until deadline
+	released bool
+	expiry   *time.Timer // cancel ctx at deadline when there is no watchdog
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// Key return the lock key
+func (lk *Lock) Key() string {
+	return lk.key
+}
+
+// Token return the owner token
+func (lk *Lock) Token() string {
+	return lk.token
+}
+
+// Fence return the fencing token, it increases every time the lock changes owner.
+// Pass it to downstream storage to reject writes from a holder whose lease has expired.
+func (lk *Lock) Fence() int64 {
+	return lk.fence
+}
+
+// Context return a context that is cancelled when the lock is released or the lease is lost,
+// context.Cause returns ErrLockNotHeld when the lease is lost. Without a watchdog the lease is
+// considered lost when ttl passes since the last successful Refresh.
+func (lk *Lock) Context() context.Context {
+	return lk.ctx
+}
+
+// Refresh extend the lease to ttl from now, ttl <= 0 uses the ttl given to Lock
+func (lk *Lock) Refresh(ctx context.Context, ttl time.Duration) error {
+	lk.mu.Lock()
+	if ttl <= 0 {
+		ttl = lk.ttl
+	}
+	lk.mu.Unlock()
+
+	start := time.Now()
+	ok, err := lockExtendScript.Run(ctx, lk.client, []string{lk.key}, lk.token, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return fmt.Errorf("refresh lock %s: %w", lk.key, err)
+	}
+	if ok == 0 {
+		lk.cancel(ErrLockNotHeld)
+		return ErrLockNotHeld
+	}
+	lk.mu.Lock()
+	lk.ttl, lk.deadline = ttl, start.Add(ttl)
+	if lk.expiry != nil && !lk.released {
+		lk.expiry.Reset(time.Until(lk.deadline))
+	}
+	lk.mu.Unlock()
+	return nil
+}
+
+// Unlock release the lock and stop the watchdog; for a reentrant lock the
+// key is deleted only after the last Unlock. Returns ErrLockNotHeld if the lease had already been lost.
+func (lk *Lock) Unlock(ctx context.Context) error {
+	lk.mu.Lock()
+	if lk.released {
+		lk.mu.Unlock()
+		return nil
+	}
+	lk.released = true
+	close(lk.stop)
+	if lk.expiry != nil {
+		lk.expiry.Stop()
+	}
+	lk.mu.Unlock()
+	<-lk.done
+
+	defer lk.cancel(context.Canceled)
+	res, err := lockReleaseScript.Run(ctx, lk.client, []string{lk.key}, lk.token).Int64()
+	if err != nil {
+		return fmt.Errorf("unlock %s: %w", lk.key, err)
+	}
+	if res < 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// watchdog extend the lease every ttl/3. Transient errors are retried until the
+// lease would have expired, then the lock is considered lost.
+func (lk *Lock) watchdog() {
+	defer close(lk.done)
+	for {
+		lk.mu.Lock()
+		interval, deadline := lk.ttl/3, lk.deadline
+		lk.mu.Unlock()
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-lk.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		err := lk.Refresh(ctx, 0)
+		cancel()
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrLockNotHeld):
+			return
+		case time.Now().After(deadline):
+			lk.cancel(ErrLockNotHeld)
+			return
+		}
+	}
+}
+
+// expire cancel the lock context once the lease may have expired, used without a watchdog
+func (lk *Lock) expire() {
+	lk.mu.Lock()
+	if lk.released {
+		lk.mu.Unlock()
+		return
+	}
+	if wait := time.Until(lk.deadline); wait > 0 {
+		// refreshed while the timer was firing
+		lk.expiry.Reset(wait)
+		lk.mu.Unlock()
+		return
+	}
+	lk.mu.Unlock()
+	lk.cancel(ErrLockNotHeld)
+}
+
+// hasHashTag report whether key contains a non-empty cluster hash tag "{...}"
+func hasHashTag(key string) bool {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSlotKey report an error if sameSlotKey cannot keep key in its cluster slot:
+// a key without a hash tag is wrapped in one, which is only possible when it contains no '}'
+func checkSlotKey(key string) error {
+	if !hasHashTag(key) && strings.IndexByte(key, '}') >= 0 {
+		return fmt.Errorf("key %q contains '}' outside a hash tag", key)
+	}
+	return nil
+}
+
+// sameSlotKey return "<key>:<suffix>" hashed to the same cluster slot as key,
+// key must pass checkSlotKey.
+func sameSlotKey(key, suffix string) string {
+	if hasHashTag(key) {
+		return key + ":" + suffix
+	}
+	return "{" + key + "}:" + suffix
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	_, _ = crand.Read(b)
+	return hex.EncodeToString(b)
+}
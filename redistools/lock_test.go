@@ -0,0 +1,225 @@
+package redistools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// testRedisClient connect to the redis given by REDIS_ADDR, skip the test when it is not set
+func testRedisClient(t *testing.T) *redis.Client {
+	t.Helper()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+	rdb, err := Init(addr)
+	if err != nil {
+		t.Fatalf("connect redis %s: %v", addr, err)
+	}
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb
+}
+
+func testKey(t *testing.T, name string) string {
+	return fmt.Sprintf("redistools_test:%s:%s:%d", t.Name(), name, time.Now().UnixNano())
+}
+
+func TestSameSlotKey(t *testing.T) {
+	cases := map[string]string{
+		"orders":       "{orders}:fence",
+		"lock:{user1}": "lock:{user1}:fence",
+		"a{b}c{d}":     "a{b}c{d}:fence",
+		"half{open":    "{half{open}:fence",
+	}
+	for key, want := range cases {
+		if err := checkSlotKey(key); err != nil {
+			t.Errorf("checkSlotKey(%q): %v", key, err)
+		}
+		if got := sameSlotKey(key, "fence"); got != want {
+			t.Errorf("sameSlotKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+	// wrapping these in "{...}" would hash them to a different slot
+	for _, key := range []string{"a}b", "{}x", "x{}y}", "}{"} {
+		if err := checkSlotKey(key); err == nil {
+			t.Errorf("checkSlotKey(%q): expected error", key)
+		}
+	}
+}
+
+// fakeLockScripter grant every lock and refresh, and count the script calls
+type fakeLockScripter struct {
+	redis.Scripter
+	calls atomic.Int32
+}
+
+func (f *fakeLockScripter) EvalSha(ctx context.Context, sha string, keys []string, args ...any) *redis.Cmd {
+	f.calls.Add(1)
+	switch sha {
+	case lockAcquireScript.Hash():
+		return redis.NewCmdResult([]any{int64(1), int64(1)}, nil)
+	case lockExtendScript.Hash():
+		return redis.NewCmdResult(int64(1), nil)
+	case lockReleaseScript.Hash():
+		return redis.NewCmdResult(int64(0), nil)
+	}
+	return redis.NewCmdResult(nil, errors.New("unknown script"))
+}
+
+func TestLocker_InvalidKey(t *testing.T) {
+	client := &fakeLockScripter{}
+	if _, err := NewLocker(client).TryLock(context.Background(), "a}b", time.Second); err == nil || errors.Is(err, ErrLockNotAcquired) {
+		t.Errorf("expected invalid key error, got %v", err)
+	}
+	if client.calls.Load() != 0 {
+		t.Error("invalid key should be rejected before calling redis")
+	}
+}
+
+func TestLock_WithoutWatchdogExpires(t *testing.T) {
+	ctx := context.Background()
+	locker := NewLocker(&fakeLockScripter{})
+
+	lock, err := locker.TryLock(ctx, "job", 60*time.Millisecond, WithoutWatchdog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if err := lock.Refresh(ctx, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	// past the original ttl, but within the refreshed one
+	time.Sleep(60 * time.Millisecond)
+	if lock.Context().Err() != nil {
+		t.Fatal("context cancelled before the refreshed lease expired")
+	}
+	select {
+	case <-lock.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("context not cancelled after the lease expired")
+	}
+	if cause := context.Cause(lock.Context()); !errors.Is(cause, ErrLockNotHeld) {
+		t.Errorf("expected ErrLockNotHeld, got %v", cause)
+	}
+
+	// Unlock before the ttl stops the timer
+	lock, err = locker.TryLock(ctx, "job", 30*time.Millisecond, WithoutWatchdog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if cause := context.Cause(lock.Context()); !errors.Is(cause, context.Canceled) {
+		t.Errorf("expected context.Canceled after Unlock, got %v", cause)
+	}
+}
+
+func TestLocker(t *testing.T) {
+	rdb := testRedisClient(t)
+	ctx := context.Background()
+	key := testKey(t, "lock")
+	locker := NewLocker(rdb, WithLockRetryInterval(10*time.Millisecond))
+
+	lock, err := locker.Lock(ctx, key, 300*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := locker.TryLock(ctx, key, time.Second); !errors.Is(err, ErrLockNotAcquired) {
+		t.Fatalf("expected ErrLockNotAcquired, got %v", err)
+	}
+
+	// the watchdog keeps the lease alive past its ttl
+	time.Sleep(time.Second)
+	if ttl := rdb.PTTL(ctx, key).Val(); ttl <= 0 {
+		t.Fatalf("expected lease renewed, ttl=%s", ttl)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := locker.Lock(waitCtx, key, time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	if err := lock.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if lock.Context().Err() == nil {
+		t.Error("expected lock context cancelled after unlock")
+	}
+	next, err := locker.TryLock(ctx, key, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Unlock(ctx)
+	if next.Fence() <= lock.Fence() {
+		t.Errorf("expected increasing fence, got %d then %d", lock.Fence(), next.Fence())
+	}
+}
+
+func TestLocker_Reentrant(t *testing.T) {
+	rdb := testRedisClient(t)
+	ctx := context.Background()
+	key := testKey(t, "lock")
+	locker := NewLocker(rdb)
+
+	outer, err := locker.TryLock(ctx, key, time.Second, WithReentrant("worker-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := locker.TryLock(ctx, key, time.Second, WithReentrant("worker-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inner.Fence() != outer.Fence() {
+		t.Errorf("reentrant acquisition should keep the fence, got %d and %d", outer.Fence(), inner.Fence())
+	}
+	if _, err := locker.TryLock(ctx, key, time.Second, WithReentrant("worker-2")); !errors.Is(err, ErrLockNotAcquired) {
+		t.Fatalf("expected ErrLockNotAcquired for another owner, got %v", err)
+	}
+
+	if err := inner.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rdb.Exists(ctx, key).Val() != 1 {
+		t.Fatal("lock released before the outer unlock")
+	}
+	if err := outer.Unlock(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rdb.Exists(ctx, key).Val() != 0 {
+		t.Fatal("lock not released after the outer unlock")
+	}
+}
+
+func TestLocker_Lost(t *testing.T) {
+	rdb := testRedisClient(t)
+	ctx := context.Background()
+	key := testKey(t, "lock")
+
+	lock, err := NewLocker(rdb).TryLock(ctx, key, 150*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdb.Del(ctx, key)
+
+	select {
+	case <-lock.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected lock context cancelled after the lease was lost")
+	}
+	if cause := context.Cause(lock.Context()); !errors.Is(cause, ErrLockNotHeld) {
+		t.Errorf("expected ErrLockNotHeld cause, got %v", cause)
+	}
+	if err := lock.Unlock(ctx); !errors.Is(err, ErrLockNotHeld) {
+		t.Errorf("expected ErrLockNotHeld from unlock, got %v", err)
+	}
+}
@@ -17,13 +17,13 @@ type options struct {
 	writeTimeout time.Duration
 	tlsConfig    *tls.Config
 
-	// Note: this field is only used for Init and InitSingle, and the other parameters will be ignored.
+	// Note: this field is only used for Init, InitSingle and single InitUniversal, and the other parameters will be ignored.
 	singleOptions *redis.Options
 
-	// Note: this field is only used for InitSentinel, and the other parameters will be ignored.
+	// Note: this field is only used for InitSentinel and sentinel InitUniversal, and the other parameters will be ignored.
 	sentinelOptions *redis.FailoverOptions
 
-	// Note: this field is only used for InitCluster, and the other parameters will be ignored.
+	// Note: this field is only used for InitCluster and cluster InitUniversal, and the other parameters will be ignored.
 	clusterOptions *redis.ClusterOptions
 
 	// deprecated: use tp instead
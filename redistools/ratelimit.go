@@ -0,0 +1,355 @@
+package redistools
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LimitAlgorithm rate limiting algorithm
+type LimitAlgorithm int
+
+const (
+	// FixedWindow allow Rate requests per window, the window starts at the first request
+	FixedWindow LimitAlgorithm = iota
+	// SlidingLog keep a timestamp per request, exact but uses memory proportional to Rate
+	SlidingLog
+	// SlidingWindow approximate a sliding window by weighting the previous fixed window
+	SlidingWindow
+	// TokenBucket refill Rate tokens per Period up to Burst
+	TokenBucket
+	// GCRA generic cell rate algorithm, same behaviour as TokenBucket with a single value per key
+	GCRA
+)
+
+func (a LimitAlgorithm) String() string {
+	switch a {
+	case FixedWindow:
+		return "fixed_window"
+	case SlidingLog:
+		return "sliding_log"
+	case SlidingWindow:
+		return "sliding_window"
+	case TokenBucket:
+		return "token_bucket"
+	case GCRA:
+		return "gcra"
+	}
+	return fmt.Sprintf("LimitAlgorithm(%d)", int(a))
+}
+
+// Limit Rate requests per Period. Burst is the bucket size for TokenBucket and GCRA, default Rate.
+type Limit struct {
+	Rate   int64
+	Period time.Duration
+	Burst  int64
+}
+
+// PerSecond rate requests per second
+func PerSecond(rate int64) Limit {
+	return Limit{Rate: rate, Period: time.Second}
+}
+
+// PerMinute rate requests per minute
+func PerMinute(rate int64) Limit {
+	return Limit{Rate: rate, Period: time.Minute}
+}
+
+// PerHour rate requests per hour
+func PerHour(rate int64) Limit {
+	return Limit{Rate: rate, Period: time.Hour}
+}
+
+func (l Limit) validate() error {
+	if l.Rate <= 0 {
+		return fmt.Errorf("rate limit: rate must be positive, got %d", l.Rate)
+	}
+	if l.Period < time.Millisecond {
+		return fmt.Errorf("rate limit: period must be at least 1ms, got %s", l.Period)
+	}
+	if l.Burst < 0 {
+		return fmt.Errorf("rate limit: burst cannot be negative, got %d", l.Burst)
+	}
+	return nil
+}
+
+func (l Limit) burst() int64 {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Rate
+}
+
+// LimitResult result of Allow
+type LimitResult struct {
+	Allowed    bool
+	Remaining  int64         // requests still allowed right now
+	RetryAfter time.Duration // when denied, wait this long before retrying; -1 if n can never be allowed
+	Local      bool          // decided by the in-process fallback because redis was unavailable
+}
+
+// Limiter rate limiter
+type Limiter interface {
+	// Allow report whether n requests for key may happen now, and consume them if so
+	Allow(ctx context.Context, key string, n int64) (LimitResult, error)
+}
+
+// The scripts read the clock with TIME so that all replicas share the redis clock;
+// times are in microseconds. Each script returns {allowed, remaining, retry_after_us}.
+// Timestamps passed back to redis go through fmt(), because redis converts Lua numbers
+// with %.14g, which loses precision on microsecond timestamps.
+const limiterScriptPrelude = `
+if redis.replicate_commands then redis.replicate_commands() end
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local limit, period, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local function fmt(v) return string.format('%.0f', v) end
+if n > limit then
+	return {0, 0, -1}
+end
+`
+
+var limiterScripts = map[LimitAlgorithm]*redis.Script{
+	FixedWindow: redis.NewScript(limiterScriptPrelude + `
+local count = tonumber(redis.call('GET', KEYS[1]) or '0')
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	redis.call('SET', KEYS[1], n, 'PX', math.ceil(period / 1000))
+	return {1, limit - n, 0}
+end
+if count + n > limit then
+	return {0, limit - count, ttl * 1000}
+end
+redis.call('INCRBY', KEYS[1], n)
+return {1, limit - count - n, 0}
+`),
+
+	SlidingLog: redis.NewScript(limiterScriptPrelude + `
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', fmt(now - period))
+local count = redis.call('ZCARD', KEYS[1])
+if count + n > limit then
+	local oldest = count + n - limit - 1
+	local entry = redis.call('ZRANGE', KEYS[1], oldest, oldest, 'WITHSCORES')
+	return {0, limit - count, tonumber(entry[2]) + period - now}
+end
+for i = 1, n do
+	redis.call('ZADD', KEYS[1], fmt(now), ARGV[4] .. ':' .. i)
+end
+redis.call('PEXPIRE', KEYS[1], math.ceil(period / 1000))
+return {1, limit - count - n, 0}
+`),
+
+	SlidingWindow: redis.NewScript(limiterScriptPrelude + `
+local start = now - now % period
+local h = redis.call('HMGET', KEYS[1], 'start', 'cur', 'prev')
+local s, cur, prev = tonumber(h[1]), tonumber(h[2]) or 0, tonumber(h[3]) or 0
+if s ~= start then
+	if s == start - period then prev = cur else prev = 0 end
+	cur = 0
+end
+local elapsed = now - start
+local estimated = prev * (period - elapsed) / period + cur
+if estimated + n > limit then
+	local retry
+	if cur + n > limit then
+		-- wait for the next window, where the current count becomes the weighted one
+		retry = period - elapsed + period * (1 - (limit - n) / cur)
+	else
+		retry = period * (1 - (limit - cur - n) / prev) - elapsed
+	end
+	return {0, math.max(0, math.floor(limit - estimated)), math.ceil(retry)}
+end
+redis.call('HSET', KEYS[1], 'start', fmt(start), 'cur', cur + n, 'prev', prev)
+redis.call('PEXPIRE', KEYS[1], math.ceil(2 * period / 1000))
+return {1, math.floor(limit - estimated - n), 0}
+`),
+
+	TokenBucket: redis.NewScript(limiterScriptPrelude + `
+local rate = tonumber(ARGV[4]) / period
+local h = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens, ts = tonumber(h[1]) or limit, tonumber(h[2]) or now
+tokens = math.min(limit, tokens + math.max(0, now - ts) * rate)
+if tokens < n then
+	return {0, math.floor(tokens), math.ceil((n - tokens) / rate)}
+end
+tokens = tokens - n
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', fmt(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((limit - tokens) / rate / 1000) + 1)
+return {1, math.floor(tokens), 0}
+`),
+
+	GCRA: redis.NewScript(limiterScriptPrelude + `
+local emission = period / tonumber(ARGV[4])
+local tolerance = emission * limit
+local tat = math.max(tonumber(redis.call('GET', KEYS[1]) or '0'), now)
+local new_tat = tat + emission * n
+local allow_at = new_tat - tolerance
+if allow_at > now then
+	return {0, math.floor((tolerance - (tat - now)) / emission), math.ceil(allow_at - now)}
+end
+redis.call('SET', KEYS[1], fmt(new_tat), 'PX', math.ceil((new_tat - now) / 1000))
+return {1, math.floor((tolerance - (new_tat - now)) / emission), 0}
+`),
+}
+
+// LimiterOption set the rate limiter options.
+type LimiterOption func(*limiterOptions)
+
+type limiterOptions struct {
+	prefix   string
+	fallback Limiter
+}
+
+func defaultLimiterOptions() *limiterOptions {
+	return &limiterOptions{
+		prefix: "ratelimit:",
+	}
+}
+
+// WithLimiterPrefix set the key prefix, default "ratelimit:"
+func WithLimiterPrefix(prefix string) LimiterOption {
+	return func(o *limiterOptions) {
+		o.prefix = prefix
+	}
+}
+
+// WithLimiterFallback decide with an in-process limiter when redis is unavailable.
+// The fallback only sees the requests of this process, so its limit is usually the shared limit divided by the number of replicas.
+func WithLimiterFallback(limit Limit) LimiterOption {
+	return func(o *limiterOptions) {
+		o.fallback = NewLocalLimiter(limit)
+	}
+}
+
+// RateLimiter rate limiter shared across processes through redis
+type RateLimiter struct {
+	client    redis.Scripter
+	algorithm LimitAlgorithm
+	limit     Limit
+	script    *redis.Script
+	opts      *limiterOptions
+}
+
+// NewRateLimiter create a rate limiter, client can be *redis.Client, *redis.ClusterClient or redis.UniversalClient
+func NewRateLimiter(client redis.Scripter, algorithm LimitAlgorithm, limit Limit, opts ...LimiterOption) (*RateLimiter, error) {
+	if err := limit.validate(); err != nil {
+		return nil, err
+	}
+	script, ok := limiterScripts[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("rate limit: unsupported algorithm %s", algorithm)
+	}
+	o := defaultLimiterOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &RateLimiter{client: client, algorithm: algorithm, limit: limit, script: script, opts: o}, nil
+}
+
+// Allow report whether n requests for key may happen now, and consume them if so.
+// If redis fails and a fallback is configured, the fallback decides and the error is dropped.
+func (r *RateLimiter) Allow(ctx context.Context, key string, n int64) (LimitResult, error) {
+	if n <= 0 {
+		return LimitResult{}, fmt.Errorf("rate limit %s: n must be positive, got %d", key, n)
+	}
+
+	// capacity, period in microseconds, n, algorithm specific argument
+	capacity, extra := r.limit.Rate, any(nil)
+	switch r.algorithm {
+	case SlidingLog:
+		extra = randomToken()
+	case TokenBucket, GCRA:
+		capacity, extra = r.limit.burst(), r.limit.Rate
+	}
+	args := []any{capacity, r.limit.Period.Microseconds(), n}
+	if extra != nil {
+		args = append(args, extra)
+	}
+
+	res, err := r.script.Run(ctx, r.client, []string{r.opts.prefix + key}, args...).Int64Slice()
+	if err == nil && len(res) != 3 {
+		err = fmt.Errorf("unexpected reply %v", res)
+	}
+	if err != nil {
+		if r.opts.fallback != nil && ctx.Err() == nil {
+			result, _ := r.opts.fallback.Allow(ctx, key, n)
+			result.Local = true
+			return result, nil
+		}
+		return LimitResult{}, fmt.Errorf("rate limit %s: %w", key, err)
+	}
+
+	result := LimitResult{Allowed: res[0] == 1, Remaining: res[1], RetryAfter: time.Duration(res[2]) * time.Microsecond}
+	if res[2] < 0 {
+		result.RetryAfter = -1
+	}
+	return result, nil
+}
+
+// LocalLimiter in-process GCRA rate limiter, used as the fallback of RateLimiter
+type LocalLimiter struct {
+	limit Limit
+	now   func() time.Time
+
+	mu      sync.Mutex
+	tats    map[string]time.Time // theoretical arrival time per key
+	cleanAt time.Time
+}
+
+// NewLocalLimiter create an in-process limiter; an invalid limit denies every request
+func NewLocalLimiter(limit Limit) *LocalLimiter {
+	return &LocalLimiter{limit: limit, now: time.Now, tats: make(map[string]time.Time)}
+}
+
+// Allow report whether n requests for key may happen now, and consume them if so
+func (l *LocalLimiter) Allow(_ context.Context, key string, n int64) (LimitResult, error) {
+	if err := l.limit.validate(); err != nil {
+		return LimitResult{RetryAfter: -1}, err
+	}
+	burst := l.limit.burst()
+	if n <= 0 {
+		return LimitResult{}, fmt.Errorf("rate limit %s: n must be positive, got %d", key, n)
+	}
+	if n > burst {
+		return LimitResult{RetryAfter: -1}, nil
+	}
+
+	emission := float64(l.limit.Period) / float64(l.limit.Rate)
+	tolerance := time.Duration(emission * float64(burst))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.cleanLocked(now)
+
+	tat := l.tats[key]
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(time.Duration(emission * float64(n)))
+	if allowAt := newTat.Add(-tolerance); allowAt.After(now) {
+		remaining := int64(float64(tolerance-tat.Sub(now)) / emission)
+		return LimitResult{Remaining: max(remaining, 0), RetryAfter: allowAt.Sub(now)}, nil
+	}
+	l.tats[key] = newTat
+	return LimitResult{Allowed: true, Remaining: int64(float64(tolerance-newTat.Sub(now)) / emission)}, nil
+}
+
+// cleanLocked drop keys whose bucket is full again, at most once per period
+func (l *LocalLimiter) cleanLocked(now time.Time) {
+	if now.Before(l.cleanAt) {
+		return
+	}
+	l.cleanAt = now.Add(max(l.limit.Period, time.Second))
+	for key, tat := range l.tats {
+		if !tat.After(now) {
+			delete(l.tats, key)
+		}
+	}
+}
+
+var _ Limiter = (*RateLimiter)(nil)
+var _ Limiter = (*LocalLimiter)(nil)
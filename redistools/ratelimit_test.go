@@ -0,0 +1,116 @@
+package redistools
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestLocalLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	l := NewLocalLimiter(Limit{Rate: 10, Period: time.Second, Burst: 5})
+	l.now = func() time.Time { return now }
+
+	for i := int64(0); i < 5; i++ {
+		res, err := l.Allow(ctx, "k", 1)
+		if err != nil || !res.Allowed || res.Remaining != 4-i {
+			t.Fatalf("request %d: unexpected result %+v, %v", i, res, err)
+		}
+	}
+	res, _ := l.Allow(ctx, "k", 1)
+	if res.Allowed || res.RetryAfter != 100*time.Millisecond {
+		t.Fatalf("expected denial with 100ms retry, got %+v", res)
+	}
+	if res, _ := l.Allow(ctx, "other", 1); !res.Allowed {
+		t.Error("keys should be limited independently")
+	}
+
+	now = now.Add(250 * time.Millisecond)
+	if res, _ := l.Allow(ctx, "k", 2); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("expected 2 tokens refilled, got %+v", res)
+	}
+	if res, _ := l.Allow(ctx, "k", 6); res.Allowed || res.RetryAfter != -1 {
+		t.Errorf("expected n above burst to never be allowed, got %+v", res)
+	}
+
+	// full buckets are dropped during cleanup
+	now = now.Add(time.Hour)
+	l.Allow(ctx, "k", 1)
+	if len(l.tats) != 1 {
+		t.Errorf("expected idle keys cleaned, got %d keys", len(l.tats))
+	}
+
+	if _, err := NewLocalLimiter(Limit{}).Allow(ctx, "k", 1); err == nil {
+		t.Error("expected error for invalid limit")
+	}
+}
+
+func TestRateLimiter_Fallback(t *testing.T) {
+	ctx := context.Background()
+	down := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	defer down.Close()
+
+	limiter, err := NewRateLimiter(down, GCRA, PerSecond(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := limiter.Allow(ctx, "k", 1); err == nil {
+		t.Fatal("expected error without fallback")
+	}
+
+	limiter, _ = NewRateLimiter(down, GCRA, PerSecond(100), WithLimiterFallback(Limit{Rate: 1, Period: time.Minute}))
+	res, err := limiter.Allow(ctx, "k", 1)
+	if err != nil || !res.Allowed || !res.Local {
+		t.Fatalf("expected local decision, got %+v, %v", res, err)
+	}
+	if res, _ := limiter.Allow(ctx, "k", 1); res.Allowed || !res.Local {
+		t.Errorf("expected fallback limit enforced, got %+v", res)
+	}
+}
+
+func TestNewRateLimiter_Validation(t *testing.T) {
+	for _, limit := range []Limit{{}, {Rate: 1}, {Rate: 1, Period: time.Second, Burst: -1}} {
+		if _, err := NewRateLimiter(nil, GCRA, limit); err == nil {
+			t.Errorf("expected error for %+v", limit)
+		}
+	}
+	if _, err := NewRateLimiter(nil, LimitAlgorithm(99), PerSecond(1)); err == nil {
+		t.Error("expected error for unknown algorithm")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	rdb := testRedisClient(t)
+	ctx := context.Background()
+
+	for _, algorithm := range []LimitAlgorithm{FixedWindow, SlidingLog, SlidingWindow, TokenBucket, GCRA} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			limiter, err := NewRateLimiter(rdb, algorithm, Limit{Rate: 5, Period: 500 * time.Millisecond})
+			if err != nil {
+				t.Fatal(err)
+			}
+			key := testKey(t, "limit")
+			for i := int64(0); i < 5; i++ {
+				res, err := limiter.Allow(ctx, key, 1)
+				if err != nil || !res.Allowed || res.Remaining != 4-i {
+					t.Fatalf("request %d: unexpected result %+v, %v", i, res, err)
+				}
+			}
+			res, err := limiter.Allow(ctx, key, 1)
+			if err != nil || res.Allowed || res.RetryAfter <= 0 || res.RetryAfter > 600*time.Millisecond {
+				t.Fatalf("expected denial, got %+v, %v", res, err)
+			}
+			if res, _ := limiter.Allow(ctx, key, 6); res.Allowed || res.RetryAfter != -1 {
+				t.Errorf("expected n above capacity to never be allowed, got %+v", res)
+			}
+
+			time.Sleep(res.RetryAfter + 20*time.Millisecond)
+			if res, err := limiter.Allow(ctx, key, 1); err != nil || !res.Allowed {
+				t.Errorf("expected allowed after retry-after, got %+v, %v", res, err)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package redistools
 import (
 	"context"
 	"errors"
+	"net/url"
 	"strings"
 	"time"
 
@@ -18,6 +19,8 @@ const (
 	ErrRedisNotFound = redis.Nil
 	// DefaultRedisName default redis name
 	DefaultRedisName = "default"
+
+	pingTimeout = 15 * time.Second
 )
 
 // Init connecting to redis
@@ -49,8 +52,7 @@ func Init(dsn string, opts ...Option) (*redis.Client, error) {
 		}
 	}
 
-	ctx, _ := context.WithTimeout(context.Background(), 15*time.Second) //nolint
-	err = rdb.Ping(ctx).Err()
+	err = ping(rdb)
 
 	return rdb, err
 }
@@ -85,8 +87,7 @@ func InitSingle(addr string, username, password string, db int, opts ...Option)
 		}
 	}
 
-	ctx, _ := context.WithTimeout(context.Background(), 15*time.Second) //nolint
-	err := rdb.Ping(ctx).Err()
+	err := ping(rdb)
 
 	return rdb, err
 }
@@ -121,8 +122,7 @@ func InitSentinel(masterName string, addrs []string, username string, password s
 		}
 	}
 
-	ctx, _ := context.WithTimeout(context.Background(), 15*time.Second) //nolint
-	err := rdb.Ping(ctx).Err()
+	err := ping(rdb)
 
 	return rdb, err
 }
@@ -156,27 +156,38 @@ func InitCluster(addrs []string, username string, password string, opts ...Optio
 		}
 	}
 
-	ctx, _ := context.WithTimeout(context.Background(), 15*time.Second) //nolint
-	err := clusterRdb.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
-		return client.Ping(ctx).Err()
-	})
+	err := ping(clusterRdb)
 
 	return clusterRdb, err
 }
 
+// ping check the connection, a cluster client pings every master
+func ping(rdb redis.UniversalClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	if clusterRdb, ok := rdb.(*redis.ClusterClient); ok {
+		return clusterRdb.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return client.Ping(ctx).Err()
+		})
+	}
+	return rdb.Ping(ctx).Err()
+}
+
 func getRedisOpt(dsn string, opts *options) (*redis.Options, error) {
 	dsn = strings.ReplaceAll(dsn, " ", "")
-	if len(dsn) > 8 {
-		if !strings.Contains(dsn[len(dsn)-3:], "/") {
-			dsn += "/0" // use db 0 by default
-		}
-
-		if dsn[:8] != "redis://" && dsn[:9] != "rediss://" {
-			dsn = "redis://" + dsn
-		}
+	if !strings.Contains(dsn, "://") {
+		dsn = "redis://" + dsn
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if u.Path == "" {
+		u.Path = "/0" // use db 0 by default
 	}
 
-	redisOpts, err := redis.ParseURL(dsn)
+	redisOpts, err := redis.ParseURL(u.String())
 	if err != nil {
 		return nil, err
 	}
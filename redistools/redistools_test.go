@@ -29,6 +29,29 @@ func TestGetRedisOpt(t *testing.T) {
 	}
 }
 
+func TestGetRedisOpt_Query(t *testing.T) {
+	opt, err := getRedisOpt("redis://h:6379/2?dial_timeout=3s&max_retries=5&protocol=3", defaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opt.DB != 2 || opt.DialTimeout != 3*time.Second || opt.MaxRetries != 5 || opt.Protocol != 3 {
+		t.Errorf("unexpected options db=%d dial=%s retries=%d protocol=%d", opt.DB, opt.DialTimeout, opt.MaxRetries, opt.Protocol)
+	}
+
+	// db 0 is added only when the path is empty
+	opt, err = getRedisOpt("h:6379?max_retries=-1", defaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opt.Addr != "h:6379" || opt.DB != 0 || opt.MaxRetries != -1 {
+		t.Errorf("unexpected options addr=%s db=%d retries=%d", opt.Addr, opt.DB, opt.MaxRetries)
+	}
+
+	if _, err := getRedisOpt("redis://h:6379/x", defaultOptions()); err == nil {
+		t.Error("expected error for an invalid db")
+	}
+}
+
 func TestCloseNil(t *testing.T) {
 	if err := Close(nil); err != nil {
 		t.Fatalf("expected nil error, got %v", err)
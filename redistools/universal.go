@@ -0,0 +1,231 @@
+package redistools
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/redis/go-redis/extra/redisotel/v9"
+	"github.com/redis/go-redis/v9"
+)
+
+// InitUniversal connecting to redis of any topology, the topology is chosen by the dsn scheme.
+// dsn supported formats.
+// (1) single: localhost:6379, redis://<user>:<pass>@localhost:6379/2, rediss://...
+// (2) sentinel: redis-sentinel://[<user>:<pass>@]<master>@<host1>,<host2>/<db>?sentinel_password=xxx, default port 26379
+// (3) cluster: redis-cluster://[<user>:<pass>@]<host1>,<host2>?route_by_latency=true
+// use rediss-sentinel:// or rediss-cluster:// for TLS. Query parameters are the same as
+// redis.ParseURL, redis.ParseFailoverURL and redis.ParseClusterURL.
+// The shared options (timeouts, TLS, tracing) are applied to every topology,
+// WithSingleOptions, WithSentinelOptions and WithClusterOptions replace the parsed options of their topology.
+// The client is closed if the ping fails.
+func InitUniversal(dsn string, opts ...Option) (redis.UniversalClient, error) {
+	o := defaultOptions()
+	o.apply(opts...)
+
+	rdb, err := newUniversalClient(strings.TrimSpace(dsn), o)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.tracerProvider != nil {
+		err = redisotel.InstrumentTracing(rdb, redisotel.WithTracerProvider(o.tracerProvider))
+		if err != nil {
+			_ = rdb.Close()
+			return nil, err
+		}
+	}
+
+	if err = ping(rdb); err != nil {
+		_ = rdb.Close()
+		return nil, err
+	}
+	return rdb, nil
+}
+
+func newUniversalClient(dsn string, o *options) (redis.UniversalClient, error) {
+	scheme, rest, _ := strings.Cut(dsn, "://")
+	switch scheme {
+	case "redis-sentinel", "rediss-sentinel":
+		opt := o.sentinelOptions
+		if opt == nil {
+			var err error
+			if opt, err = parseSentinelDSN(strings.TrimSuffix(scheme, "-sentinel"), rest, o); err != nil {
+				return nil, err
+			}
+		}
+		return redis.NewFailoverClient(opt), nil
+
+	case "redis-cluster", "rediss-cluster":
+		opt := o.clusterOptions
+		if opt == nil {
+			var err error
+			if opt, err = parseClusterDSN(strings.TrimSuffix(scheme, "-cluster"), rest, o); err != nil {
+				return nil, err
+			}
+		}
+		return redis.NewClusterClient(opt), nil
+	}
+
+	opt := o.singleOptions
+	if opt == nil {
+		var err error
+		if opt, err = getRedisOpt(dsn, o); err != nil {
+			return nil, err
+		}
+	}
+	return redis.NewClient(opt), nil
+}
+
+// topologyDSN the parts of a sentinel or cluster dsn: [<userinfo>@][<master>@]<hosts>[/<db>][?<query>]
+type topologyDSN struct {
+	user     *url.Userinfo
+	master   string
+	hosts    []string
+	path     string
+	rawQuery string
+}
+
+// parseTopologyDSN hosts without a port get defaultPort
+func parseTopologyDSN(rest string, withMaster bool, defaultPort string) (*topologyDSN, error) {
+	d := &topologyDSN{}
+	rest, d.rawQuery, _ = strings.Cut(rest, "?")
+
+	// the hosts follow the last '@', the path follows the first '/' after them
+	at := strings.LastIndexByte(rest, '@')
+	authority, hosts := "", rest
+	if at >= 0 {
+		authority, hosts = rest[:at], rest[at+1:]
+	}
+	if slash := strings.IndexByte(hosts, '/'); slash >= 0 {
+		hosts, d.path = hosts[:slash], hosts[slash:]
+	}
+
+	if withMaster {
+		at = strings.LastIndexByte(authority, '@')
+		d.master = authority[at+1:]
+		if at < 0 {
+			authority = ""
+		} else {
+			authority = authority[:at]
+		}
+		if d.master == "" {
+			return nil, fmt.Errorf("redis dsn: missing master name")
+		}
+	}
+
+	if authority != "" {
+		username, password, hasPassword := strings.Cut(authority, ":")
+		var err error
+		if username, err = url.PathUnescape(username); err != nil {
+			return nil, fmt.Errorf("redis dsn: invalid username: %w", err)
+		}
+		if password, err = url.PathUnescape(password); err != nil {
+			return nil, fmt.Errorf("redis dsn: invalid password: %w", err)
+		}
+		d.user = url.User(username)
+		if hasPassword {
+			d.user = url.UserPassword(username, password)
+		}
+	}
+
+	for _, h := range strings.Split(hosts, ",") {
+		if h = strings.TrimSpace(h); h == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(h); err != nil {
+			h = net.JoinHostPort(strings.Trim(h, "[]"), defaultPort)
+		}
+		d.hosts = append(d.hosts, h)
+	}
+	if len(d.hosts) == 0 {
+		return nil, fmt.Errorf("redis dsn: missing hosts")
+	}
+	return d, nil
+}
+
+// parseSentinelDSN convert the dsn to the format of redis.ParseFailoverURL, where the
+// userinfo belongs to the sentinels; here it belongs to the redis nodes as in InitSentinel.
+func parseSentinelDSN(scheme, rest string, o *options) (*redis.FailoverOptions, error) {
+	d, err := parseTopologyDSN(rest, true, "26379")
+	if err != nil {
+		return nil, err
+	}
+	query, err := url.ParseQuery(d.rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("redis dsn: %w", err)
+	}
+	sentinelUsername, sentinelPassword := query.Get("sentinel_username"), query.Get("sentinel_password")
+	query.Del("sentinel_username")
+	query.Del("sentinel_password")
+	query.Set("master_name", d.master)
+	if d.user != nil {
+		query.Set("username", d.user.Username())
+		if password, ok := d.user.Password(); ok {
+			query.Set("password", password)
+		}
+	}
+	for _, h := range d.hosts[1:] {
+		query.Add("addr", h)
+	}
+
+	u := url.URL{Scheme: scheme, Host: d.hosts[0], Path: d.path, RawQuery: query.Encode()}
+	opt, err := redis.ParseFailoverURL(u.String())
+	if err != nil {
+		return nil, err
+	}
+	opt.SentinelUsername, opt.SentinelPassword = sentinelUsername, sentinelPassword
+
+	if o.dialTimeout > 0 {
+		opt.DialTimeout = o.dialTimeout
+	}
+	if o.readTimeout > 0 {
+		opt.ReadTimeout = o.readTimeout
+	}
+	if o.writeTimeout > 0 {
+		opt.WriteTimeout = o.writeTimeout
+	}
+	if o.tlsConfig != nil {
+		opt.TLSConfig = o.tlsConfig
+	}
+	return opt, nil
+}
+
+// parseClusterDSN convert the dsn to the format of redis.ParseClusterURL
+func parseClusterDSN(scheme, rest string, o *options) (*redis.ClusterOptions, error) {
+	d, err := parseTopologyDSN(rest, false, "6379")
+	if err != nil {
+		return nil, err
+	}
+	if d.path != "" && d.path != "/" && d.path != "/0" {
+		return nil, fmt.Errorf("redis dsn: cluster only supports db 0, got %s", d.path)
+	}
+	query, err := url.ParseQuery(d.rawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("redis dsn: %w", err)
+	}
+	for _, h := range d.hosts[1:] {
+		query.Add("addr", h)
+	}
+
+	u := url.URL{Scheme: scheme, User: d.user, Host: d.hosts[0], RawQuery: query.Encode()}
+	opt, err := redis.ParseClusterURL(u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if o.dialTimeout > 0 {
+		opt.DialTimeout = o.dialTimeout
+	}
+	if o.readTimeout > 0 {
+		opt.ReadTimeout = o.readTimeout
+	}
+	if o.writeTimeout > 0 {
+		opt.WriteTimeout = o.writeTimeout
+	}
+	if o.tlsConfig != nil {
+		opt.TLSConfig = o.tlsConfig
+	}
+	return opt, nil
+}
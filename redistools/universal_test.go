@@ -0,0 +1,113 @@
+package redistools
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestParseSentinelDSN(t *testing.T) {
+	o := defaultOptions()
+	o.dialTimeout = time.Second
+
+	opt, err := parseSentinelDSN("redis", "app:p%40ss@mymaster@s1:26379,s2:26379/3?sentinel_password=sp&read_timeout=2s", o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opt.MasterName != "mymaster" || opt.DB != 3 {
+		t.Errorf("unexpected master %q db %d", opt.MasterName, opt.DB)
+	}
+	if !reflect.DeepEqual(opt.SentinelAddrs, []string{"s1:26379", "s2:26379"}) {
+		t.Errorf("unexpected sentinel addrs %v", opt.SentinelAddrs)
+	}
+	if opt.Username != "app" || opt.Password != "p@ss" || opt.SentinelPassword != "sp" {
+		t.Errorf("unexpected credentials %q %q %q", opt.Username, opt.Password, opt.SentinelPassword)
+	}
+	if opt.DialTimeout != time.Second || opt.ReadTimeout != 2*time.Second {
+		t.Errorf("unexpected timeouts %s %s", opt.DialTimeout, opt.ReadTimeout)
+	}
+
+	opt, err = parseSentinelDSN("rediss", "mymaster@s1", o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opt.Username != "" || opt.DB != 0 || opt.TLSConfig == nil || opt.SentinelAddrs[0] != "s1:26379" {
+		t.Errorf("unexpected options %+v", opt)
+	}
+
+	for _, bad := range []string{"s1:26379", "@s1", "mymaster@", "mymaster@s1?unknown=1", "mymaster@s1/x"} {
+		if _, err := parseSentinelDSN("redis", bad, o); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseClusterDSN(t *testing.T) {
+	o := defaultOptions()
+	o.tlsConfig = &tls.Config{InsecureSkipVerify: true}
+
+	opt, err := parseClusterDSN("redis", "u:p@n1:7000,n2:7001,n3:7002?route_by_latency=true", o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(opt.Addrs, []string{"n1:7000", "n2:7001", "n3:7002"}) {
+		t.Errorf("unexpected addrs %v", opt.Addrs)
+	}
+	if opt.Username != "u" || opt.Password != "p" || !opt.RouteByLatency {
+		t.Errorf("unexpected options %+v", opt)
+	}
+	if opt.TLSConfig == nil || !opt.TLSConfig.InsecureSkipVerify {
+		t.Error("TLS config not applied")
+	}
+
+	for _, bad := range []string{"", "n1:7000/1", "n1:7000?db=1"} {
+		if _, err := parseClusterDSN("redis", bad, o); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestNewUniversalClient(t *testing.T) {
+	cases := map[string]reflect.Type{
+		"localhost:6379":                   reflect.TypeOf(&redis.Client{}),
+		"redis://localhost:6379/1":         reflect.TypeOf(&redis.Client{}),
+		"redis-sentinel://m@s1,s2/0":       reflect.TypeOf(&redis.Client{}),
+		"rediss-cluster://n1:7000,n2:7001": reflect.TypeOf(&redis.ClusterClient{}),
+	}
+	for dsn, want := range cases {
+		rdb, err := newUniversalClient(dsn, defaultOptions())
+		if err != nil {
+			t.Errorf("%s: %v", dsn, err)
+			continue
+		}
+		if got := reflect.TypeOf(rdb); got != want {
+			t.Errorf("%s: expected %s, got %s", dsn, want, got)
+		}
+		_ = rdb.Close()
+	}
+
+	// explicit topology options replace the parsed ones
+	o := defaultOptions()
+	o.clusterOptions = &redis.ClusterOptions{Addrs: []string{"override:7000"}}
+	rdb, err := newUniversalClient("redis-cluster://n1:7000", o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdb.Close()
+	if addrs := rdb.(*redis.ClusterClient).Options().Addrs; !reflect.DeepEqual(addrs, []string{"override:7000"}) {
+		t.Errorf("expected cluster options override, got %v", addrs)
+	}
+}
+
+func TestInitUniversal_PingFailure(t *testing.T) {
+	rdb, err := InitUniversal("redis://127.0.0.1:1/0?max_retries=-1", WithDialTimeout(100*time.Millisecond))
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "dial" || rdb != nil {
+		t.Errorf("expected dial error and nil client, got %v, %v", rdb, err)
+	}
+}